@@ -2,7 +2,10 @@ package hydra
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -38,13 +41,19 @@ var Domain = executil.Env(`HYDRA_HOST`, `hydra.local`)
 var Environment = executil.Env(`HYDRA_ENV`)
 var ID = executil.Env(`HYDRA_ID`)
 var Hostname, _ = os.Hostname()
+var ErrNotModified = errors.New("not modified")
+var ErrChecksumMismatch = errors.New("checksum mismatch")
 var Client = &http.Client{
-	Timeout: 10 * time.Second,
+	Timeout: DefaultHTTPTimeout,
 }
 
 type GenerateOptions struct {
-	DestDir   string
-	Autobuild bool
+	DestDir     string
+	Autobuild   bool
+	TypeCheck   TypeCheckMode
+	TypeFiles   []string
+	Incremental bool
+	Fetch       FetchOptions
 }
 
 func init() {
@@ -69,6 +78,14 @@ type Application struct {
 	Manifest       *Manifest     `yaml:"manifest,omitempty" json:"manifest,omitempty"`
 	BuildOptions   *BuildOptions `yaml:"build,omitempty"    json:"build,omitempty"`
 	filename       string
+	location       string
+	etag           string
+	data           []byte
+	format         string
+	layers         []string
+	resolved       []byte
+	offline        bool
+	savedAt        time.Time
 }
 
 func IsLoadErr(err error) bool {
@@ -81,30 +98,68 @@ func IsLoadErr(err error) bool {
 
 // Loads an application from the given io.Reader data.
 func FromReader(app *Application, reader io.Reader) error {
+	return fromReader(app, reader, nil, ``)
+}
+
+// loads an application from the given io.Reader data, converting it with the given decoder or,
+// if that is nil, rendering it as a template (see RenderTemplate) with any data files it names
+// relative to dir.
+func fromReader(app *Application, reader io.Reader, decoder Decoder, dir string) error {
 	if app == nil {
 		return fmt.Errorf("must provide app instance")
 	}
 
 	if data, err := ioutil.ReadAll(reader); err == nil {
-		if err := yaml.UnmarshalStrict(data, app); err == nil {
-			return nil
+		if decoded, err := decodeDocument(EntrypointFilename, decoder, data, dir); err == nil {
+			if err := parseApplication(app, decoded); err == nil {
+				app.data = data
+
+				if decoder != nil {
+					app.format = decoder.Name()
+				}
+
+				return nil
+			} else {
+				return err
+			}
 		} else {
-			return fmt.Errorf("parse: %v", err)
+			return err
 		}
 	} else {
 		return fmt.Errorf("from-read: %v", err)
 	}
 }
 
+// parses an application from the given (already rendered) YAML.
+func parseApplication(app *Application, data []byte) error {
+	if err := yaml.UnmarshalStrict(data, app); err == nil {
+		app.sourceNode = parseSourceNode(data)
+		app.resolved = data
+
+		return app.expandTemplates()
+	} else {
+		return fmt.Errorf("parse: %v", err)
+	}
+}
+
 // Loads an application from the given YAML filename.
 func FromFile(app *Application, yamlFilename string) error {
 	if fn, err := fileutil.ExpandUser(yamlFilename); err == nil {
 		if file, err := os.Open(fn); err == nil {
 			defer file.Close()
 
-			if err := FromReader(app, file); err == nil {
+			if err := fromReader(app, file, DecoderFor(yamlFilename), filepath.Dir(yamlFilename)); err == nil {
 				app.filename = yamlFilename
+				app.sourceFile = yamlFilename
 				app.SourceLocation = filepath.Dir(yamlFilename)
+				app.etag = fileETag(file)
+
+				// templates can change with the environment and data files they read
+				if !bytes.Equal(app.data, app.resolved) {
+					sum := sha256.Sum256(append([]byte(app.etag), app.resolved...))
+					app.etag = hex.EncodeToString(sum[:])
+				}
+
 				return nil
 			} else {
 				return err
@@ -117,25 +172,62 @@ func FromFile(app *Application, yamlFilename string) error {
 	}
 }
 
-// Loads an application from the given URL.
+// identifies the version of a local file the way an ETag would, by its size and modification time.
+func fileETag(file *os.File) string {
+	if stat, err := file.Stat(); err == nil {
+		return fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size())
+	}
+
+	return ``
+}
+
+// reports whether the given location is a URL to be retrieved by a Fetcher rather than a local file.
+func isRemote(location string) bool {
+	if scheme, _ := stringutil.SplitPair(location, `://`); scheme != location && scheme != `file` {
+		return true
+	}
+
+	return false
+}
+
+// Loads an application from the given URL, using the Fetcher registered for its scheme.
 func FromURL(app *Application, manifestOrAppFileUrl string) error {
+	return fromURL(app, manifestOrAppFileUrl, ``)
+}
+
+// loads an application from the given URL, unless its source reports that it still matches the
+// given ETag.
+func fromURL(app *Application, manifestOrAppFileUrl string, etag string) error {
 	if u, err := url.Parse(manifestOrAppFileUrl); err == nil {
-		if res, err := Client.Get(u.String()); err == nil {
+		if res, err := Fetch(&FetchRequest{
+			URL:  u,
+			ETag: etag,
+		}); err == nil {
 			defer res.Body.Close()
 
-			if res.StatusCode < 400 {
-				if err := FromReader(app, res.Body); err == nil {
-					u.Path = filepath.Dir(u.Path)
-					app.SourceLocation = u.String()
-					return nil
-				} else {
-					return err
+			var decoder = DecoderForMIME(res.ContentType)
+
+			if decoder == nil {
+				decoder = DecoderFor(res.Filename)
+			}
+
+			if err := fromReader(app, res.Body, decoder, locationDir(manifestOrAppFileUrl)); err == nil {
+				app.SourceLocation = resolveURL(u, `..`).String()
+
+				// without an ETag from the source, changes are detected by the content itself
+				if app.etag = res.ETag; app.etag == `` {
+					sum := sha256.Sum256(app.data)
+					app.etag = hex.EncodeToString(sum[:])
 				}
+
+				return nil
 			} else {
-				return fmt.Errorf("from-http: %s", res.Status)
+				return err
 			}
+		} else if err == ErrNotModified {
+			return err
 		} else {
-			return fmt.Errorf("from-http: %v", err)
+			return fmt.Errorf("from-%s: %v", u.Scheme, err)
 		}
 	} else {
 		return fmt.Errorf("from-url: %v", err)
@@ -144,39 +236,58 @@ func FromURL(app *Application, manifestOrAppFileUrl string) error {
 
 // Automatically attempts to load an application from a variety of sources.  If location is
 // a path to a non-empty, readable file, that will be parsed.  If location is a URL, it will
-// be retrieved via an HTTP GET request.  If location is empty, the following auto-generated
-// locations will be attempted (in order):
+// be retrieved by the Fetcher registered for its scheme (see RegisterFetcher).  If location
+// is empty, the following auto-generated locations will be attempted (in order):
 //
-//   ./{HYDRA_ENV}.app.yaml
 //   ./app.yaml
-//   {HYDRA_OUTPUT_DIR}/{HYDRA_ENV}.app.yaml
+//   ./{HYDRA_ENV}.app.yaml
 //   {HYDRA_OUTPUT_DIR}/app.yaml
-//   ~/.config/hydra/{HYDRA_ENV}.app.yaml
+//   {HYDRA_OUTPUT_DIR}/{HYDRA_ENV}.app.yaml
 //   ~/.config/hydra/app.yaml
-//   /etc/hydra/{HYDRA_ENV}.app.yaml
+//   ~/.config/hydra/{HYDRA_ENV}.app.yaml
 //   /etc/hydra/app.yaml
+//   /etc/hydra/{HYDRA_ENV}.app.yaml
 //   https://{HYDRA_HOST:-hydra.local}/manifest.yaml?env={HYDRA_ENV}&id={HYDRA_ID}&host=${HYDRA_HOSTNAME}
 //   https://{HYDRA_HOST:-hydra.local}/app.yaml?env={HYDRA_ENV}&id={HYDRA_ID}&host=${HYDRA_HOSTNAME}
 //   http://{HYDRA_HOST:-hydra.local}/manifest.yaml?env={HYDRA_ENV}&id={HYDRA_ID}&host=${HYDRA_HOSTNAME}
 //   http://{HYDRA_HOST:-hydra.local}/app.yaml?env={HYDRA_ENV}&id={HYDRA_ID}&host=${HYDRA_HOSTNAME}
 //
+// Each of the local files may instead be in the format of any registered Decoder (app.json,
+// app.toml, app.cue, and so on), which is tried after the YAML one.  Applications retrieved from
+// URLs are decoded by their Content-Type, or else by their extension.
+//
+// Once a local file is loaded, any {HYDRA_ENV}.app.yaml and then {HYDRA_ID}.app.yaml beside it
+// are merged over it, followed by any Overlays (see MergeYAML).
+//
+// If any TrustedKeys are configured, the application found must consist of nothing but a manifest
+// signed by one of them, which lists the app.yaml to generate; an unsigned or tampered manifest is
+// an error rather than a reason to move on to the next location.
+//
+// Applications retrieved from remote locations are saved to the StateDirectory.  If none of the
+// locations can be loaded, the most recently saved copy of any remote one is loaded instead,
+// and the application is marked Offline (which it can check in QML as Hydra.offline).
+//
 func Load(locations ...string) (*Application, error) {
 	locations = sliceutil.CompactString(locations)
 
 	var candidates []string
 
 	if len(locations) == 0 {
-		candidates = append(candidates, Environment+`.`+EntrypointFilename)
-		candidates = append(candidates, EntrypointFilename)
+		local := func(filename string) {
+			candidates = append(candidates, documentVariants(filename)...)
+		}
 
-		candidates = append(candidates, filepath.Join(DefaultOutputDirectory, Environment+`.`+EntrypointFilename))
-		candidates = append(candidates, filepath.Join(DefaultOutputDirectory, EntrypointFilename))
+		local(EntrypointFilename)
+		local(Environment + `.` + EntrypointFilename)
 
-		candidates = append(candidates, `~/.config/hydra/`+Environment+`.`+EntrypointFilename)
-		candidates = append(candidates, `~/.config/hydra/`+EntrypointFilename)
+		local(filepath.Join(DefaultOutputDirectory, EntrypointFilename))
+		local(filepath.Join(DefaultOutputDirectory, Environment+`.`+EntrypointFilename))
 
-		candidates = append(candidates, `/etc/hydra/`+Environment+`.`+EntrypointFilename)
-		candidates = append(candidates, `/etc/hydra/`+EntrypointFilename)
+		local(`~/.config/hydra/` + EntrypointFilename)
+		local(`~/.config/hydra/` + Environment + `.` + EntrypointFilename)
+
+		local(`/etc/hydra/` + EntrypointFilename)
+		local(`/etc/hydra/` + Environment + `.` + EntrypointFilename)
 
 		for _, scheme := range []string{
 			`https`,
@@ -209,16 +320,26 @@ func Load(locations ...string) (*Application, error) {
 		app := new(Application)
 
 		var err error
-		scheme, _ := stringutil.SplitPair(location, `://`)
 		log.Debugf("Load: trying %s", location)
 
-		switch scheme {
-		case `https`, `http`:
+		if isRemote(location) {
 			err = FromURL(app, location)
-		default:
+		} else {
 			err = FromFile(app, location)
 		}
 
+		if err == nil {
+			app.location = location
+
+			if err = app.verifyManifest(); err == nil {
+				if err := app.save(); err != nil {
+					log.Warningf("Load: cannot save a copy of %s: %v", location, err)
+				}
+
+				err = app.overlay(overlaysFor(location))
+			}
+		}
+
 		if err == nil {
 			return app, nil
 		} else {
@@ -228,9 +349,106 @@ func Load(locations ...string) (*Application, error) {
 		}
 	}
 
+	if app, err := loadOfflineFallback(candidates); err == nil {
+		if err := app.overlay(overlaysFor(app.location)); err != nil {
+			log.Warningf("Load: %v", err)
+		}
+
+		return app, nil
+	}
+
 	return nil, fmt.Errorf("no application found by any means")
 }
 
+// Loads the application from the given location (as returned by Location), unless it hasn't
+// changed since it was last loaded with the given ETag, in which case ErrNotModified is returned.
+// URLs are requested with If-None-Match (or the equivalent for their source); local files are
+// compared by size and modification time.  Overlays are merged as they are by Load, and a change
+// to any of them counts as a change to the application.  Changed remote applications are saved
+// to the StateDirectory, also as they are by Load.
+func LoadIfChanged(location string, etag string) (*Application, error) {
+	var err error
+	var app = new(Application)
+	var overlays = overlaysFor(location)
+
+	if isRemote(location) {
+		if len(overlays) == 0 {
+			err = fromURL(app, location, etag)
+		} else {
+			err = fromURL(app, location, ``)
+		}
+	} else {
+		err = FromFile(app, location)
+	}
+
+	if err == nil {
+		app.location = location
+		err = app.verifyManifest()
+	}
+
+	if err == nil {
+		err = app.overlay(overlays)
+	}
+
+	if err == nil && etag != `` && app.etag == etag {
+		err = ErrNotModified
+	}
+
+	if err == nil {
+		if err := app.save(); err != nil {
+			log.Warningf("Load: cannot save a copy of %s: %v", location, err)
+		}
+
+		return app, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Returns where this application was loaded from.
+func (self *Application) Location() string {
+	return self.location
+}
+
+// Returns the ETag (or for local files, an equivalent) of the application as it was loaded.
+func (self *Application) ETag() string {
+	return self.etag
+}
+
+// Checks this application's manifest against TrustedKeys, if any have been configured.  Since
+// the signature only covers the manifest, the document it came in may not declare anything else:
+// the application itself must come from an entrypoint listed (and so checksummed) in the manifest.
+func (self *Application) verifyManifest() error {
+	if len(TrustedKeys) == 0 {
+		return nil
+	} else if self.Manifest == nil {
+		return fmt.Errorf("verify: application has no manifest to verify")
+	} else if err := self.Manifest.verifyTrusted(); err != nil {
+		return err
+	}
+
+	var doc yaml.MapSlice
+
+	if err := yaml.Unmarshal(self.resolved, &doc); err != nil {
+		return fmt.Errorf("verify: %v", err)
+	}
+
+	for _, item := range doc {
+		if key := typeutil.String(item.Key); key != `manifest` {
+			return fmt.Errorf("verify: %q is not covered by the manifest signature; it must be declared in %s", key, EntrypointFilename)
+		}
+	}
+
+	for _, file := range self.Manifest.Files() {
+		// the entrypoint may also be inside an archive, which is checked once it's extracted
+		if file.Name == EntrypointFilename || file.Archive {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("verify: signed manifest does not contain %s", EntrypointFilename)
+}
+
 // This function guarantees that this application has a valid manifest, generating one if necessary.
 func (self *Application) ensureManifest(rootDir string) error {
 	if self.Manifest == nil || self.Manifest.FileCount == 0 {
@@ -287,18 +505,19 @@ func (self *Application) ensureManifest(rootDir string) error {
 
 func (self *Application) writeQrc(intoDir string) error {
 	if qrc, err := self.Manifest.QRC(); err == nil {
-		if qrcfile, err := os.Create(filepath.Join(intoDir, AppQrcFile)); err == nil {
-			defer qrcfile.Close()
+		var files []QrcFile
 
-			if out, err := xml.MarshalIndent(qrc, ``, Indent); err == nil {
-				if _, err := qrcfile.Write(append([]byte(QrcDoctype), out...)); err == nil {
-					return nil
-				} else {
-					return err
-				}
-			} else {
-				return err
+		// output from previous builds should not end up as resources
+		for _, file := range qrc.Resources.Files {
+			if !self.isBuildArtifact(file.Name) {
+				files = append(files, file)
 			}
+		}
+
+		qrc.Resources.Files = files
+
+		if out, err := xml.MarshalIndent(qrc, ``, Indent); err == nil {
+			return writeFileIfChanged(append([]byte(QrcDoctype), out...), filepath.Join(intoDir, AppQrcFile))
 		} else {
 			return err
 		}
@@ -307,6 +526,33 @@ func (self *Application) writeQrc(intoDir string) error {
 	}
 }
 
+// returns whether the given path (relative to the output directory) is the Qt resource file,
+// a build file written by writeAutogenAssets, or something produced by building the application.
+func (self *Application) isBuildArtifact(name string) bool {
+	target := `app`
+
+	if self.BuildOptions != nil && self.BuildOptions.Target != `` {
+		target = self.BuildOptions.Target
+	}
+
+	switch name {
+	case AppQrcFile, `Makefile`, target:
+		return true
+	}
+
+	if strings.HasPrefix(name, `qt/`) {
+		return true
+	}
+
+	for file := range _escData {
+		if strings.TrimSuffix(strings.TrimPrefix(file, `/`), `.tmpl`) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (self *Application) writeAutogenAssets(intoDir string) error {
 	fs := FS(false)
 
@@ -354,11 +600,9 @@ func (self *Application) writeAutogenAssets(intoDir string) error {
 				}
 			}
 
-			if dst, err := os.Create(dstfile); err == nil {
-				defer dst.Close()
-
-				if n, err := io.Copy(dst, srcrdr); err == nil {
-					log.Debugf("autogen: wrote %s (%d bytes)", dstfile, n)
+			if data, err := ioutil.ReadAll(srcrdr); err == nil {
+				if err := writeFileIfChanged(data, dstfile); err == nil {
+					log.Debugf("autogen: wrote %s (%d bytes)", dstfile, len(data))
 				} else {
 					return err
 				}
@@ -377,7 +621,15 @@ func (self *Application) writeAutogenAssets(intoDir string) error {
 func (self *Application) Generate(options GenerateOptions) error {
 	intoDir := options.DestDir
 
-	os.RemoveAll(intoDir)
+	// incremental builds keep the output of the last run (including compiled objects), and
+	// only clean up the files that the current manifest no longer contains
+	var previous *Manifest
+
+	if options.Incremental {
+		previous = loadGeneratedManifest(intoDir)
+	} else {
+		os.RemoveAll(intoDir)
+	}
 
 	if err := os.MkdirAll(intoDir, 0700); err != nil {
 		return err
@@ -390,28 +642,46 @@ func (self *Application) Generate(options GenerateOptions) error {
 			log.Debugf("manifest contains %d files in %v", self.Manifest.FileCount, convutil.Bytes(self.Manifest.TotalSize))
 		}
 
-		if err := self.Manifest.Fetch(self.SourceLocation, intoDir); err != nil {
+		if err := self.Manifest.FetchWithOptions(self.SourceLocation, intoDir, options.Fetch); err != nil {
 			return fmt.Errorf("fetch: %v", err)
 		}
 
+		if previous != nil {
+			self.Manifest.removeStale(previous, intoDir)
+		}
+
 		var out bytes.Buffer
 
 		if modules, err := self.Manifest.LoadModules(intoDir); err == nil {
+			var signedEntrypoint bool
+
 			// add standard library functions
 			modules = append(self.getBuiltinModules(), modules...)
 
+			// check component types and properties against the known QML types
+			if err := self.checkTypes(options, modules, &self.Module); err != nil {
+				return fmt.Errorf("typecheck:\n%v", err)
+			}
+
 			// write all modules out to files
 			for _, submodule := range modules {
-				if err := submodule.writeModuleQml(intoDir, self.Manifest.GlobalImports); err != nil {
-					return err
-				}
-
 				// if we got an entrypoint *from* the manifest, we assume it's contents
-				// should supercede our own
+				// should supercede our own (it is written out below, not here)
 				if submodule.RelativePath() == EntrypointFilename {
 					self.Module = *submodule
+					signedEntrypoint = self.Manifest.verified
+					continue
+				}
+
+				if err := submodule.writeModuleQml(intoDir, self.Manifest.GlobalImports); err != nil {
+					return err
 				}
 			}
+
+			// signed applications must take their definition from the manifest (see verifyManifest)
+			if len(TrustedKeys) > 0 && !signedEntrypoint {
+				return fmt.Errorf("verify: signed manifest does not contain %s", EntrypointFilename)
+			}
 		} else {
 			return err
 		}
@@ -436,41 +706,31 @@ func (self *Application) Generate(options GenerateOptions) error {
 			// do some horrors to expose the top-level application item to the stdlib
 			var onCompleted string
 
-			if root.Properties == nil {
-				root.Properties = make(map[string]interface{})
-			}
-
 			if oc, ok := root.Properties[`Component.onCompleted`]; ok {
 				onCompleted = typeutil.String(oc) + "\n"
 			}
 
 			onCompleted = `Hydra.root = ` + root.ID + "; Hydra.init()\n" + onCompleted
-			root.Properties[`Component.onCompleted`] = Literal(onCompleted)
+			root.Set(`Component.onCompleted`, Literal(onCompleted))
 
 			// write child definitions
-			if data, err := root.QML(0, root); err == nil {
+			self.Module.annotate(self.entrypointSource())
+
+			if data, err := root.qml(0, root); err == nil {
 				out.Write(data)
 			} else {
 				return err
 			}
 
 			// write out the manifest we're working with
-			if mfile, err := os.Create(filepath.Join(intoDir, ManifestFilename)); err == nil {
-				defer mfile.Close()
-
-				if err := yaml.NewEncoder(mfile).Encode(&Application{
-					Manifest: self.Manifest,
-				}); err == nil {
-					mfile.Close()
-				} else {
-					return err
-				}
+			if err := self.writeGeneratedManifest(intoDir, previous); err != nil {
+				return err
 			}
 
 			// write out the entrypoint file
-			if _, err := fileutil.WriteFile(
-				&out,
+			if err := writeMappedQml(
 				filepath.Join(intoDir, fileutil.SetExt(EntrypointFilename, `.qml`)),
+				out.Bytes(),
 			); err == nil {
 				// recursively generate all qmldirs
 				if err := self.writeQmlManifest(intoDir); err != nil {
@@ -488,92 +748,155 @@ func (self *Application) Generate(options GenerateOptions) error {
 				}
 
 				if options.Autobuild {
-					log.Infof("building application: %s/app", intoDir)
-
-					for _, program := range []string{
-						`qmake`,
-						`make`,
-					} {
-						cmd := executil.Command(program)
-						cmd.Dir = intoDir
-						cmd.OnStdout = func(line string, _ bool) {
-							if line != `` {
-								log.Debugf("[%s] %s", program, line)
-							}
-						}
-
-						cmd.OnStderr = func(line string, _ bool) {
-							if strings.HasPrefix(line, `Error compiling qml file: `) {
+					if err := self.build(intoDir); err != nil {
+						return err
+					}
+				}
 
-								if parts := strings.Split(line, `:`); len(parts) > 4 {
-									qmlfile := filepath.Join(intoDir, strings.TrimSpace(parts[1]))
-									lineno := int(typeutil.Int(parts[2]))
-									charno := int(typeutil.Int(parts[3]))
+				return nil
+			} else {
+				return err
+			}
+		} else {
+			return fmt.Errorf("invalid root definition")
+		}
+	} else {
+		return err
+	}
+}
 
-									if lineno > 0 {
-										log.Errorf("[%s] %s", program, line)
-										log.Debugf("[%s]      \u256d%s", program, strings.Repeat("\u2500", 69))
+// Writes the manifest used to generate the application into the output directory.  If none of
+// the files have changed since the previous run, that manifest's timestamp is kept so that the
+// file (and the resources that embed it) remain unchanged.
+func (self *Application) writeGeneratedManifest(intoDir string, previous *Manifest) error {
+	manifest := *self.Manifest
 
-										for l := (lineno - ErrorContextLines); l < (lineno + ErrorContextLines); l++ {
-											if ctx := fileutil.ShouldGetNthLine(qmlfile, l); ctx != `` {
-												if l == lineno {
-													log.Debugf("[%s]  %3d \u2502 ${red}%s${reset}", program, l, ctx)
-													log.Debugf("[%s]      \u2502 ${white+b}%s${reset}", program, strings.Repeat(` `, charno-1)+`^`)
-												} else {
-													log.Debugf("[%s]  %3d \u2502 %s", program, l, ctx)
-												}
-											}
-										}
+	if previous != nil && previous.sameFiles(&manifest) {
+		manifest.GeneratedAt = previous.GeneratedAt
+	}
 
-										log.Debugf("[%s]      \u2570%s", program, strings.Repeat("\u2500", 69))
+	if data, err := yaml.Marshal(&Application{
+		Manifest: &manifest,
+	}); err == nil {
+		return writeFileIfChanged(data, filepath.Join(intoDir, ManifestFilename))
+	} else {
+		return err
+	}
+}
 
-										return
-									}
-								}
+// Compiles the generated application in the given directory into a single binary using qmake
+// and make.
+func (self *Application) build(intoDir string) error {
+	log.Infof("building application: %s/app", intoDir)
+	sources := newSourceMapTranslator(intoDir)
+
+	for _, program := range []string{
+		`qmake`,
+		`make`,
+	} {
+		cmd := executil.Command(program)
+		cmd.Dir = intoDir
+		cmd.OnStdout = func(line string, _ bool) {
+			if line != `` {
+				log.Debugf("[%s] %s", program, line)
+			}
+		}
 
-							} else if line != `` {
-								return
-							}
+		cmd.OnStderr = func(line string, _ bool) {
+			if strings.HasPrefix(line, `Error compiling qml file: `) {
 
-							log.Errorf("[%s] %s", program, line)
-						}
+				if parts := strings.Split(line, `:`); len(parts) > 4 {
+					qmlfile := filepath.Join(intoDir, strings.TrimSpace(parts[1]))
+					lineno := int(typeutil.Int(parts[2]))
+					charno := int(typeutil.Int(parts[3]))
 
-						log.Debugf("running command: %q", program)
+					if lineno > 0 {
+						log.Errorf("[%s] %s", program, line)
+						logFileContext(program, qmlfile, lineno, charno)
 
-						if err := cmd.Run(); err != nil {
-							return err
+						// show where in the YAML this QML was generated from
+						if pos, ok := sources.Lookup(strings.TrimSpace(parts[1]), lineno); ok {
+							log.Errorf("[%s] generated from %v", program, pos)
+							logFileContext(program, filepath.Join(intoDir, pos.Filename), pos.Line, pos.Column)
 						}
+
+						return
 					}
 				}
 
-				return nil
-			} else {
-				return err
+			} else if line != `` {
+				return
 			}
-		} else {
-			return fmt.Errorf("invalid root definition")
+
+			log.Errorf("[%s] %s", program, line)
 		}
+
+		log.Debugf("running command: %q", program)
+
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// returns the name of the YAML file this application's entrypoint was loaded from, relative
+// to its source location.
+func (self *Application) entrypointSource() string {
+	if self.filename != `` {
+		return filepath.Base(self.filename)
 	} else {
-		return err
+		return EntrypointFilename
 	}
 }
 
+// logs the lines surrounding the given line of a file, highlighting the line itself.
+func logFileContext(program string, filename string, lineno int, charno int) {
+	log.Debugf("[%s]      \u256d%s", program, strings.Repeat("\u2500", 69))
+
+	for l := (lineno - ErrorContextLines); l < (lineno + ErrorContextLines); l++ {
+		if ctx := fileutil.ShouldGetNthLine(filename, l); ctx != `` {
+			if l == lineno {
+				log.Debugf("[%s]  %3d \u2502 ${red}%s${reset}", program, l, ctx)
+
+				if charno > 0 {
+					log.Debugf("[%s]      \u2502 ${white+b}%s${reset}", program, strings.Repeat(` `, charno-1)+`^`)
+				}
+			} else {
+				log.Debugf("[%s]  %3d \u2502 %s", program, l, ctx)
+			}
+		}
+	}
+
+	log.Debugf("[%s]      \u2570%s", program, strings.Repeat("\u2500", 69))
+}
+
 func (self *Application) writeQmlManifest(rootDir string) error {
+	var dirs []string
+
+	// directories are gathered first, as writing a qmldir may remove a stale one
 	if err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err == nil {
-			if info.IsDir() {
-				return writeQmldir(path, ``)
-			} else {
-				return nil
+			if info.IsDir() && path != rootDir {
+				dirs = append(dirs, path)
 			}
+
+			return nil
 		} else {
 			return err
 		}
-	}); err == nil {
-		return writeQmldir(rootDir, `Application`)
-	} else {
+	}); err != nil {
 		return err
 	}
+
+	for _, dir := range dirs {
+		if err := writeQmldir(dir, ``); err != nil {
+			return err
+		}
+	}
+
+	return writeQmldir(rootDir, `Application`)
 }
 
 // generates a syntactically-correct QML import statement from a string.
@@ -602,13 +925,11 @@ func toImportStatement(imp string) (string, error) {
 		if alias != `` {
 			return fmt.Sprintf("import %q as %s", lib, alias), nil
 		} else if strings.ToLower(filepath.Ext(lib)) == `.js` { // script imports require an alias (qualifier)
-			alias = strings.TrimSuffix(filepath.Base(lib), filepath.Ext(lib))
-
-			if unicode.IsLower(rune(alias[0])) {
-				alias = stringutil.Camelize(alias)
+			if alias := scriptImportAlias(lib); alias != `` {
+				return fmt.Sprintf("import %q as %s", lib, alias), nil
+			} else {
+				return ``, fmt.Errorf("script import %q needs a qualifier (e.g. Name:%s)", lib, lib)
 			}
-
-			return fmt.Sprintf("import %q as %s", lib, alias), nil
 		} else {
 			return fmt.Sprintf("import %q", lib), nil
 		}
@@ -622,3 +943,17 @@ func toImportStatement(imp string) (string, error) {
 		}
 	}
 }
+
+// returns the qualifier a script is imported as when none is given: its name, camelized.  Scripts
+// named only for their extension have none.
+func scriptImportAlias(lib string) string {
+	alias := strings.TrimSuffix(filepath.Base(lib), filepath.Ext(lib))
+
+	if alias == `` {
+		return ``
+	} else if unicode.IsLower(rune(alias[0])) {
+		alias = stringutil.Camelize(alias)
+	}
+
+	return alias
+}
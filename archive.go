@@ -0,0 +1,479 @@
+package hydra
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const DefaultBundleFormat = `tar.gz`
+
+type ArchiveEntryType int
+
+const (
+	ArchiveFile ArchiveEntryType = iota
+	ArchiveDir
+	ArchiveSymlink
+	ArchiveHardlink
+	ArchiveOther
+)
+
+func (self ArchiveEntryType) String() string {
+	switch self {
+	case ArchiveFile:
+		return `file`
+	case ArchiveDir:
+		return `directory`
+	case ArchiveSymlink:
+		return `symlink`
+	case ArchiveHardlink:
+		return `hardlink`
+	default:
+		return `special file`
+	}
+}
+
+// Describes a single file, directory, or link in an archive, independent of the archive format.
+type ArchiveEntry struct {
+	Name     string
+	Type     ArchiveEntryType
+	Mode     os.FileMode
+	Size     int64
+	ModTime  time.Time
+	Linkname string
+}
+
+func archiveEntryFromInfo(name string, info os.FileInfo) *ArchiveEntry {
+	entry := &ArchiveEntry{
+		Name:    filepath.ToSlash(name),
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+
+	if info.IsDir() {
+		entry.Type = ArchiveDir
+	} else {
+		entry.Size = info.Size()
+	}
+
+	return entry
+}
+
+type ArchiveReader interface {
+	// Returns the next entry in the archive and a reader for its contents, or io.EOF once
+	// there are no more entries.
+	Next() (*ArchiveEntry, io.Reader, error)
+	Close() error
+}
+
+type ArchiveWriter interface {
+	// Adds an entry to the archive.  The data is only read for file entries.
+	WriteEntry(entry *ArchiveEntry, data io.Reader) error
+	Close() error
+}
+
+// An ArchiveFormat knows how to read and write one kind of archive.  Formats are identified
+// by name (e.g. for the --bundle-format flag) and detected from filenames by extension.
+type ArchiveFormat interface {
+	Name() string
+	Extensions() []string
+	NewReader(file *os.File) (ArchiveReader, error)
+	NewWriter(w io.Writer) (ArchiveWriter, error)
+}
+
+var archiveFormats []ArchiveFormat
+
+// Makes an archive format available for extracting manifest entries and writing bundles.
+// Formats registered later take precedence over earlier ones with the same name or extension.
+func RegisterArchiveFormat(format ArchiveFormat) {
+	archiveFormats = append(archiveFormats, format)
+}
+
+// Returns the names of all registered archive formats, sorted.
+func ArchiveFormatNames() (names []string) {
+	for _, format := range archiveFormats {
+		names = append(names, format.Name())
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// Returns the archive format with the given name.
+func GetArchiveFormat(name string) (ArchiveFormat, bool) {
+	for i := len(archiveFormats) - 1; i >= 0; i-- {
+		if archiveFormats[i].Name() == name {
+			return archiveFormats[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the archive format of the given filename based on its extension, or nil if it is
+// not an archive.
+func ArchiveFormatFor(filename string) ArchiveFormat {
+	filename = strings.ToLower(filename)
+
+	for i := len(archiveFormats) - 1; i >= 0; i-- {
+		for _, ext := range archiveFormats[i].Extensions() {
+			if strings.HasSuffix(filename, ext) {
+				return archiveFormats[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	RegisterArchiveFormat(&tarFormat{
+		name:       `tar`,
+		extensions: []string{`.tar`},
+	})
+
+	RegisterArchiveFormat(&tarFormat{
+		name:       `tar.gz`,
+		extensions: []string{`.tar.gz`, `.tgz`},
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+
+	RegisterArchiveFormat(&tarFormat{
+		name:       `tar.xz`,
+		extensions: []string{`.tar.xz`, `.txz`},
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			if xzr, err := xz.NewReader(r); err == nil {
+				return ioutil.NopCloser(xzr), nil
+			} else {
+				return nil, err
+			}
+		},
+	})
+
+	RegisterArchiveFormat(&tarFormat{
+		name:       `tar.zst`,
+		extensions: []string{`.tar.zst`, `.tzst`},
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			if zr, err := zstd.NewReader(r); err == nil {
+				return zr.IOReadCloser(), nil
+			} else {
+				return nil, err
+			}
+		},
+	})
+
+	RegisterArchiveFormat(new(zipFormat))
+}
+
+// tar archives, optionally wrapped in a compression format.
+type tarFormat struct {
+	name       string
+	extensions []string
+	compress   func(io.Writer) (io.WriteCloser, error)
+	decompress func(io.Reader) (io.ReadCloser, error)
+}
+
+func (self *tarFormat) Name() string {
+	return self.name
+}
+
+func (self *tarFormat) Extensions() []string {
+	return self.extensions
+}
+
+func (self *tarFormat) NewReader(file *os.File) (ArchiveReader, error) {
+	reader := new(tarReader)
+
+	if self.decompress != nil {
+		if rc, err := self.decompress(file); err == nil {
+			reader.tr = tar.NewReader(rc)
+			reader.closer = rc
+		} else {
+			return nil, fmt.Errorf("%s: %v", self.name, err)
+		}
+	} else {
+		reader.tr = tar.NewReader(file)
+	}
+
+	return reader, nil
+}
+
+func (self *tarFormat) NewWriter(w io.Writer) (ArchiveWriter, error) {
+	writer := new(tarWriter)
+
+	if self.compress != nil {
+		if wc, err := self.compress(w); err == nil {
+			writer.tw = tar.NewWriter(wc)
+			writer.closer = wc
+		} else {
+			return nil, fmt.Errorf("%s: %v", self.name, err)
+		}
+	} else {
+		writer.tw = tar.NewWriter(w)
+	}
+
+	return writer, nil
+}
+
+type tarReader struct {
+	tr     *tar.Reader
+	closer io.Closer
+}
+
+func (self *tarReader) Next() (*ArchiveEntry, io.Reader, error) {
+	for {
+		header, err := self.tr.Next()
+
+		if err != nil {
+			return nil, nil, err
+		} else if header == nil {
+			continue
+		}
+
+		entry := &ArchiveEntry{
+			Name:     header.Name,
+			Mode:     os.FileMode(header.Mode).Perm(),
+			Size:     header.Size,
+			ModTime:  header.ModTime,
+			Linkname: header.Linkname,
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			entry.Type = ArchiveFile
+		case tar.TypeDir:
+			entry.Type = ArchiveDir
+		case tar.TypeSymlink:
+			entry.Type = ArchiveSymlink
+		case tar.TypeLink:
+			entry.Type = ArchiveHardlink
+		case tar.TypeXGlobalHeader:
+			// these only carry metadata for the entries that follow
+			continue
+		default:
+			entry.Type = ArchiveOther
+		}
+
+		return entry, self.tr, nil
+	}
+}
+
+func (self *tarReader) Close() error {
+	if self.closer != nil {
+		return self.closer.Close()
+	}
+
+	return nil
+}
+
+type tarWriter struct {
+	tw     *tar.Writer
+	closer io.Closer
+}
+
+func (self *tarWriter) WriteEntry(entry *ArchiveEntry, data io.Reader) error {
+	header := &tar.Header{
+		Name:     entry.Name,
+		Mode:     int64(entry.Mode.Perm()),
+		ModTime:  entry.ModTime,
+		Linkname: entry.Linkname,
+	}
+
+	switch entry.Type {
+	case ArchiveFile:
+		header.Typeflag = tar.TypeReg
+		header.Size = entry.Size
+	case ArchiveDir:
+		header.Typeflag = tar.TypeDir
+		header.Name = strings.TrimSuffix(header.Name, `/`) + `/`
+	case ArchiveSymlink:
+		header.Typeflag = tar.TypeSymlink
+	case ArchiveHardlink:
+		header.Typeflag = tar.TypeLink
+	default:
+		return fmt.Errorf("tar: cannot write %v %s", entry.Type, entry.Name)
+	}
+
+	if err := self.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if entry.Type == ArchiveFile && data != nil {
+		if _, err := io.Copy(self.tw, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *tarWriter) Close() error {
+	if err := self.tw.Close(); err != nil {
+		return err
+	}
+
+	if self.closer != nil {
+		return self.closer.Close()
+	}
+
+	return nil
+}
+
+// zip archives, with files compressed individually.
+type zipFormat struct{}
+
+func (self *zipFormat) Name() string {
+	return `zip`
+}
+
+func (self *zipFormat) Extensions() []string {
+	return []string{`.zip`}
+}
+
+func (self *zipFormat) NewReader(file *os.File) (ArchiveReader, error) {
+	if stat, err := file.Stat(); err == nil {
+		if zr, err := zip.NewReader(file, stat.Size()); err == nil {
+			return &zipReader{
+				files: zr.File,
+			}, nil
+		} else {
+			return nil, fmt.Errorf("zip: %v", err)
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func (self *zipFormat) NewWriter(w io.Writer) (ArchiveWriter, error) {
+	return &zipWriter{
+		zw: zip.NewWriter(w),
+	}, nil
+}
+
+type zipReader struct {
+	files   []*zip.File
+	current io.ReadCloser
+}
+
+func (self *zipReader) Next() (*ArchiveEntry, io.Reader, error) {
+	self.closeCurrent()
+
+	if len(self.files) == 0 {
+		return nil, nil, io.EOF
+	}
+
+	file := self.files[0]
+	self.files = self.files[1:]
+	mode := file.Mode()
+
+	entry := &ArchiveEntry{
+		Name:    file.Name,
+		Mode:    mode.Perm(),
+		Size:    int64(file.UncompressedSize64),
+		ModTime: file.Modified,
+	}
+
+	if rc, err := file.Open(); err == nil {
+		self.current = rc
+	} else {
+		return nil, nil, fmt.Errorf("zip: %s: %v", file.Name, err)
+	}
+
+	switch {
+	case mode.IsDir() || strings.HasSuffix(file.Name, `/`):
+		entry.Type = ArchiveDir
+		entry.Size = 0
+	case mode&os.ModeSymlink != 0:
+		// zip stores a symlink's target as the contents of the entry
+		if target, err := ioutil.ReadAll(self.current); err == nil {
+			entry.Type = ArchiveSymlink
+			entry.Linkname = string(target)
+			entry.Size = 0
+		} else {
+			return nil, nil, fmt.Errorf("zip: %s: %v", file.Name, err)
+		}
+	case mode.IsRegular():
+		entry.Type = ArchiveFile
+	default:
+		entry.Type = ArchiveOther
+	}
+
+	return entry, self.current, nil
+}
+
+func (self *zipReader) closeCurrent() {
+	if self.current != nil {
+		self.current.Close()
+		self.current = nil
+	}
+}
+
+func (self *zipReader) Close() error {
+	self.closeCurrent()
+	return nil
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (self *zipWriter) WriteEntry(entry *ArchiveEntry, data io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     entry.Name,
+		Method:   zip.Deflate,
+		Modified: entry.ModTime,
+	}
+
+	switch entry.Type {
+	case ArchiveFile:
+		header.SetMode(entry.Mode.Perm())
+		header.UncompressedSize64 = uint64(entry.Size)
+	case ArchiveDir:
+		header.Name = strings.TrimSuffix(header.Name, `/`) + `/`
+		header.Method = zip.Store
+		header.SetMode(os.ModeDir | entry.Mode.Perm())
+	case ArchiveSymlink:
+		header.SetMode(os.ModeSymlink | entry.Mode.Perm())
+		data = strings.NewReader(entry.Linkname)
+	default:
+		return fmt.Errorf("zip: cannot write %v %s", entry.Type, entry.Name)
+	}
+
+	if w, err := self.zw.CreateHeader(header); err == nil {
+		if entry.Type != ArchiveDir && data != nil {
+			if _, err := io.Copy(w, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *zipWriter) Close() error {
+	return self.zw.Close()
+}
@@ -0,0 +1,143 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+func TestArchiveFormatFor(t *testing.T) {
+	assert := require.New(t)
+
+	for filename, name := range map[string]string{
+		`app.tar`:          `tar`,
+		`app.tar.gz`:       `tar.gz`,
+		`APP.TGZ`:          `tar.gz`,
+		`app.tar.xz`:       `tar.xz`,
+		`app.tar.zst`:      `tar.zst`,
+		`assets/pack.zip`:  `zip`,
+		`http://x/app.zip`: `zip`,
+	} {
+		format := ArchiveFormatFor(filename)
+		assert.NotNil(format, filename)
+		assert.Equal(name, format.Name(), filename)
+	}
+
+	assert.Nil(ArchiveFormatFor(`app.yaml`))
+	assert.Nil(ArchiveFormatFor(`image.gz`))
+}
+
+func TestBundleExtract(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-archive-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcdir := filepath.Join(tmp, `src`)
+	files := map[string]string{
+		`app.yaml`:           "root:\n  type: Window\n",
+		`lib/Button.yaml`:    "definition:\n  type: Rectangle\n",
+		`assets/img/one.svg`: `<svg/>`,
+	}
+
+	for name, data := range files {
+		_, err := fileutil.WriteFile(data, filepath.Join(srcdir, name))
+		assert.NoError(err)
+	}
+
+	source, err := CreateManifest(srcdir)
+	assert.NoError(err)
+
+	for _, name := range ArchiveFormatNames() {
+		format, ok := GetArchiveFormat(name)
+		assert.True(ok)
+
+		bundle := filepath.Join(tmp, `app`+format.Extensions()[0])
+		assert.NoError(source.Bundle(bundle), name)
+
+		destdir := filepath.Join(tmp, `out-`+name)
+		manifest := NewManifest(destdir)
+		assert.NoError(extract(manifest, bundle, destdir, ExtractOptions{
+			FileCount: source.Bundled().FileCount,
+			Size:      source.Bundled().TotalSize,
+		}), name)
+		assert.False(fileutil.FileExists(filepath.Join(destdir, ManifestFilename)), name)
+		assert.False(fileutil.FileExists(bundle), name)
+
+		assert.EqualValues(len(files), manifest.FileCount, name)
+
+		for file, data := range files {
+			actual, err := ioutil.ReadFile(filepath.Join(destdir, file))
+			assert.NoError(err, name)
+			assert.Equal(data, string(actual), name)
+		}
+	}
+
+	assert.Error(source.Bundle(filepath.Join(tmp, `app.rar`)))
+}
+
+func TestManifestArchivesOptIn(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-archive-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcdir := filepath.Join(tmp, `src`)
+	assert.NoError(os.MkdirAll(srcdir, 0755))
+
+	tarball := writeTestTar(assert, srcdir, testTarEntry{name: `hello.txt`, data: `hello`})
+	name := filepath.Base(tarball)
+
+	_, err = fileutil.WriteFile(`app.yaml`, filepath.Join(srcdir, EntrypointFilename))
+	assert.NoError(err)
+
+	// files are not archives just because of their extension...
+	source, err := CreateManifest(srcdir)
+	assert.NoError(err)
+
+	for _, file := range source.Files() {
+		assert.False(file.Archive, file.Name)
+	}
+
+	data, err := ioutil.ReadFile(tarball)
+	assert.NoError(err)
+
+	files := &testFileServer{files: map[string][]byte{name: data}}
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	// ...so they are fetched as they are
+	destdir := filepath.Join(tmp, `plain`)
+	assert.NoError(files.manifest().Fetch(server.URL, destdir))
+	assert.True(fileutil.FileExists(filepath.Join(destdir, name)))
+	assert.False(fileutil.FileExists(filepath.Join(destdir, `hello.txt`)))
+
+	// ...unless they are marked as archives
+	assert.Error(source.MarkArchives(EntrypointFilename))
+	assert.Error(source.MarkArchives(`*.zip`))
+	assert.Error(source.MarkArchives(`[`))
+	assert.NoError(source.MarkArchives(`*.tar`))
+
+	for _, file := range source.Files() {
+		assert.Equal(file.Name == name, file.Archive, file.Name)
+	}
+
+	manifest := files.manifest()
+	assert.NoError(manifest.MarkArchives(name))
+
+	destdir = filepath.Join(tmp, `extracted`)
+	manifest.SetRoot(destdir)
+	assert.NoError(manifest.Fetch(server.URL, destdir))
+	assert.False(fileutil.FileExists(filepath.Join(destdir, name)))
+
+	hello, err := ioutil.ReadFile(filepath.Join(destdir, `hello.txt`))
+	assert.NoError(err)
+	assert.Equal(`hello`, string(hello))
+}
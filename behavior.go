@@ -9,6 +9,7 @@ type Behavior struct {
 	For       string     `json:"for"`
 	Animation *Component `json:"animation"`
 	// Enabled   bool       `json:"enabled,omitempty"`
+	origin *SourcePosition
 }
 
 func (self *Behavior) QML() ([]byte, error) {
@@ -0,0 +1,296 @@
+package hydra
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/convutil"
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultCacheDirectory = executil.Env(`HYDRA_CACHE_DIR`, `~/.cache/hydra`)
+var DefaultCacheMaxSize = int64(convutil.Gigabyte)
+
+// A single file stored in the cache.
+type CacheEntry struct {
+	SHA256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+	Path     string    `json:"path"`
+}
+
+// A content-addressed store of fetched files, shared between every application and output
+// directory on a host.  Files are stored by their SHA256 checksum, and are copied into place
+// whenever a manifest refers to them.  Copies (rather than links) are used so that nothing done
+// to a file in an output directory can change the cached one, or its last-used time.
+type Cache struct {
+	Root    string
+	MaxSize int64 // total size the cache is pruned back to after fetching; zero is unbounded
+}
+
+// Returns a cache rooted at the given directory.
+func NewCache(root string, maxSize int64) (*Cache, error) {
+	if expanded, err := fileutil.ExpandUser(root); err == nil {
+		return &Cache{
+			Root:    expanded,
+			MaxSize: maxSize,
+		}, nil
+	} else {
+		return nil, fmt.Errorf("cache: %v", err)
+	}
+}
+
+func (self *Cache) dir() string {
+	return filepath.Join(self.Root, `sha256`)
+}
+
+// returns where the file with the given checksum is stored.  Checksums come from manifests, so
+// anything that is not one is rejected before it can name a path outside of the cache.
+func (self *Cache) path(sha256 string) (string, error) {
+	if !isSHA256(sha256) {
+		return ``, fmt.Errorf("cache: malformed checksum %q", sha256)
+	}
+
+	return filepath.Join(self.dir(), sha256), nil
+}
+
+// Places the cached file with the given checksum at dest.  The cached copy is checksummed
+// first; if it has been corrupted it is removed and an error is returned.
+func (self *Cache) Get(sha256 string, dest string) error {
+	if sha256 == `` {
+		return fmt.Errorf("cache: no checksum")
+	}
+
+	src, err := self.path(sha256)
+
+	if err != nil {
+		return err
+	} else if !fileutil.FileExists(src) {
+		return fmt.Errorf("cache: %s not found", sha256)
+	} else if err := checkSHA256(src, sha256); err == ErrChecksumMismatch {
+		log.Warningf("cache: removing corrupt entry %s: %v", sha256, err)
+		os.Remove(src)
+		return fmt.Errorf("cache: %v", err)
+	} else if err != nil {
+		return fmt.Errorf("cache: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	os.Remove(dest)
+
+	if err := copyFile(src, dest); err != nil {
+		return fmt.Errorf("cache: %v", err)
+	}
+
+	self.touch(src)
+	return nil
+}
+
+// Stores the file at the given path in the cache under the given checksum.  The caller is
+// expected to have verified that the file matches it.
+func (self *Cache) Put(sha256 string, path string) error {
+	if sha256 == `` {
+		return nil
+	}
+
+	dest, err := self.path(sha256)
+
+	if err != nil {
+		return err
+	} else if fileutil.FileExists(dest) {
+		self.touch(dest)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("cache: %v", err)
+	}
+
+	// entries are staged under a temporary name so that concurrent fetches never see half a file
+	if tmp, err := ioutil.TempFile(filepath.Dir(dest), `.`+sha256+`-`); err == nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		if err := copyFile(path, tmp.Name()); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("cache: %v", err)
+		}
+
+		self.touch(tmp.Name())
+
+		if err := os.Rename(tmp.Name(), dest); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("cache: %v", err)
+		}
+
+		return nil
+	} else {
+		return fmt.Errorf("cache: %v", err)
+	}
+}
+
+// Returns every file in the cache, least recently used first.
+func (self *Cache) Entries() ([]*CacheEntry, error) {
+	var entries []*CacheEntry
+
+	if infos, err := ioutil.ReadDir(self.dir()); err == nil {
+		for _, info := range infos {
+			if info.IsDir() || info.Name()[0] == '.' {
+				continue
+			}
+
+			entries = append(entries, &CacheEntry{
+				SHA256:   info.Name(),
+				Size:     info.Size(),
+				LastUsed: info.ModTime(),
+				Path:     filepath.Join(self.dir(), info.Name()),
+			})
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cache: %v", err)
+	}
+
+	sort.SliceStable(entries, func(i int, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Returns the total size of all files in the cache.
+func (self *Cache) Size() (convutil.Bytes, error) {
+	var size convutil.Bytes
+
+	if entries, err := self.Entries(); err == nil {
+		for _, entry := range entries {
+			size += convutil.Bytes(entry.Size)
+		}
+
+		return size, nil
+	} else {
+		return 0, err
+	}
+}
+
+// Checksums every file in the cache, removing and returning the ones that no longer match.
+func (self *Cache) Verify() ([]*CacheEntry, error) {
+	var corrupt []*CacheEntry
+
+	if entries, err := self.Entries(); err == nil {
+		for _, entry := range entries {
+			if err := checkSHA256(entry.Path, entry.SHA256); err == ErrChecksumMismatch || !isSHA256(entry.SHA256) {
+				log.Warningf("cache: removing corrupt entry %s: %v", entry.SHA256, err)
+
+				if err := os.Remove(entry.Path); err != nil {
+					return corrupt, fmt.Errorf("cache: %v", err)
+				}
+
+				corrupt = append(corrupt, entry)
+			}
+		}
+
+		return corrupt, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Removes the least recently used files from the cache until it is no larger than maxSize,
+// returning the entries that were removed.
+func (self *Cache) Prune(maxSize int64) ([]*CacheEntry, error) {
+	var removed []*CacheEntry
+
+	if entries, err := self.Entries(); err == nil {
+		var total int64
+
+		for _, entry := range entries {
+			total += entry.Size
+		}
+
+		for _, entry := range entries {
+			if total <= maxSize {
+				break
+			}
+
+			log.Debugf("cache: evicting %s (%v)", entry.SHA256, convutil.Bytes(entry.Size))
+
+			if err := os.Remove(entry.Path); err != nil {
+				return removed, fmt.Errorf("cache: %v", err)
+			}
+
+			total -= entry.Size
+			removed = append(removed, entry)
+		}
+
+		return removed, nil
+	} else {
+		return nil, err
+	}
+}
+
+// records that the given entry was just used, for least-recently-used eviction.
+func (self *Cache) touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// verifies that the file at the given path has the given (hex-encoded) SHA-256 checksum.
+func checkSHA256(path string, sha256 string) error {
+	if !isSHA256(sha256) {
+		return fmt.Errorf("malformed checksum %q", sha256)
+	}
+
+	if cksum, err := fileutil.ChecksumFile(path, `sha256`); err == nil {
+		if hex.EncodeToString(cksum) != strings.ToLower(sha256) {
+			return ErrChecksumMismatch
+		}
+
+		return nil
+	} else {
+		return fmt.Errorf("checksum: %v", err)
+	}
+}
+
+// returns whether the given string is a hex-encoded SHA256 checksum.
+func isSHA256(sha256 string) bool {
+	if len(sha256) != 64 {
+		return false
+	} else if _, err := hex.DecodeString(sha256); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// copies src to a new file at dest.
+func copyFile(src string, dest string) error {
+	if in, err := os.Open(src); err == nil {
+		defer in.Close()
+
+		if out, err := os.Create(dest); err == nil {
+			defer out.Close()
+
+			if _, err := io.Copy(out, in); err != nil {
+				return err
+			}
+
+			return out.Close()
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
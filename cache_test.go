@@ -0,0 +1,182 @@
+package hydra
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+func TestCacheFetch(t *testing.T) {
+	assert := require.New(t)
+	files := &testFileServer{
+		files: map[string][]byte{
+			`assets/a.txt`: bytes.Repeat([]byte(`a`), 100),
+			`assets/b.txt`: bytes.Repeat([]byte(`b`), 200),
+		},
+	}
+
+	server := httptest.NewServer(files)
+
+	tmp, err := ioutil.TempDir(``, `hydra-cache-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	cache, err := NewCache(filepath.Join(tmp, `cache`), 0)
+	assert.NoError(err)
+
+	manifest := files.manifest()
+
+	assert.NoError(manifest.FetchWithOptions(server.URL, filepath.Join(tmp, `one`), FetchOptions{
+		Cache: cache,
+	}))
+
+	entries, err := cache.Entries()
+	assert.NoError(err)
+	assert.Len(entries, 2)
+
+	// a second output directory is populated entirely from the cache
+	server.Close()
+
+	assert.NoError(manifest.FetchWithOptions(server.URL, filepath.Join(tmp, `two`), FetchOptions{
+		Retries: -1,
+		Cache:   cache,
+	}))
+
+	for name, data := range files.files {
+		actual, err := ioutil.ReadFile(filepath.Join(tmp, `two`, name))
+		assert.NoError(err)
+		assert.Equal(data, actual)
+	}
+
+	// editing a file in an output directory in place doesn't reach into the cache
+	_, err = fileutil.WriteFile(bytes.NewBufferString(`changed`), filepath.Join(tmp, `two`, `assets/a.txt`))
+	assert.NoError(err)
+
+	corrupt, err := cache.Verify()
+	assert.NoError(err)
+	assert.Empty(corrupt)
+
+	// ...and using a cached file again doesn't change the modification time of earlier copies
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NoError(os.Chtimes(filepath.Join(tmp, `one`, `assets/b.txt`), past, past))
+	bsum := sha256.Sum256(files.files[`assets/b.txt`])
+	assert.NoError(cache.Get(hex.EncodeToString(bsum[:]), filepath.Join(tmp, `three`, `b.txt`)))
+
+	stat, err := os.Stat(filepath.Join(tmp, `one`, `assets/b.txt`))
+	assert.NoError(err)
+	assert.True(stat.ModTime().Equal(past))
+
+	// corrupt entries are found and removed
+	assert.NoError(ioutil.WriteFile(entries[0].Path+`.tmp`, []byte(`bad`), 0644))
+	assert.NoError(os.Rename(entries[0].Path+`.tmp`, entries[0].Path))
+
+	corrupt, err = cache.Verify()
+	assert.NoError(err)
+	assert.Len(corrupt, 1)
+	assert.Equal(entries[0].SHA256, corrupt[0].SHA256)
+}
+
+func TestCachePrune(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-cache-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	cache, err := NewCache(tmp, 0)
+	assert.NoError(err)
+
+	var sums []string
+
+	for i, name := range []string{`old`, `middle`, `new`} {
+		path := filepath.Join(tmp, name)
+		data := bytes.Repeat([]byte(name[:1]), 100)
+		sum := sha256.Sum256(data)
+		sums = append(sums, hex.EncodeToString(sum[:]))
+
+		assert.NoError(ioutil.WriteFile(path, data, 0644))
+		assert.NoError(cache.Put(sums[i], path))
+
+		entry, err := cache.path(sums[i])
+		assert.NoError(err)
+
+		used := time.Now().Add(time.Duration(i-3) * time.Hour)
+		assert.NoError(os.Chtimes(entry, used, used))
+	}
+
+	removed, err := cache.Prune(250)
+	assert.NoError(err)
+	assert.Len(removed, 1)
+	assert.Equal(sums[0], removed[0].SHA256)
+
+	size, err := cache.Size()
+	assert.NoError(err)
+	assert.EqualValues(200, size)
+}
+
+func TestCacheMalformedChecksum(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-cache-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	cache, err := NewCache(filepath.Join(tmp, `cache`), 0)
+	assert.NoError(err)
+
+	victim := filepath.Join(tmp, `victim.txt`)
+	assert.NoError(ioutil.WriteFile(victim, []byte(`keep me`), 0644))
+
+	// checksums from a manifest can never name files outside of the cache
+	for _, sha256 := range []string{
+		`../../victim.txt`,
+		`../victim.txt`,
+		`2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98`,
+		`2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824/..`,
+	} {
+		err := cache.Get(sha256, filepath.Join(tmp, `out.txt`))
+		assert.Error(err, sha256)
+		assert.Contains(err.Error(), `malformed checksum`, sha256)
+
+		err = cache.Put(sha256, victim)
+		assert.Error(err, sha256)
+		assert.Contains(err.Error(), `malformed checksum`, sha256)
+	}
+
+	data, err := ioutil.ReadFile(victim)
+	assert.NoError(err)
+	assert.Equal(`keep me`, string(data))
+	assert.False(fileutil.FileExists(filepath.Join(tmp, `out.txt`)))
+}
+
+func TestCheckSHA256(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-cksum-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, `a.txt`)
+	assert.NoError(ioutil.WriteFile(path, []byte(`hello`), 0644))
+
+	assert.NoError(checkSHA256(path, `2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824`))
+	assert.Equal(ErrChecksumMismatch, checkSHA256(path, `0000000000000000000000000000000000000000000000000000000000000000`))
+
+	err = checkSHA256(path, `nothex`)
+	assert.Error(err)
+	assert.Contains(err.Error(), `malformed checksum`)
+
+	err = checkSHA256(filepath.Join(tmp, `missing.txt`), `2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824`)
+	assert.Error(err)
+	assert.NotContains(err.Error(), `malformed checksum`)
+	assert.Contains(err.Error(), `no such file`)
+}
@@ -0,0 +1,310 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/stringutil"
+)
+
+// The paths (relative to the check-in server URL) that devices check in and upload screenshots to.
+const CheckinPath = `/checkin`
+const ScreenshotPath = `/checkin/screenshot`
+
+// The largest screenshot the reference CheckinServer will accept.
+const MaxScreenshotSize = 32 * 1048576
+
+// A shell command that writes a PNG screenshot of the display to standard output.
+var ScreenshotCommand = executil.Env(`HYDRA_SCREENSHOT_COMMAND`, `import -window root png:-`)
+
+// Commands a check-in server can send to a device.
+const (
+	CommandReload     = `reload`     // retrieve and redeploy the application, even if it hasn't changed
+	CommandRestart    = `restart`    // restart the running application
+	CommandScreenshot = `screenshot` // upload a screenshot of the display
+)
+
+// What a device reports about itself each time it checks in.
+type CheckinRequest struct {
+	ID          string           `json:"id"`
+	Hostname    string           `json:"host"`
+	Environment string           `json:"env,omitempty"`
+	Version     string           `json:"version"`
+	Location    string           `json:"location,omitempty"` // where the running application was loaded from
+	Manifest    string           `json:"manifest,omitempty"` // the ContentHash of the running build
+	Health      *SupervisorState `json:"health,omitempty"`
+}
+
+type CheckinCommand struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// The prefix of the environment variables a check-in server may set through its Config.
+const CheckinConfigPrefix = `HYDRA_APP_`
+
+// What a check-in server tells a device to do.  An empty Location leaves the device running
+// whatever it already is; Config is applied to the environment of the device (and so to the
+// application it runs), though only for variables starting with CheckinConfigPrefix.  Commands
+// are delivered once.
+type CheckinResponse struct {
+	Location string            `json:"location,omitempty"`
+	Config   map[string]string `json:"config,omitempty"`
+	Commands []CheckinCommand  `json:"commands,omitempty"`
+}
+
+// Returns the ID this device checks in with: HYDRA_ID, or its hostname if that isn't set.
+func DeviceID() string {
+	return sliceutil.OrString(ID, Hostname)
+}
+
+// Returns a check-in request describing this device.
+func NewCheckinRequest() *CheckinRequest {
+	return &CheckinRequest{
+		ID:          DeviceID(),
+		Hostname:    Hostname,
+		Environment: Environment,
+		Version:     Version,
+	}
+}
+
+// Checks in with the server at the given URL, returning its instructions.
+func Checkin(serverURL string, request *CheckinRequest) (*CheckinResponse, error) {
+	if body, err := json.Marshal(request); err == nil {
+		if res, err := Client.Post(strings.TrimSuffix(serverURL, `/`)+CheckinPath, `application/json`, bytes.NewReader(body)); err == nil {
+			defer res.Body.Close()
+
+			if res.StatusCode >= 400 {
+				return nil, fmt.Errorf("checkin: %s", res.Status)
+			}
+
+			var response CheckinResponse
+
+			if err := json.NewDecoder(res.Body).Decode(&response); err == nil {
+				return &response, nil
+			} else {
+				return nil, fmt.Errorf("checkin: invalid response: %v", err)
+			}
+		} else {
+			return nil, fmt.Errorf("checkin: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("checkin: %v", err)
+	}
+}
+
+// Captures a screenshot with ScreenshotCommand and uploads it to the server at the given URL in
+// response to the given command.
+func UploadScreenshot(serverURL string, command CheckinCommand) error {
+	if data, err := executil.ShellCommand(ScreenshotCommand).Output(); err == nil {
+		u := fmt.Sprintf("%s%s?id=%s&command=%s",
+			strings.TrimSuffix(serverURL, `/`),
+			ScreenshotPath,
+			url.QueryEscape(DeviceID()),
+			url.QueryEscape(command.ID),
+		)
+
+		if res, err := Client.Post(u, `image/png`, bytes.NewReader(data)); err == nil {
+			res.Body.Close()
+
+			if res.StatusCode >= 400 {
+				return fmt.Errorf("screenshot: %s", res.Status)
+			}
+
+			return nil
+		} else {
+			return fmt.Errorf("screenshot: %v", err)
+		}
+	} else {
+		return fmt.Errorf("screenshot: %v", err)
+	}
+}
+
+// A device as last seen by the CheckinServer.
+type Device struct {
+	CheckinRequest
+	Checkins int       `json:"checkins"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// A reference implementation of the check-in protocol, holding everything in memory.  It is
+// suitable as a stand-in for a real fleet server in tests, or for small deployments.
+type CheckinServer struct {
+	Default     CheckinResponse // Location and Config for devices without an assignment of their own
+	devices     map[string]*Device
+	assignments map[string]CheckinResponse
+	pending     map[string][]CheckinCommand
+	requested   map[string]string
+	screenshots map[string][]byte
+	lock        sync.Mutex
+}
+
+func NewCheckinServer() *CheckinServer {
+	return &CheckinServer{
+		devices:     make(map[string]*Device),
+		assignments: make(map[string]CheckinResponse),
+		pending:     make(map[string][]CheckinCommand),
+		requested:   make(map[string]string),
+		screenshots: make(map[string][]byte),
+	}
+}
+
+// Tells the given device which application to run and with what configuration.
+func (self *CheckinServer) Assign(id string, location string, config map[string]string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.assignments[id] = CheckinResponse{
+		Location: location,
+		Config:   config,
+	}
+}
+
+// Queues a command for the given device, delivered the next time it checks in.  The ID of the
+// command is returned.
+func (self *CheckinServer) Send(id string, name string) string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	command := CheckinCommand{
+		ID:   stringutil.UUID().Base58(),
+		Name: name,
+	}
+
+	self.pending[id] = append(self.pending[id], command)
+	return command.ID
+}
+
+// Returns the given device as it was when it last checked in.
+func (self *CheckinServer) Device(id string) (Device, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if device, ok := self.devices[id]; ok {
+		return *device, true
+	}
+
+	return Device{}, false
+}
+
+// Returns every device that has checked in, sorted by ID.
+func (self *CheckinServer) Devices() (devices []Device) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, device := range self.devices {
+		devices = append(devices, *device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+
+	return
+}
+
+// Returns the screenshot uploaded in response to the given command, if any.
+func (self *CheckinServer) Screenshot(commandID string) ([]byte, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	data, ok := self.screenshots[commandID]
+	return data, ok
+}
+
+func (self *CheckinServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, `method not allowed`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch req.URL.Path {
+	case CheckinPath:
+		var request CheckinRequest
+
+		if err := json.NewDecoder(io.LimitReader(req.Body, MaxBundleManifestSize)).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if request.ID == `` {
+			http.Error(w, `device ID is required`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set(`Content-Type`, `application/json`)
+		json.NewEncoder(w).Encode(self.checkin(&request))
+
+	case ScreenshotPath:
+		if data, err := ioutil.ReadAll(io.LimitReader(req.Body, MaxScreenshotSize+1)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if len(data) > MaxScreenshotSize {
+			http.Error(w, `screenshot too large`, http.StatusRequestEntityTooLarge)
+		} else if !self.acceptScreenshot(req.URL.Query().Get(`id`), req.URL.Query().Get(`command`), data) {
+			http.Error(w, `no such screenshot requested`, http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// records a check-in, returning (and dequeuing) whatever the device should do next.
+func (self *CheckinServer) checkin(request *CheckinRequest) *CheckinResponse {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	device, ok := self.devices[request.ID]
+
+	if !ok {
+		device = new(Device)
+		self.devices[request.ID] = device
+	}
+
+	device.CheckinRequest = *request
+	device.Checkins += 1
+	device.LastSeen = time.Now()
+
+	response := self.Default
+
+	if assigned, ok := self.assignments[request.ID]; ok {
+		response.Location = assigned.Location
+		response.Config = assigned.Config
+	}
+
+	response.Commands = self.pending[request.ID]
+	delete(self.pending, request.ID)
+
+	// remember which device screenshots have been asked of, so that only those are accepted
+	for _, command := range response.Commands {
+		if command.Name == CommandScreenshot {
+			self.requested[command.ID] = request.ID
+		}
+	}
+
+	return &response
+}
+
+func (self *CheckinServer) acceptScreenshot(id string, commandID string, data []byte) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if device, ok := self.requested[commandID]; ok && device == id {
+		delete(self.requested, commandID)
+		self.screenshots[commandID] = data
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestCheckin(t *testing.T) {
+	assert := require.New(t)
+
+	fleet := NewCheckinServer()
+	fleet.Default.Location = `https://example.com/manifest.yaml`
+
+	server := httptest.NewServer(fleet)
+	defer server.Close()
+
+	request := NewCheckinRequest()
+	request.ID = `kiosk-1`
+	request.Manifest = `abc123`
+
+	response, err := Checkin(server.URL, request)
+	assert.NoError(err)
+	assert.Equal(`https://example.com/manifest.yaml`, response.Location)
+	assert.Empty(response.Commands)
+
+	device, ok := fleet.Device(`kiosk-1`)
+	assert.True(ok)
+	assert.Equal(`abc123`, device.Manifest)
+	assert.Equal(Version, device.Version)
+	assert.Equal(1, device.Checkins)
+
+	// assignments and commands are specific to a device, and commands are delivered once
+	fleet.Assign(`kiosk-1`, `https://example.com/other.yaml`, map[string]string{
+		`HYDRA_APP_TEST_CHECKIN`: `yes`,
+	})
+
+	restart := fleet.Send(`kiosk-1`, CommandRestart)
+
+	response, err = Checkin(server.URL, request)
+	assert.NoError(err)
+	assert.Equal(`https://example.com/other.yaml`, response.Location)
+	assert.Equal(`yes`, response.Config[`HYDRA_APP_TEST_CHECKIN`])
+	assert.Equal([]CheckinCommand{{ID: restart, Name: CommandRestart}}, response.Commands)
+
+	response, err = Checkin(server.URL, request)
+	assert.NoError(err)
+	assert.Empty(response.Commands)
+
+	request.ID = `kiosk-2`
+	response, err = Checkin(server.URL, request)
+	assert.NoError(err)
+	assert.Equal(`https://example.com/manifest.yaml`, response.Location)
+	assert.Len(fleet.Devices(), 2)
+
+	request.ID = ``
+	_, err = Checkin(server.URL, request)
+	assert.Error(err)
+}
+
+func TestUpdaterCheckin(t *testing.T) {
+	assert := require.New(t)
+
+	fleet := NewCheckinServer()
+	server := httptest.NewServer(fleet)
+	defer server.Close()
+	defer os.Unsetenv(`HYDRA_APP_TEST_CHECKIN`)
+
+	tmp, err := ioutil.TempDir(``, `hydra-checkin-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	updater := &Updater{
+		location: filepath.Join(tmp, `one.yaml`),
+		etag:     `current`,
+		options: UpdateOptions{
+			GenerateOptions: GenerateOptions{
+				DestDir: filepath.Join(tmp, `out`),
+			},
+			CheckinURL: server.URL,
+		},
+	}
+
+	// the device is told to run something else, with some configuration
+	fleet.Assign(DeviceID(), filepath.Join(tmp, `two.yaml`), map[string]string{
+		`HYDRA_APP_TEST_CHECKIN`: `yes`,
+		`HYDRA_TEST_CHECKIN`:     `no`,
+	})
+
+	assert.NoError(updater.checkin())
+	assert.Equal(filepath.Join(tmp, `two.yaml`), updater.location)
+	assert.Empty(updater.etag)
+	assert.Equal(`yes`, os.Getenv(`HYDRA_APP_TEST_CHECKIN`))
+
+	// only the application's own namespace can be configured
+	_, ok := os.LookupEnv(`HYDRA_TEST_CHECKIN`)
+	assert.False(ok)
+
+	device, ok := fleet.Device(DeviceID())
+	assert.True(ok)
+	assert.Equal(filepath.Join(tmp, `one.yaml`), device.Location)
+
+	// the same configuration leaves the application alone...
+	updater.etag = `current`
+
+	assert.NoError(updater.checkin())
+	assert.Equal(`current`, updater.etag)
+
+	// ...while a change to it has it redeployed
+	fleet.Assign(DeviceID(), filepath.Join(tmp, `two.yaml`), map[string]string{
+		`HYDRA_APP_TEST_CHECKIN`: `changed`,
+	})
+
+	assert.NoError(updater.checkin())
+	assert.Empty(updater.etag)
+	assert.Equal(`changed`, os.Getenv(`HYDRA_APP_TEST_CHECKIN`))
+
+	// a reload forces the application to be retrieved again
+	updater.etag = `current`
+	fleet.Send(DeviceID(), CommandReload)
+
+	assert.NoError(updater.checkin())
+	assert.Empty(updater.etag)
+
+	// screenshots are only accepted when asked for
+	ScreenshotCommand = `printf screenshot`
+	command := CheckinCommand{ID: `unrequested`, Name: CommandScreenshot}
+	assert.Error(UploadScreenshot(server.URL, command))
+
+	command.ID = fleet.Send(DeviceID(), CommandScreenshot)
+	_, err = Checkin(server.URL, NewCheckinRequest())
+	assert.NoError(err)
+	assert.NoError(UploadScreenshot(server.URL, command))
+
+	data, ok := fleet.Screenshot(command.ID)
+	assert.True(ok)
+	assert.Equal(`screenshot`, string(data))
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/ghetzel/cli"
+	"github.com/ghetzel/go-stockutil/convutil"
+	"github.com/ghetzel/go-stockutil/fileutil"
 	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/maputil"
 	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/stringutil"
 	"github.com/ghetzel/hydra"
+	"gopkg.in/yaml.v2"
 )
 
 func main() {
@@ -82,11 +91,182 @@ func main() {
 			Name:  `autobuild, B`,
 			Usage: `Whether to automatically compile the generated QML into a single binary.`,
 		},
+		cli.BoolFlag{
+			Name:   `incremental, i`,
+			Usage:  `Keep the output directory between runs, only rewriting files that have changed.`,
+			EnvVar: `HYDRA_INCREMENTAL`,
+		},
+		cli.IntFlag{
+			Name:   `fetch-concurrency`,
+			Usage:  `How many files to download at once when fetching the application.`,
+			Value:  hydra.DefaultFetchConcurrency,
+			EnvVar: `HYDRA_FETCH_CONCURRENCY`,
+		},
+		cli.IntFlag{
+			Name:   `fetch-retries`,
+			Usage:  `How many times to retry a failed download (0 to disable retrying).`,
+			Value:  hydra.DefaultFetchRetries,
+			EnvVar: `HYDRA_FETCH_RETRIES`,
+		},
+		cli.StringFlag{
+			Name:   `type-check, T`,
+			Usage:  `Check component types, properties, and signal handlers against known QML types (off, warn, fail).`,
+			Value:  `warn`,
+			EnvVar: `HYDRA_TYPE_CHECK`,
+		},
+		cli.StringSliceFlag{
+			Name:   `qmltypes`,
+			Usage:  `Additional .qmltypes or JSON files describing QML types to check against.`,
+			EnvVar: `HYDRA_QMLTYPES`,
+		},
+		cli.StringFlag{
+			Name:   `archive-links`,
+			Usage:  `What to do with symbolic and hard links in fetched archives (reject, skip, allow).`,
+			Value:  `reject`,
+			EnvVar: `HYDRA_ARCHIVE_LINKS`,
+		},
+		cli.StringFlag{
+			Name:   `cache-dir`,
+			Usage:  `The directory where fetched files are cached, shared between applications.`,
+			Value:  hydra.DefaultCacheDirectory,
+			EnvVar: `HYDRA_CACHE_DIR`,
+		},
+		cli.IntFlag{
+			Name:   `cache-size`,
+			Usage:  `The size (in megabytes) the cache is pruned back to after fetching (0 = unbounded).`,
+			Value:  int(hydra.DefaultCacheMaxSize / int64(convutil.Megabyte)),
+			EnvVar: `HYDRA_CACHE_SIZE`,
+		},
+		cli.BoolFlag{
+			Name:   `no-cache`,
+			Usage:  `Always download files instead of using (and populating) the cache.`,
+			EnvVar: `HYDRA_NO_CACHE`,
+		},
+		cli.StringFlag{
+			Name:   `state-dir`,
+			Usage:  `The directory where copies of remotely-loaded applications are kept, to run when offline (empty to disable).`,
+			Value:  hydra.StateDirectory,
+			EnvVar: `HYDRA_STATE_DIR`,
+		},
+		cli.StringSliceFlag{
+			Name:   `overlay`,
+			Usage:  `A file or URL to merge over the loaded application, after any {HYDRA_ENV}.app.yaml and {HYDRA_ID}.app.yaml beside it (may be given more than once).`,
+			EnvVar: `HYDRA_OVERLAYS`,
+		},
+		cli.DurationFlag{
+			Name:   `update-interval, u`,
+			Usage:  `Check the application for changes this often, deploying each new version into the output directory as it appears (0 = never).`,
+			EnvVar: `HYDRA_UPDATE_INTERVAL`,
+		},
+		cli.DurationFlag{
+			Name:   `health-window`,
+			Usage:  `Roll back to the previous version if a newly deployed one exits within this long.`,
+			Value:  hydra.DefaultUpdateHealthWindow,
+			EnvVar: `HYDRA_HEALTH_WINDOW`,
+		},
+		cli.StringFlag{
+			Name:   `checkin-url`,
+			Usage:  `A server to check in with (when updating) that decides which application to run and sends commands.`,
+			EnvVar: `HYDRA_CHECKIN_URL`,
+		},
+		cli.BoolFlag{
+			Name:   `supervise, S`,
+			Usage:  `Restart the application whenever it exits, reverting to the last known-good build if it keeps crashing.`,
+			EnvVar: `HYDRA_SUPERVISE`,
+		},
+		cli.DurationFlag{
+			Name:   `crash-window`,
+			Usage:  `The period over which a supervised application's crashes are counted.`,
+			Value:  hydra.DefaultCrashWindow,
+			EnvVar: `HYDRA_CRASH_WINDOW`,
+		},
+		cli.IntFlag{
+			Name:   `max-crashes`,
+			Usage:  `How many crashes within the crash window cause a supervised application to be reverted.`,
+			Value:  hydra.DefaultMaxCrashes,
+			EnvVar: `HYDRA_MAX_CRASHES`,
+		},
+		cli.StringFlag{
+			Name:   `http-config`,
+			Usage:  `A YAML file of HTTP options (see hydra.HTTPOptions), including per-host overrides.`,
+			EnvVar: `HYDRA_HTTP_CONFIG`,
+		},
+		cli.DurationFlag{
+			Name:   `http-timeout`,
+			Usage:  `How long an HTTP request may take, including reading the response (default 10s).`,
+			EnvVar: `HYDRA_HTTP_TIMEOUT`,
+		},
+		cli.StringFlag{
+			Name:   `http-token`,
+			Usage:  `A bearer token to send with HTTP requests to HYDRA_HOST (other hosts take theirs from --http-config).`,
+			EnvVar: `HYDRA_HTTP_TOKEN`,
+		},
+		cli.StringFlag{
+			Name:   `http-username`,
+			Usage:  `A username to send with HTTP requests to HYDRA_HOST (using basic authentication).`,
+			EnvVar: `HYDRA_HTTP_USERNAME`,
+		},
+		cli.StringFlag{
+			Name:   `http-password`,
+			Usage:  `The password to send along with --http-username.`,
+			EnvVar: `HYDRA_HTTP_PASSWORD`,
+		},
+		cli.StringSliceFlag{
+			Name:   `http-header, H`,
+			Usage:  `A header ("Name: value") to send with HTTP requests; may be given multiple times.`,
+			EnvVar: `HYDRA_HTTP_HEADERS`,
+		},
+		cli.StringSliceFlag{
+			Name:   `http-ca`,
+			Usage:  `A PEM file of CA certificates to trust (in addition to the system's); may be given multiple times.`,
+			EnvVar: `HYDRA_HTTP_CA`,
+		},
+		cli.StringFlag{
+			Name:   `http-cert`,
+			Usage:  `A PEM client certificate to present to HTTPS servers.`,
+			EnvVar: `HYDRA_HTTP_CERT`,
+		},
+		cli.StringFlag{
+			Name:   `http-key`,
+			Usage:  `The PEM private key of the --http-cert client certificate.`,
+			EnvVar: `HYDRA_HTTP_KEY`,
+		},
+		cli.BoolFlag{
+			Name:   `http-insecure`,
+			Usage:  `Don't verify the certificates of HTTPS servers.`,
+			EnvVar: `HYDRA_HTTP_INSECURE`,
+		},
+		cli.StringSliceFlag{
+			Name:   `trusted-key, K`,
+			Usage:  `A public key file (or inline key) that application manifests must be signed with; may be given multiple times.`,
+			EnvVar: `HYDRA_TRUSTED_KEYS`,
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
 		log.SetLevelString(c.String(`log-level`))
-		return nil
+		hydra.StateDirectory = c.String(`state-dir`)
+		hydra.Overlays = c.StringSlice(`overlay`)
+
+		if _, err := hydra.ParseTypeCheckMode(c.String(`type-check`)); err != nil {
+			return err
+		}
+
+		if _, err := hydra.ParseLinkPolicy(c.String(`archive-links`)); err != nil {
+			return err
+		}
+
+		if keys, err := hydra.ParsePublicKeys(c.StringSlice(`trusted-key`)...); err == nil {
+			hydra.TrustedKeys = keys
+		} else {
+			return err
+		}
+
+		if options, err := httpOptions(c); err == nil {
+			return hydra.ConfigureHTTP(*options)
+		} else {
+			return err
+		}
 	}
 
 	app.Commands = []cli.Command{
@@ -103,13 +283,65 @@ func main() {
 					Name:  `bundle, b`,
 					Usage: `Generate a compressed application bundle containing the files listed in the manifest.`,
 				},
+				cli.StringFlag{
+					Name:  `bundle-format, f`,
+					Usage: `The archive format of the bundle (one of: ` + strings.Join(hydra.ArchiveFormatNames(), `, `) + `).`,
+					Value: hydra.DefaultBundleFormat,
+				},
+				cli.StringFlag{
+					Name:   `sign, k`,
+					Usage:  `A private key file (or inline key) to sign the manifest with.`,
+					EnvVar: `HYDRA_SIGNING_KEY`,
+				},
+				cli.StringSliceFlag{
+					Name:  `archive, a`,
+					Usage: `Mark files matching the given pattern as archives, to be extracted when they are fetched.`,
+				},
+				cli.StringSliceFlag{
+					Name:  `delta-from, d`,
+					Usage: `A previous manifest (or directory) to generate a delta archive from, so builds of it can be updated without fetching everything.`,
+				},
 			},
 			Action: func(c *cli.Context) {
 				from := sliceutil.OrString(c.Args().First(), `.`)
 
 				if manifest, err := hydra.CreateManifest(from); err == nil {
+					log.FatalIf(manifest.MarkArchives(c.StringSlice(`archive`)...))
+
+					format, ok := hydra.GetArchiveFormat(c.String(`bundle-format`))
+
+					if !ok {
+						log.Fatalf("unsupported bundle format %q", c.String(`bundle-format`))
+					}
+
+					var deltas []*hydra.ManifestDelta
+
+					if bases := c.StringSlice(`delta-from`); len(bases) > 0 {
+						if !c.Bool(`bundle`) {
+							for _, file := range manifest.Files() {
+								if file.Archive {
+									log.Fatalf("deltas cannot be generated for manifests containing archives (%s) unless --bundle is given", file.Name)
+								}
+							}
+						}
+
+						for _, base := range bases {
+							if baseManifest, err := manifestFromPath(base); err == nil {
+								deltaFile := filepath.Join(filepath.Dir(c.String(`output`)), `delta-`+baseManifest.ContentHash()[:12]+format.Extensions()[0])
+
+								if delta, err := hydra.CreateDelta(baseManifest, manifest, deltaFile); err == nil {
+									deltas = append(deltas, delta)
+								} else {
+									log.Fatal(err)
+								}
+							} else {
+								log.Fatal(err)
+							}
+						}
+					}
+
 					if c.Bool(`bundle`) {
-						bundleFile := filepath.Join(filepath.Dir(c.String(`output`)), `app.tar.gz`)
+						bundleFile := filepath.Join(filepath.Dir(c.String(`output`)), `app`+format.Extensions()[0])
 
 						// generate bundle archive
 						log.FatalIf(manifest.Bundle(bundleFile))
@@ -117,22 +349,380 @@ func main() {
 						// replace manifest with a new one containing only the archive we just created
 						bundleManifest := hydra.NewManifest(filepath.Dir(bundleFile))
 						bundleManifest.Append(bundleFile)
-						bundleManifest.Assets[0].ArchiveFileCount = manifest.FileCount
-						bundleManifest.Assets[0].UncompressedSize = manifest.TotalSize
+						bundled := manifest.Bundled()
+						bundleManifest.Assets[0].Archive = true
+						bundleManifest.Assets[0].ArchiveFileCount = bundled.FileCount
+						bundleManifest.Assets[0].UncompressedSize = bundled.TotalSize
 						manifest = bundleManifest
 					}
 
+					manifest.Deltas = deltas
+
+					if keyfile := c.String(`sign`); keyfile != `` {
+						if key, err := hydra.ParsePrivateKey(keyfile); err == nil {
+							log.FatalIf(manifest.Sign(key))
+							log.Infof("signed manifest with key %s", manifest.Signature.KeyID)
+						} else {
+							log.Fatal(err)
+						}
+					}
+
 					log.FatalIf(manifest.WriteFile(c.String(`output`)))
 				} else {
 					log.Fatal(err)
 				}
 			},
+		}, {
+			Name:      `diff`,
+			Usage:     `Show the files added, removed, and changed between two manifests (or directories).`,
+			ArgsUsage: `OLD NEW`,
+			Action: func(c *cli.Context) {
+				if c.NArg() != 2 {
+					log.Fatalf("expected two manifests to compare")
+				}
+
+				from, err := manifestFromPath(c.Args().Get(0))
+				log.FatalIf(err)
+
+				to, err := manifestFromPath(c.Args().Get(1))
+				log.FatalIf(err)
+
+				diff := hydra.DiffManifests(from, to)
+
+				for _, list := range []struct {
+					prefix string
+					files  hydra.ManifestFiles
+				}{
+					{`+`, diff.Added},
+					{`-`, diff.Removed},
+					{`~`, diff.Changed},
+				} {
+					for _, file := range list.files {
+						fmt.Printf("%s %s\n", list.prefix, file.Name)
+					}
+				}
+
+				log.Infof(
+					"%d added (%v), %d removed, %d changed (%v)",
+					len(diff.Added),
+					diff.Added.TotalSize(),
+					len(diff.Removed),
+					len(diff.Changed),
+					diff.Changed.TotalSize(),
+				)
+			},
+		}, {
+			Name:      `keygen`,
+			Usage:     `Generate a key pair for signing application manifests.`,
+			ArgsUsage: `[NAME]`,
+			Action: func(c *cli.Context) {
+				name := sliceutil.OrString(c.Args().First(), `hydra`)
+
+				if pub, priv, err := hydra.GenerateKeyPair(); err == nil {
+					// neither half of an existing pair is replaced, lest the two stop matching
+					for _, filename := range []string{name + `.key`, name + `.pub`} {
+						if fileutil.Exists(filename) {
+							log.Fatalf("refusing to overwrite existing key %s", filename)
+						}
+					}
+
+					log.FatalIf(writeNewFile(name+`.key`, priv, 0600))
+					log.FatalIf(writeNewFile(name+`.pub`, pub, 0644))
+					log.Infof("wrote private key %s.key and public key %s.pub", name, name)
+				} else {
+					log.Fatal(err)
+				}
+			},
+		}, {
+			Name:  `cache`,
+			Usage: `Inspect and maintain the cache of fetched files.`,
+			Subcommands: []cli.Command{
+				{
+					Name:  `list`,
+					Usage: `List the files in the cache, least recently used first.`,
+					Action: func(c *cli.Context) {
+						cache := cacheFromContext(c)
+
+						if entries, err := cache.Entries(); err == nil {
+							var total convutil.Bytes
+
+							for _, entry := range entries {
+								fmt.Printf("%s  %10v  %s\n", entry.SHA256, convutil.Bytes(entry.Size), entry.LastUsed.Format(time.RFC3339))
+								total += convutil.Bytes(entry.Size)
+							}
+
+							log.Infof("%d file(s), %v in %s", len(entries), total, cache.Root)
+						} else {
+							log.Fatal(err)
+						}
+					},
+				}, {
+					Name:  `verify`,
+					Usage: `Checksum every file in the cache, removing any that are corrupt.`,
+					Action: func(c *cli.Context) {
+						if corrupt, err := cacheFromContext(c).Verify(); err == nil {
+							for _, entry := range corrupt {
+								fmt.Printf("removed corrupt entry %s\n", entry.SHA256)
+							}
+
+							log.Infof("%d corrupt file(s) removed", len(corrupt))
+						} else {
+							log.Fatal(err)
+						}
+					},
+				}, {
+					Name:  `prune`,
+					Usage: `Remove the least recently used files until the cache is within the configured size.`,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  `all, a`,
+							Usage: `Remove every file in the cache.`,
+						},
+					},
+					Action: func(c *cli.Context) {
+						cache := cacheFromContext(c)
+						maxSize := cache.MaxSize
+
+						if c.Bool(`all`) {
+							maxSize = 0
+						}
+
+						if removed, err := cache.Prune(maxSize); err == nil {
+							var total convutil.Bytes
+
+							for _, entry := range removed {
+								total += convutil.Bytes(entry.Size)
+							}
+
+							log.Infof("%d file(s) removed, %v freed", len(removed), total)
+						} else {
+							log.Fatal(err)
+						}
+					},
+				},
+			},
+		}, {
+			Name:  `config`,
+			Usage: `Inspect the configuration an application is loaded with.`,
+			Subcommands: []cli.Command{
+				{
+					Name:      `show`,
+					Usage:     `List the files an application is loaded from, base first, in the order they are merged.`,
+					ArgsUsage: `[APPFILE]`,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  `resolved, r`,
+							Usage: `Print the application as it is after merging every overlay instead.`,
+						},
+					},
+					Action: func(c *cli.Context) {
+						if app, err := hydra.Load(c.Args().First()); err == nil {
+							if c.Bool(`resolved`) {
+								os.Stdout.Write(app.Resolved())
+							} else {
+								for _, layer := range app.Layers() {
+									fmt.Println(layer)
+								}
+							}
+						} else {
+							log.Fatal(err)
+						}
+					},
+				},
+			},
+		}, {
+			Name:      `validate`,
+			Usage:     `Check application and module files for errors without generating anything.`,
+			ArgsUsage: `[FILE|DIR ...]`,
+			Action: func(c *cli.Context) {
+				var files []string
+				var problems int
+				var args = []string(c.Args())
+
+				if len(args) == 0 {
+					args = []string{hydra.EntrypointFilename}
+				}
+
+				for _, arg := range args {
+					if fileutil.DirExists(arg) {
+						log.FatalIf(filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+							if err == nil {
+								switch filepath.Base(path) {
+								case hydra.ManifestFilename, hydra.ModuleSpecFilename:
+									return nil
+								}
+
+								if !info.IsDir() && hydra.IsDocumentFile(path) {
+									files = append(files, path)
+								}
+							}
+
+							return err
+						}))
+					} else {
+						files = append(files, arg)
+					}
+				}
+
+				for _, file := range files {
+					if err := hydra.ValidateFile(file); err != nil {
+						if diags, ok := err.(hydra.Diagnostics); ok {
+							for _, diag := range diags {
+								fmt.Println(diag.String())
+							}
+
+							problems += len(diags)
+						} else {
+							log.Fatal(err)
+						}
+					}
+				}
+
+				if problems > 0 {
+					log.Fatalf("%d problem(s) found in %d file(s)", problems, len(files))
+				} else {
+					log.Infof("%d file(s) OK", len(files))
+				}
+			},
+		}, {
+			Name:      `import`,
+			Usage:     `Convert existing QML files into modules, writing each one beside it as YAML.`,
+			ArgsUsage: `QMLFILE|DIR ...`,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  `output, o`,
+					Usage: `The directory to write the YAML to instead (keeping the layout of any directories given), or "-" to print it.`,
+				},
+				cli.BoolFlag{
+					Name:  `force, f`,
+					Usage: `Overwrite YAML files that already exist.`,
+				},
+				cli.BoolFlag{
+					Name:  `partial, p`,
+					Usage: `Write out files even if parts of them couldn't be converted (those parts are left out).`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				var files = make(map[string]string)
+				var problems int
+				var written int
+				var outdir = c.String(`output`)
+
+				if c.NArg() == 0 {
+					log.Fatalf("expected one or more QML files or directories to import")
+				}
+
+				for _, arg := range c.Args() {
+					if fileutil.DirExists(arg) {
+						log.FatalIf(filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+							if err == nil && !info.IsDir() && strings.ToLower(filepath.Ext(path)) == `.qml` {
+								if rel, err := filepath.Rel(arg, path); err == nil {
+									files[path] = rel
+								} else {
+									return err
+								}
+							}
+
+							return err
+						}))
+					} else {
+						files[arg] = filepath.Base(arg)
+					}
+				}
+
+				for _, file := range maputil.StringKeys(files) {
+					module, err := hydra.ImportQML(file)
+
+					if diags, ok := err.(hydra.Diagnostics); ok {
+						for _, diag := range diags {
+							fmt.Println(diag.String())
+						}
+
+						problems += len(diags)
+
+						if module == nil || !c.Bool(`partial`) {
+							continue
+						}
+					} else if err != nil {
+						log.Fatal(err)
+					}
+
+					data, err := yaml.Marshal(module)
+					log.FatalIf(err)
+
+					if outdir == `-` {
+						if len(files) > 1 {
+							fmt.Printf("---\n# %s\n", file)
+						}
+
+						os.Stdout.Write(data)
+						continue
+					}
+
+					var yamlfile = fileutil.SetExt(file, `.yaml`)
+
+					if outdir != `` {
+						yamlfile = filepath.Join(outdir, fileutil.SetExt(files[file], `.yaml`))
+					}
+
+					if fileutil.Exists(yamlfile) && !c.Bool(`force`) {
+						log.Errorf("refusing to overwrite existing file %s (use --force)", yamlfile)
+						problems += 1
+						continue
+					}
+
+					log.FatalIf(os.MkdirAll(filepath.Dir(yamlfile), 0755))
+					log.FatalIf(ioutil.WriteFile(yamlfile, data, 0644))
+					log.Debugf("imported %s to %s", file, yamlfile)
+					written += 1
+				}
+
+				if problems > 0 {
+					log.Fatalf("%d problem(s) found importing %d file(s)", problems, len(files))
+				} else if outdir != `-` {
+					log.Infof("%d file(s) imported", written)
+				}
+			},
+		}, {
+			Name:      `watch`,
+			Usage:     `Generate the application, then regenerate (and reload) it whenever its source files change.`,
+			ArgsUsage: `[APPFILE]`,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  `debounce, d`,
+					Usage: `How long to wait for further changes before regenerating.`,
+					Value: hydra.DefaultWatchDebounce,
+				},
+			},
+			Action: func(c *cli.Context) {
+				log.FatalIf(hydra.Watch(sliceutil.OrString(c.Args().First(), hydra.EntrypointFilename), hydra.WatchOptions{
+					GenerateOptions: generateOptions(c),
+					SourceLocation:  c.GlobalString(`location`),
+					Debounce:        c.Duration(`debounce`),
+					Run:             c.GlobalBool(`run`),
+					RunOptions:      runOptions(c),
+				}))
+			},
 		},
 	}
 
 	app.Action = func(c *cli.Context) {
 		appcfg := c.Args().First()
 
+		if interval := c.Duration(`update-interval`); interval > 0 {
+			log.FatalIf(hydra.Update(appcfg, hydra.UpdateOptions{
+				GenerateOptions: generateOptions(c),
+				SourceLocation:  c.String(`location`),
+				Interval:        interval,
+				HealthWindow:    c.Duration(`health-window`),
+				CheckinURL:      c.String(`checkin-url`),
+				Run:             c.Bool(`run`),
+				RunOptions:      runOptions(c),
+			}))
+
+			return
+		}
+
 		if app, err := hydra.Load(appcfg); err == nil {
 			if srcloc := c.String(`location`); srcloc != `` {
 				app.SourceLocation = srcloc
@@ -140,21 +730,10 @@ func main() {
 
 			log.Debugf("Loaded app: location=%v", app.SourceLocation)
 
-			log.FatalIf(app.Generate(hydra.GenerateOptions{
-				DestDir:   c.String(`output-dir`),
-				Autobuild: c.Bool(`autobuild`),
-			}))
+			log.FatalIf(app.Generate(generateOptions(c)))
 
 			if c.Bool(`run`) {
-				log.FatalIf(hydra.RunWithOptions(c.String(`output-dir`), hydra.RunOptions{
-					QmlsceneBin:           c.String(`qml-runner`),
-					QmlsceneArgs:          argsAfter(c, `--`),
-					WaitForNetworkTimeout: c.Duration(`wait-for-network-timeout`),
-					WaitForNetworkAddress: c.String(`wait-for-network-address`),
-					ServeAddress:          c.String(`address`),
-					ServeRoot:             c.String(`server-root`),
-					ContainmentStrategy:   hydra.RunContainmentFromString(c.String(`containment-strategy`)),
-				}))
+				log.FatalIf(hydra.RunWithOptions(c.String(`output-dir`), runOptions(c)))
 			}
 		} else {
 			log.Fatal(err)
@@ -164,6 +743,131 @@ func main() {
 	app.Run(os.Args)
 }
 
+func generateOptions(c *cli.Context) hydra.GenerateOptions {
+	return hydra.GenerateOptions{
+		DestDir:     c.GlobalString(`output-dir`),
+		Autobuild:   c.GlobalBool(`autobuild`),
+		TypeCheck:   hydra.TypeCheckModeFromString(c.GlobalString(`type-check`)),
+		TypeFiles:   c.GlobalStringSlice(`qmltypes`),
+		Incremental: c.GlobalBool(`incremental`),
+		Fetch: hydra.FetchOptions{
+			Concurrency:  c.GlobalInt(`fetch-concurrency`),
+			OnProgress:   logFetchProgress(),
+			Cache:        fetchCache(c),
+			ArchiveLinks: hydra.LinkPolicyFromString(c.GlobalString(`archive-links`)),
+		}.WithRetries(c.GlobalInt(`fetch-retries`)),
+	}
+}
+
+// writes data to a file that must not already exist.
+func writeNewFile(filename string, data []byte, perm os.FileMode) error {
+	if file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm); err == nil {
+		defer file.Close()
+
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+
+		return file.Close()
+	} else {
+		return err
+	}
+}
+
+// loads the manifest in the given file, or generates one from the given directory.
+func manifestFromPath(path string) (*hydra.Manifest, error) {
+	if fileutil.DirExists(path) {
+		return hydra.CreateManifest(path)
+	} else {
+		return hydra.LoadManifest(path)
+	}
+}
+
+func cacheFromContext(c *cli.Context) *hydra.Cache {
+	if cache, err := hydra.NewCache(
+		c.GlobalString(`cache-dir`),
+		int64(c.GlobalInt(`cache-size`))*int64(convutil.Megabyte),
+	); err == nil {
+		return cache
+	} else {
+		log.Fatal(err)
+		return nil
+	}
+}
+
+// returns the cache to fetch files through, or nil if caching is disabled.
+func fetchCache(c *cli.Context) *hydra.Cache {
+	if c.GlobalBool(`no-cache`) || c.GlobalString(`cache-dir`) == `` {
+		return nil
+	}
+
+	return cacheFromContext(c)
+}
+
+// logs fetch progress at most once per second, and once more when complete.
+func logFetchProgress() hydra.ProgressFunc {
+	var last time.Time
+
+	return func(progress hydra.FetchProgress) {
+		if progress.Done() || time.Since(last) >= time.Second {
+			last = time.Now()
+			log.Infof("fetch: %v", progress)
+		}
+	}
+}
+
+func runOptions(c *cli.Context) hydra.RunOptions {
+	return hydra.RunOptions{
+		QmlsceneBin:           c.GlobalString(`qml-runner`),
+		QmlsceneArgs:          argsAfter(c, `--`),
+		WaitForNetworkTimeout: c.GlobalDuration(`wait-for-network-timeout`),
+		WaitForNetworkAddress: c.GlobalString(`wait-for-network-address`),
+		ServeAddress:          c.GlobalString(`address`),
+		ServeRoot:             c.GlobalString(`server-root`),
+		ContainmentStrategy:   hydra.RunContainmentFromString(c.GlobalString(`containment-strategy`)),
+		Supervise:             c.GlobalBool(`supervise`),
+		CrashWindow:           c.GlobalDuration(`crash-window`),
+		MaxCrashes:            c.GlobalInt(`max-crashes`),
+	}
+}
+
+// returns the HTTP options given in the --http-config file (if any), overridden by the other
+// --http-* flags.
+func httpOptions(c *cli.Context) (*hydra.HTTPOptions, error) {
+	var options = new(hydra.HTTPOptions)
+
+	if filename := c.GlobalString(`http-config`); filename != `` {
+		if loaded, err := hydra.LoadHTTPOptions(filename); err == nil {
+			options = loaded
+		} else {
+			return nil, err
+		}
+	}
+
+	var flags = hydra.HTTPOptions{
+		Timeout:            c.GlobalDuration(`http-timeout`),
+		BearerToken:        c.GlobalString(`http-token`),
+		Username:           c.GlobalString(`http-username`),
+		Password:           c.GlobalString(`http-password`),
+		CAFiles:            c.GlobalStringSlice(`http-ca`),
+		ClientCert:         c.GlobalString(`http-cert`),
+		ClientKey:          c.GlobalString(`http-key`),
+		InsecureSkipVerify: c.GlobalBool(`http-insecure`),
+		Headers:            make(map[string]string),
+	}
+
+	for _, header := range c.GlobalStringSlice(`http-header`) {
+		if name, value := stringutil.SplitPair(header, `:`); strings.Contains(header, `:`) && strings.TrimSpace(name) != `` {
+			flags.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		} else {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+	}
+
+	merged := options.Merge(flags)
+	return &merged, nil
+}
+
 func argsAfter(c *cli.Context, delim string) (out []string) {
 	var doing bool
 
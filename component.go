@@ -3,9 +3,13 @@ package hydra
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/ghetzel/go-stockutil/typeutil"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 const Indent = `  `
@@ -18,18 +22,28 @@ type Layout struct {
 }
 
 type Component struct {
-	Type       string                 `yaml:"type,omitempty"       json:"type,omitempty"`
-	ID         string                 `yaml:"id,omitempty"         json:"id,omitempty"`
-	Public     Properties             `yaml:"public,omitempty"     json:"public,omitempty"`
-	Properties map[string]interface{} `yaml:"properties,omitempty" json:"properties,omitempty"`
-	Behaviors  []Behavior             `yaml:"behaviors,omitempty"  json:"behaviors,omitempty"`
-	Functions  []Function             `yaml:"functions,omitempty"  json:"functions,omitempty"`
-	Components []*Component           `yaml:"components,omitempty" json:"components,omitempty"`
-	Layout     *Layout                `yaml:"layout,omitempty"     json:"layout,omitempty"`
-	Fill       interface{}            `yaml:"fill,omitempty"       json:"fill,omitempty"`
-	Flex       int                    `yaml:"flex"                 json:"flex"`
-	Signals    []*Signal              `yaml:"signals,omitempty"    json:"signals,omitempty"`
-	private    Properties
+	Type         string                  `yaml:"type,omitempty"       json:"type,omitempty"`
+	ID           string                  `yaml:"id,omitempty"         json:"id,omitempty"`
+	Public       Properties              `yaml:"public,omitempty"     json:"public,omitempty"`
+	Properties   map[string]interface{}  `yaml:"properties,omitempty" json:"properties,omitempty"`
+	Behaviors    []Behavior              `yaml:"behaviors,omitempty"  json:"behaviors,omitempty"`
+	Functions    []Function              `yaml:"functions,omitempty"  json:"functions,omitempty"`
+	Components   []*Component            `yaml:"components,omitempty" json:"components,omitempty"`
+	Layout       *Layout                 `yaml:"layout,omitempty"     json:"layout,omitempty"`
+	Fill         interface{}             `yaml:"fill,omitempty"       json:"fill,omitempty"`
+	Flex         int                     `yaml:"flex"                 json:"flex"`
+	Signals      []*Signal               `yaml:"signals,omitempty"    json:"signals,omitempty"`
+	Use          string                  `yaml:"use,omitempty"        json:"use,omitempty"`   // the ComponentTemplate this component expands into
+	With         map[string]interface{}  `yaml:"with,omitempty"       json:"with,omitempty"`  // parameters for the template
+	Slots        map[string][]*Component `yaml:"slots,omitempty"      json:"slots,omitempty"` // components for the template's named slots
+	Slot         string                  `yaml:"slot,omitempty"       json:"slot,omitempty"`  // in a template, marks a placeholder for the named slot
+	private      Properties
+	propOrder    []string
+	origin       *SourcePosition
+	layoutOrigin *SourcePosition
+	propOrigins  map[string]*SourcePosition
+	propSources  map[string]yaml.MapSlice // properties set to objects, as declared (for inline components)
+	template     string
 }
 
 func NewComponent(ctype string) *Component {
@@ -38,6 +52,94 @@ func NewComponent(ctype string) *Component {
 	}
 }
 
+// Decodes a component from YAML, retaining the order in which properties were declared
+// so that the generated QML is stable from one run to the next.
+func (self *Component) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawComponent Component
+
+	var raw rawComponent
+	var ordered yaml.MapSlice
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	if err := unmarshal(&ordered); err != nil {
+		return err
+	}
+
+	*self = Component(raw)
+	self.propOrder = nil
+	self.propSources = nil
+
+	for _, item := range ordered {
+		if fmt.Sprintf("%v", item.Key) != `properties` {
+			continue
+		}
+
+		if props, ok := item.Value.(yaml.MapSlice); ok {
+			for _, prop := range props {
+				name := fmt.Sprintf("%v", prop.Key)
+				self.propOrder = append(self.propOrder, name)
+
+				if value, ok := prop.Value.(yaml.MapSlice); ok {
+					if self.propSources == nil {
+						self.propSources = make(map[string]yaml.MapSlice)
+					}
+
+					self.propSources[name] = value
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Encodes a component as YAML, writing its properties in the order they would be emitted as
+// QML and leaving out anything that isn't set.
+func (self *Component) MarshalYAML() (interface{}, error) {
+	var out yaml.MapSlice
+
+	add := func(key string, value interface{}, set bool) {
+		if set {
+			out = append(out, yaml.MapItem{Key: key, Value: value})
+		}
+	}
+
+	add(`type`, self.Type, self.Type != ``)
+	add(`id`, self.ID, self.ID != ``)
+	add(`use`, self.Use, self.Use != ``)
+	add(`with`, self.With, len(self.With) > 0)
+	add(`slot`, self.Slot, self.Slot != ``)
+	add(`layout`, self.Layout, self.Layout != nil)
+	add(`fill`, self.Fill, self.Fill != nil)
+	add(`flex`, self.Flex, self.Flex != 0)
+	add(`public`, self.Public, len(self.Public) > 0)
+	add(`signals`, self.Signals, len(self.Signals) > 0)
+
+	if len(self.Properties) > 0 {
+		var properties yaml.MapSlice
+
+		for _, name := range self.PropertyNames() {
+			if source, ok := self.propSources[name]; ok {
+				properties = append(properties, yaml.MapItem{Key: name, Value: source})
+			} else {
+				properties = append(properties, yaml.MapItem{Key: name, Value: self.Properties[name]})
+			}
+		}
+
+		add(`properties`, properties, true)
+	}
+
+	add(`functions`, self.Functions, len(self.Functions) > 0)
+	add(`behaviors`, self.Behaviors, len(self.Behaviors) > 0)
+	add(`components`, self.Components, len(self.Components) > 0)
+	add(`slots`, self.Slots, len(self.Slots) > 0)
+
+	return out, nil
+}
+
 func (self *Component) Validate() error {
 	if self.Type == `` {
 		return fmt.Errorf("Component must specify a type.")
@@ -46,6 +148,94 @@ func (self *Component) Validate() error {
 	return nil
 }
 
+// Records the position of this component (and everything declared within it) in the YAML file
+// it was loaded from, which is used to generate a source map alongside the QML.
+func (self *Component) annotate(filename string, node *yamlv3.Node) {
+	if node == nil {
+		return
+	} else if self.template != `` {
+		self.annotateExpansion(positionOf(filename, node))
+		return
+	}
+
+	self.origin = positionOf(filename, node)
+	self.layoutOrigin = nil
+	self.propOrigins = make(map[string]*SourcePosition)
+
+	for _, key := range []string{`flex`, `fill`, `layout`} {
+		if pos := positionOf(filename, mapKey(node, key)); pos != nil {
+			self.layoutOrigin = pos
+		}
+	}
+
+	if pos := positionOf(filename, mapKey(node, `id`)); pos != nil {
+		self.propOrigins[`id`] = pos
+	}
+
+	if props := mapValue(node, `properties`); props != nil && props.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(props.Content); i += 2 {
+			self.propOrigins[props.Content[i].Value] = positionOf(filename, props.Content[i])
+		}
+	}
+
+	for i, prop := range self.Public {
+		if prop != nil {
+			prop.origin = positionOf(filename, seqItem(mapValue(node, `public`), i, nil))
+		}
+	}
+
+	for i, sig := range self.Signals {
+		if sig != nil {
+			sig.origin = positionOf(filename, seqItem(mapValue(node, `signals`), i, nil))
+		}
+	}
+
+	for i := range self.Functions {
+		self.Functions[i].origin = positionOf(filename, seqItem(mapValue(node, `functions`), i, nil))
+	}
+
+	for i := range self.Behaviors {
+		bNode := seqItem(mapValue(node, `behaviors`), i, nil)
+		self.Behaviors[i].origin = positionOf(filename, bNode)
+
+		if animation := self.Behaviors[i].Animation; animation != nil {
+			animation.annotate(filename, mapValue(bNode, `animation`))
+		}
+	}
+
+	for i, child := range self.Components {
+		if child != nil {
+			child.annotate(filename, seqItem(mapValue(node, `components`), i, nil))
+		}
+	}
+}
+
+// attributes a component expanded from a template (and everything in it) to the place the
+// template was used, since that is what its YAML source looks like.
+func (self *Component) annotateExpansion(pos *SourcePosition) {
+	self.origin = pos
+	self.layoutOrigin = nil
+	self.propOrigins = make(map[string]*SourcePosition)
+
+	for _, child := range self.Components {
+		if child != nil {
+			child.annotateExpansion(pos)
+		}
+	}
+}
+
+// returns the position in the YAML source that the named property came from: either where it
+// was declared, or (for properties generated from layout directives) where the layout was.
+func (self *Component) propertyOrigin(name string) *SourcePosition {
+	if pos, ok := self.propOrigins[name]; ok && pos != nil {
+		return pos
+	} else if self.layoutOrigin != nil {
+		return self.layoutOrigin
+	} else {
+		return self.origin
+	}
+}
+
 func (self *Component) String() string {
 	if data, err := self.QML(0, self); err == nil {
 		return string(data)
@@ -59,9 +249,65 @@ func (self *Component) Set(key string, value interface{}) {
 		self.Properties = make(map[string]interface{})
 	}
 
+	if _, ok := self.Properties[key]; !ok {
+		self.propOrder = append(self.propOrder, key)
+	}
+
+	delete(self.propSources, key)
+
+	// ordered values are kept as they are for inline components, but stored like any other
+	if ordered, ok := value.(yaml.MapSlice); ok {
+		if self.propSources == nil {
+			self.propSources = make(map[string]yaml.MapSlice)
+		}
+
+		self.propSources[key] = ordered
+		value = unorderedYAML(ordered)
+	}
+
 	self.Properties[key] = value
 }
 
+// Returns the names of all properties in the order they should be emitted: the id first,
+// then property bindings, then signal handlers (on*), then attached properties (e.g.:
+// Component.onCompleted).  Within each group, properties appear in the order they were
+// declared, with any remaining properties following in lexical order.
+func (self *Component) PropertyNames() []string {
+	var names = make([]string, 0, len(self.Properties))
+	var position = make(map[string]int)
+
+	for i, name := range self.propOrder {
+		if _, ok := position[name]; !ok {
+			position[name] = i
+		}
+	}
+
+	for name := range self.Properties {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	sort.SliceStable(names, func(i int, j int) bool {
+		ri, rj := propertyRank(names[i]), propertyRank(names[j])
+
+		if ri != rj {
+			return ri < rj
+		}
+
+		pi, iok := position[names[i]]
+		pj, jok := position[names[j]]
+
+		if iok && jok {
+			return pi < pj
+		} else {
+			return iok && !jok
+		}
+	})
+
+	return names
+}
+
 func (self *Component) HasContent() bool {
 	if len(self.Public) > 0 {
 		return true
@@ -75,6 +321,16 @@ func (self *Component) HasContent() bool {
 }
 
 func (self *Component) QML(depth int, parent ...*Component) ([]byte, error) {
+	if data, err := self.qml(depth, parent...); err == nil {
+		data, _ = stripSourceMarkers(data)
+		return data, nil
+	} else {
+		return nil, err
+	}
+}
+
+// generates the QML for this component, retaining any source markers.
+func (self *Component) qml(depth int, parent ...*Component) ([]byte, error) {
 	if err := self.Validate(); err == nil {
 		var out bytes.Buffer
 
@@ -89,9 +345,14 @@ func (self *Component) QML(depth int, parent ...*Component) ([]byte, error) {
 		}
 
 		if self.HasContent() {
-			out.WriteString(self.Type + " {\n")
+			out.WriteString(self.Type + " {" + self.origin.marker() + "\n")
 		} else {
-			out.WriteString(self.Type + `{`)
+			out.WriteString(self.Type + `{` + self.origin.marker())
+		}
+
+		// the id always comes first, ahead of any declarations
+		if err := self.writeID(&out); err != nil {
+			return nil, err
 		}
 
 		// write signal declarations
@@ -121,7 +382,7 @@ func (self *Component) QML(depth int, parent ...*Component) ([]byte, error) {
 
 		// write out subcomponents (recursive)
 		for _, child := range self.Components {
-			if data, err := child.QML(depth+1, self); err == nil {
+			if data, err := child.qml(depth+1, self); err == nil {
 				for _, line := range lines(data) {
 					out.WriteString(Indent + line + "\n")
 				}
@@ -206,38 +467,57 @@ func (self *Component) writePublicProperties(buf *bytes.Buffer) error {
 	}
 
 	// write out public properties
-	if data, err := self.Public.QML(); err == nil {
-		self.writeIndented(buf, data)
-		return nil
-	} else {
-		return err
+	return self.writeProperties(buf, self.Public)
+}
+
+func (self *Component) writeID(buf *bytes.Buffer) error {
+	if id, ok := self.Properties[`id`]; ok {
+		return self.writeProperties(buf, Properties{{
+			Name:   `id`,
+			Value:  id,
+			origin: self.propertyOrigin(`id`),
+		}})
 	}
+
+	return nil
 }
 
 func (self *Component) writePrivateProperties(buf *bytes.Buffer) error {
 	self.private = nil
 
-	for k, v := range self.Properties {
+	for _, k := range self.PropertyNames() {
+		if k == `id` {
+			continue
+		}
+
 		self.private = append(self.private, &Property{
-			Name:  k,
-			Value: v,
+			Name:   k,
+			Value:  self.Properties[k],
+			origin: self.propertyOrigin(k),
+			source: self.propSources[k],
 		})
 	}
 
 	// write out private properties
-	if data, err := self.private.QML(); err == nil {
-		self.writeIndented(buf, data)
-		return nil
-	} else {
-		return err
+	return self.writeProperties(buf, self.private)
+}
+
+func (self *Component) writeProperties(buf *bytes.Buffer, properties Properties) error {
+	for _, property := range properties {
+		if data, err := property.QML(); err == nil {
+			self.writeIndented(buf, withSourceMarker(data, property.origin))
+		} else {
+			return fmt.Errorf("property %s: %v", property.Name, err)
+		}
 	}
 
+	return nil
 }
 
 func (self *Component) writeSignals(buf *bytes.Buffer) error {
 	for _, sig := range self.Signals {
 		if data, err := sig.QML(); err == nil {
-			self.writeIndented(buf, data)
+			self.writeIndented(buf, withSourceMarker(data, sig.origin))
 		} else {
 			return err
 		}
@@ -249,7 +529,7 @@ func (self *Component) writeSignals(buf *bytes.Buffer) error {
 func (self *Component) writeFunctions(buf *bytes.Buffer) error {
 	for _, fn := range self.Functions {
 		if data, err := fn.QML(); err == nil {
-			self.writeIndented(buf, data)
+			self.writeIndented(buf, withSourceMarker(data, fn.origin))
 		} else {
 			return err
 		}
@@ -261,7 +541,7 @@ func (self *Component) writeFunctions(buf *bytes.Buffer) error {
 func (self *Component) writeBehaviors(buf *bytes.Buffer) error {
 	for _, b := range self.Behaviors {
 		if data, err := b.QML(); err == nil {
-			self.writeIndented(buf, data)
+			self.writeIndented(buf, withSourceMarker(data, b.origin))
 		} else {
 			return err
 		}
@@ -275,3 +555,32 @@ func (self *Component) writeIndented(buf *bytes.Buffer, data []byte) {
 		buf.WriteString(Indent + line + "\n")
 	}
 }
+
+// determines which group a property belongs to for the purpose of ordering output.
+func propertyRank(name string) int {
+	if name == `id` {
+		return 0
+	} else if first, _ := splitPropertyName(name); first != `` && unicode.IsUpper(rune(first[0])) && strings.Contains(name, `.`) {
+		return 3
+	} else if isSignalHandler(name) {
+		return 2
+	} else {
+		return 1
+	}
+}
+
+func splitPropertyName(name string) (string, string) {
+	if parts := strings.SplitN(name, `.`, 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	} else {
+		return name, ``
+	}
+}
+
+func isSignalHandler(name string) bool {
+	if len(name) > 2 && strings.HasPrefix(name, `on`) {
+		return unicode.IsUpper(rune(name[2]))
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package hydra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestComponentPropertyOrder(t *testing.T) {
+	assert := require.New(t)
+
+	app := new(Application)
+
+	assert.NoError(FromReader(app, bytes.NewBufferString(`
+definition:
+  type: Rectangle
+  id: toggle
+  signals:
+  - name: toggled
+    args:
+    - name: checked
+      type: bool
+  public:
+  - name: checked
+    type: bool
+    value: false
+  properties:
+    Component.onCompleted: '{ flip() }'
+    onClicked: '{ flip() }'
+    width: 10
+    color: red
+`)))
+
+	assert.Equal([]string{
+		`width`,
+		`color`,
+		`onClicked`,
+		`Component.onCompleted`,
+	}, app.Definition.PropertyNames())
+
+	qml, err := app.Definition.QML(0)
+	assert.NoError(err)
+
+	var lines []string
+
+	for _, line := range strings.Split(string(qml), "\n")[1:] {
+		if line = strings.TrimSpace(line); line != `` && line != `}` {
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal([]string{
+		`id: toggle`,
+		`signal toggled(bool checked)`,
+		`property bool checked: false`,
+		`width: 10`,
+		`color: "red"`,
+		`onClicked: flip()`,
+		`Component.onCompleted: flip()`,
+	}, lines)
+}
+
+func TestInlineComponentPropertyOrder(t *testing.T) {
+	assert := require.New(t)
+
+	app := new(Application)
+
+	assert.NoError(FromReader(app, bytes.NewBufferString(`
+definition:
+  type: ListView
+  public:
+  - name: highlight
+    type: Component
+    value:
+      _inline: true
+      type: Rectangle
+      properties:
+        width: 10
+        color: red
+        opacity: 0.5
+  properties:
+    delegate:
+      type: Text
+      properties:
+        width: 200
+        text: '{ modelData }'
+        color: blue
+`)))
+
+	qml, err := app.Definition.QML(0)
+	assert.NoError(err)
+
+	var lines []string
+
+	for _, line := range strings.Split(string(qml), "\n")[1:] {
+		if line = strings.TrimSpace(line); line != `` && line != `}` {
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal([]string{
+		`property Component highlight: Rectangle {`,
+		`width: 10`,
+		`color: "red"`,
+		`opacity: 0.5`,
+		`delegate: Text {`,
+		`width: 200`,
+		`text: modelData`,
+		`color: "blue"`,
+	}, lines)
+}
@@ -0,0 +1,381 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"gopkg.in/yaml.v2"
+)
+
+// The extensions of files in YAML, the format applications and modules are parsed from.
+var YAMLExtensions = []string{`.yaml`, `.yml`}
+
+// A Decoder lets applications and modules be written in a format other than YAML, by converting
+// them into YAML before they are parsed.  Decoders are identified by name, and detected from
+// filenames by extension and from retrieved documents by MIME type.
+type Decoder interface {
+	Name() string
+	Extensions() []string
+	MIMETypes() []string
+	Decode(filename string, data []byte) ([]byte, error)
+}
+
+var decoders []Decoder
+
+// Makes a decoder available for loading applications and modules.  Decoders registered later
+// take precedence over earlier ones with the same name, extension or MIME type.
+func RegisterDecoder(decoder Decoder) {
+	decoders = append(decoders, decoder)
+}
+
+// Returns the names of all registered decoders, sorted.
+func DecoderNames() (names []string) {
+	for _, decoder := range decoders {
+		names = append(names, decoder.Name())
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// Returns the decoder with the given name.
+func GetDecoder(name string) (Decoder, bool) {
+	for i := len(decoders) - 1; i >= 0; i-- {
+		if decoders[i].Name() == name {
+			return decoders[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the decoder for the given filename (by its extension), or nil if it is YAML or of no
+// known format.
+func DecoderFor(filename string) Decoder {
+	var ext = strings.ToLower(filepath.Ext(filename))
+
+	for i := len(decoders) - 1; i >= 0; i-- {
+		for _, candidate := range decoders[i].Extensions() {
+			if ext == candidate {
+				return decoders[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the decoder for the given MIME type (as from a Content-Type header), or nil if there
+// isn't one.
+func DecoderForMIME(mimetype string) Decoder {
+	if mt, _, err := mime.ParseMediaType(mimetype); err == nil {
+		for i := len(decoders) - 1; i >= 0; i-- {
+			for _, candidate := range decoders[i].MIMETypes() {
+				if mt == candidate {
+					return decoders[i]
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reports whether the given file could hold an application or module: whether it is YAML or in
+// the format of a registered decoder.
+func IsDocumentFile(filename string) bool {
+	var ext = strings.ToLower(filepath.Ext(filename))
+
+	for _, candidate := range YAMLExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+
+	return (DecoderFor(filename) != nil)
+}
+
+// reports whether the given file is a module spec (see ModuleSpecFilename) in any format.
+func isModuleSpecFile(filename string) bool {
+	var base = filepath.Base(filename)
+	var spec = strings.TrimSuffix(ModuleSpecFilename, filepath.Ext(ModuleSpecFilename))
+
+	return (IsDocumentFile(base) && strings.TrimSuffix(base, filepath.Ext(base)) == spec)
+}
+
+// returns the given filename followed by the same name as YAML and in the format of every
+// registered decoder, in the order they were registered.
+func documentVariants(filename string) []string {
+	var variants = []string{filename, fileutil.SetExt(filename, YAMLExtensions[0])}
+
+	for _, decoder := range decoders {
+		for _, ext := range decoder.Extensions() {
+			variants = append(variants, fileutil.SetExt(filename, ext))
+		}
+	}
+
+	return sliceutil.UniqueStrings(variants)
+}
+
+// converts the given document into YAML with the given decoder or, if it is already YAML (the
+// decoder is nil), renders it as a template (see RenderTemplate).
+func decodeDocument(name string, decoder Decoder, data []byte, dir string) ([]byte, error) {
+	if decoder == nil {
+		if rendered, err := RenderTemplate(name, data, dir); err == nil {
+			return rendered, nil
+		} else {
+			return nil, fmt.Errorf("template: %v", err)
+		}
+	} else if decoded, err := decoder.Decode(name, data); err == nil {
+		return decoded, nil
+	} else {
+		return nil, fmt.Errorf("%s: %v", decoder.Name(), err)
+	}
+}
+
+// JSON is re-encoded as YAML rather than passed through as it is: while nearly all JSON is YAML,
+// some (like the "\/" escape) is not.  Object keys keep their order.
+type jsonDecoder struct{}
+
+func (self jsonDecoder) Name() string {
+	return `json`
+}
+
+func (self jsonDecoder) Extensions() []string {
+	return []string{`.json`}
+}
+
+func (self jsonDecoder) MIMETypes() []string {
+	return []string{`application/json`, `text/json`}
+}
+
+func (self jsonDecoder) Decode(filename string, data []byte) ([]byte, error) {
+	var dec = json.NewDecoder(bytes.NewReader(data))
+
+	dec.UseNumber()
+
+	if value, err := decodeOrderedJSON(dec); err == nil {
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, fmt.Errorf("unexpected data after the top-level value")
+		}
+
+		return yaml.Marshal(value)
+	} else if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else {
+		return nil, err
+	}
+}
+
+// reads the next value from the given decoder, with objects read into MapSlices so that their
+// keys stay in order.
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		var object = t == '{'
+		var items = yaml.MapSlice{}
+		var list = make([]interface{}, 0)
+
+		for dec.More() {
+			var key interface{}
+
+			if object {
+				if key, err = dec.Token(); err != nil {
+					return nil, err
+				}
+			}
+
+			if value, err := decodeOrderedJSON(dec); err == nil {
+				if object {
+					items = append(items, yaml.MapItem{Key: key, Value: value})
+				} else {
+					list = append(list, value)
+				}
+			} else {
+				return nil, err
+			}
+		}
+
+		// the closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		if object {
+			return items, nil
+		} else {
+			return list, nil
+		}
+
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		} else {
+			return t.Float64()
+		}
+
+	default:
+		return token, nil
+	}
+}
+
+type tomlDecoder struct{}
+
+func (self tomlDecoder) Name() string {
+	return `toml`
+}
+
+func (self tomlDecoder) Extensions() []string {
+	return []string{`.toml`}
+}
+
+func (self tomlDecoder) MIMETypes() []string {
+	return []string{`application/toml`, `text/toml`, `application/x-toml`}
+}
+
+func (self tomlDecoder) Decode(filename string, data []byte) ([]byte, error) {
+	var value map[string]interface{}
+
+	if meta, err := toml.Decode(string(data), &value); err == nil {
+		var order = make(map[string][]string)
+
+		// keys are listed in the order they appear, each after the table that holds it
+		for _, key := range meta.Keys() {
+			parent := strings.Join(key[:len(key)-1], "\x00")
+			order[parent] = append(order[parent], key[len(key)-1])
+		}
+
+		return yaml.Marshal(orderTOML(value, nil, order))
+	} else {
+		return nil, err
+	}
+}
+
+// converts the tables in a decoded TOML value into MapSlices, with their keys in the given order
+// (those missing from it following in lexical order).
+func orderTOML(value interface{}, path []string, order map[string][]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var items = make(yaml.MapSlice, 0, len(v))
+		var names = sliceutil.UniqueStrings(order[strings.Join(path, "\x00")])
+		var rest []string
+
+		for name := range v {
+			if !sliceutil.ContainsString(names, name) {
+				rest = append(rest, name)
+			}
+		}
+
+		sort.Strings(rest)
+
+		for _, name := range append(names, rest...) {
+			if child, ok := v[name]; ok {
+				items = append(items, yaml.MapItem{
+					Key:   name,
+					Value: orderTOML(child, append(append([]string(nil), path...), name), order),
+				})
+			}
+		}
+
+		return items
+
+	case []map[string]interface{}:
+		var list = make([]interface{}, len(v))
+
+		for i, table := range v {
+			list[i] = orderTOML(table, path, order)
+		}
+
+		return list
+
+	case []interface{}:
+		var list = make([]interface{}, len(v))
+
+		for i, item := range v {
+			list[i] = orderTOML(item, path, order)
+		}
+
+		return list
+
+	default:
+		return value
+	}
+}
+
+// Decodes CUE by exporting it as YAML with the cue command, so CUE's constraints are checked
+// along the way.
+type CUEDecoder struct {
+	Command string // the cue executable
+}
+
+func NewCUEDecoder() *CUEDecoder {
+	return &CUEDecoder{
+		Command: executil.Env(`HYDRA_CUE`, `cue`),
+	}
+}
+
+func (self *CUEDecoder) Name() string {
+	return `cue`
+}
+
+func (self *CUEDecoder) Extensions() []string {
+	return []string{`.cue`}
+}
+
+func (self *CUEDecoder) MIMETypes() []string {
+	return []string{`application/cue`, `text/cue`, `text/x-cue`}
+}
+
+func (self *CUEDecoder) Decode(filename string, data []byte) ([]byte, error) {
+	tmp, err := ioutil.TempDir(``, `hydra-cue-`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	var stderr bytes.Buffer
+	var base = filepath.Base(filename)
+	var file = filepath.Join(tmp, strings.TrimSuffix(base, filepath.Ext(base))+`.cue`)
+
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(self.Command, `export`, `--out`, `yaml`, file)
+	cmd.Stderr = &stderr
+
+	if out, err := cmd.Output(); err == nil {
+		return out, nil
+	} else if msg := strings.TrimSpace(stderr.String()); msg != `` {
+		return nil, fmt.Errorf("%s", strings.Replace(msg, file, filename, -1))
+	} else {
+		return nil, err
+	}
+}
+
+func init() {
+	RegisterDecoder(jsonDecoder{})
+	RegisterDecoder(tomlDecoder{})
+	RegisterDecoder(NewCUEDecoder())
+}
@@ -0,0 +1,151 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestDecoderRegistry(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal([]string{`cue`, `json`, `toml`}, DecoderNames())
+	assert.Equal(`json`, DecoderFor(`apps/app.JSON`).Name())
+	assert.Equal(`toml`, DecoderForMIME(`application/toml; charset=utf-8`).Name())
+	assert.Nil(DecoderFor(`app.yaml`))
+	assert.Nil(DecoderForMIME(`text/plain`))
+
+	assert.True(IsDocumentFile(`app.yml`))
+	assert.True(IsDocumentFile(`clock.cue`))
+	assert.False(IsDocumentFile(`logo.png`))
+
+	assert.True(isEntrypointFile(`prod.app.toml`))
+	assert.False(isEntrypointFile(`app.png`))
+	assert.True(isModuleSpecFile(`lib/module.json`))
+
+	assert.Equal([]string{`app.yaml`, `app.json`, `app.toml`, `app.cue`}, documentVariants(`app.yaml`))
+}
+
+func TestDecodersKeepKeyOrder(t *testing.T) {
+	assert := require.New(t)
+
+	out, err := tomlDecoder{}.Decode(`app.toml`, []byte(`
+imports = ["QtQuick 2.0"]
+
+[definition]
+type = "Rectangle"
+
+[definition.properties]
+width = 100
+height = 50
+color = "red"
+`))
+	assert.NoError(err)
+	assert.Equal("imports:\n- QtQuick 2.0\ndefinition:\n  type: Rectangle\n  properties:\n    width: 100\n    height: 50\n    color: red\n", string(out))
+
+	out, err = jsonDecoder{}.Decode(`app.json`, []byte(`{"zeta": "a\/b", "alpha": [1, 2.5, {"y": null}]}`))
+	assert.NoError(err)
+	assert.Equal("zeta: a/b\nalpha:\n- 1\n- 2.5\n- \"y\": null\n", string(out))
+
+	_, err = jsonDecoder{}.Decode(`app.json`, []byte(`{} {}`))
+	assert.Error(err)
+}
+
+func TestLoadDecodedFormats(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-decoder-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	write := func(name string, data string) string {
+		filename := filepath.Join(tmp, name)
+		assert.NoError(ioutil.WriteFile(filename, []byte(data), 0644))
+		return filename
+	}
+
+	// a JSON application, found where app.yaml would be
+	write(`app.json`, "{\n\t\"imports\": [\"QtQuick 2.0\"],\n\t\"definition\": {\"type\": \"Window\"}\n}\n")
+
+	app, err := Load(documentVariants(filepath.Join(tmp, EntrypointFilename))...)
+	assert.NoError(err)
+	assert.Equal(filepath.Join(tmp, `app.json`), app.Location())
+	assert.Equal(`Window`, app.Definition.Type)
+	assert.NoError(ValidateFile(filepath.Join(tmp, `app.json`)))
+
+	// with a YAML overlay on top
+	write(`prod.app.yaml`, "definition:\n  properties:\n    width: 1920\n")
+
+	defer func(env string) {
+		Environment = env
+	}(Environment)
+
+	Environment = `prod`
+
+	app, err = Load(filepath.Join(tmp, `app.json`))
+	assert.NoError(err)
+	assert.Equal(1920, app.Definition.Properties[`width`])
+
+	// malformed files say what's wrong with them
+	write(`broken.app.json`, `{"imports": [`)
+	_, err = Load(filepath.Join(tmp, `broken.app.json`))
+	assert.Error(err)
+	assert.Contains(err.Error(), `json:`)
+
+	// a TOML module
+	clock := write(`Clock.toml`, "[definition]\ntype = \"Text\"\n\n[definition.properties]\ntext = \"12:00\"\n")
+	assert.True(IsValidModuleFile(clock))
+	assert.False(IsValidModuleFile(write(`notes.txt`, "name: notes\n")))
+
+	module := new(Module)
+	assert.NoError(LoadModule(clock, module))
+	assert.Equal(`Clock`, module.Name)
+	assert.Equal(`12:00`, module.Definition.Properties[`text`])
+
+	// generated QML replaces its source in the QRC, whatever format that is in
+	assert.False(qrcSkipFile(clock))
+	write(`Clock.qml`, "Text {}\n")
+	assert.True(qrcSkipFile(clock))
+
+	// documents retrieved from URLs are decoded by their Content-Type
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(`Content-Type`, `application/toml`)
+		w.Write([]byte("imports = [\"QtQuick 2.0\"]\n"))
+	}))
+
+	defer server.Close()
+
+	app = new(Application)
+	assert.NoError(FromURL(app, server.URL+`/app`))
+	assert.Equal([]string{`QtQuick 2.0`}, app.Imports)
+}
+
+func TestCUEDecoder(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-cue-test-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	// a stand-in for the cue command that checks it was asked for YAML
+	cue := filepath.Join(tmp, `cue`)
+	assert.NoError(ioutil.WriteFile(cue, []byte(`#!/bin/sh
+[ "$1 $2 $3" = "export --out yaml" ] || { echo "bad arguments: $*" >&2; exit 1; }
+grep -q 'imports' "$4" || { echo "$4: no imports" >&2; exit 1; }
+printf 'imports:\n- QtQuick 2.0\n'
+`), 0755))
+
+	decoder := &CUEDecoder{Command: cue}
+
+	out, err := decoder.Decode(`apps/app.cue`, []byte(`imports: ["QtQuick 2.0"]`))
+	assert.NoError(err)
+	assert.Equal("imports:\n- QtQuick 2.0\n", string(out))
+
+	_, err = decoder.Decode(`apps/app.cue`, []byte(`definition: {}`))
+	assert.EqualError(err, `apps/app.cue: no imports`)
+}
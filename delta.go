@@ -0,0 +1,339 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghetzel/go-stockutil/convutil"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The name of the first entry in a delta archive, describing what the delta applies to.
+const DeltaFilename string = `delta.yaml`
+
+// Refers to an archive holding only the files that changed between some earlier build of an
+// application and this manifest, which can be applied to that build instead of fetching
+// everything again.
+type ManifestDelta struct {
+	Name   string `yaml:"name"   json:"name"`
+	Size   int64  `yaml:"size"   json:"size"`
+	SHA256 string `yaml:"sha256" json:"sha256"`
+	Base   string `yaml:"base"   json:"base"` // the ContentHash of the build this delta applies to
+}
+
+// Describes the contents of a delta archive: the build it must be applied to, the build that
+// results, and the files to remove along the way.
+type DeltaSpec struct {
+	Base    *Manifest `yaml:"base"`
+	Target  *Manifest `yaml:"target"`
+	Removed []string  `yaml:"removed,omitempty"`
+}
+
+// Lists the differences between two manifests, by file name and checksum.
+type ManifestDiff struct {
+	Added   ManifestFiles
+	Removed ManifestFiles
+	Changed ManifestFiles
+}
+
+// Returns whether both manifests list the same files.
+func (self *ManifestDiff) Empty() bool {
+	return len(self.Added) == 0 && len(self.Removed) == 0 && len(self.Changed) == 0
+}
+
+// Compares the files listed in two manifests.  Added and Changed hold the entries from the new
+// manifest, Removed holds those from the old one; all are sorted by name.
+func DiffManifests(from *Manifest, to *Manifest) *ManifestDiff {
+	var diff = new(ManifestDiff)
+	var before = make(map[string]*ManifestFile)
+	var after = make(map[string]bool)
+
+	for _, file := range from.Files() {
+		before[file.Name] = file
+	}
+
+	for _, file := range to.Files() {
+		after[file.Name] = true
+
+		if prev, ok := before[file.Name]; !ok {
+			diff.Added = append(diff.Added, file)
+		} else if prev.SHA256 != file.SHA256 {
+			diff.Changed = append(diff.Changed, file)
+		}
+	}
+
+	for _, file := range from.Files() {
+		if !after[file.Name] {
+			diff.Removed = append(diff.Removed, file)
+		}
+	}
+
+	for _, files := range []ManifestFiles{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Name < files[j].Name
+		})
+	}
+
+	return diff
+}
+
+// Returns a checksum identifying the contents of a build made from this manifest, which is what
+// deltas are matched against.  Only the files a bundle would contain are considered (see
+// Bundled), so a bundle's manifest and the manifest of a build it was extracted into agree.
+func (self *Manifest) ContentHash() string {
+	var lines []string
+	var hash = sha256.New()
+
+	for _, file := range self.Bundled().Files() {
+		lines = append(lines, file.SHA256+`  `+filepath.ToSlash(file.Name)+"\n")
+	}
+
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		io.WriteString(hash, line)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Loads the manifest in the given file, as written by WriteFile, rooted at the directory the
+// file is in.
+func LoadManifest(filename string) (*Manifest, error) {
+	if file, err := os.Open(filename); err == nil {
+		defer file.Close()
+
+		var app Application
+
+		if err := yaml.NewDecoder(file).Decode(&app); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %v", filename, err)
+		} else if app.Manifest == nil {
+			return nil, fmt.Errorf("invalid manifest %s: no manifest", filename)
+		}
+
+		app.Manifest.SetRoot(filepath.Dir(filename))
+		return app.Manifest, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Writes a delta archive to outfile that turns a build of base into a build of target.  The
+// format is determined by the extension of outfile, just like Bundle, and the changed files are
+// read from target's root directory.  The returned delta refers to the archive by its base name;
+// add it to the Deltas of the manifest being published alongside it.
+func CreateDelta(base *Manifest, target *Manifest, outfile string) (*ManifestDelta, error) {
+	var from = base.Bundled()
+	var to = target.Bundled()
+	var diff = DiffManifests(from, to)
+	var spec = DeltaSpec{
+		Base:   from,
+		Target: to,
+	}
+
+	for _, file := range diff.Removed {
+		spec.Removed = append(spec.Removed, file.Name)
+	}
+
+	changes := NewManifest(target.rootDir)
+	changes.GeneratedAt = target.GeneratedAt
+
+	for _, file := range append(diff.Added, diff.Changed...) {
+		if IsValidModuleFile(file.Name) {
+			changes.Modules = append(changes.Modules, file)
+		} else {
+			changes.Assets = append(changes.Assets, file)
+		}
+
+		changes.FileCount += 1
+		changes.TotalSize += file.Size
+	}
+
+	if data, err := yaml.Marshal(&spec); err == nil {
+		if err := writeBundle(outfile, changes, bundleHeader{
+			Name: DeltaFilename,
+			Data: data,
+		}); err != nil {
+			return nil, fmt.Errorf("delta: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("delta: %v", err)
+	}
+
+	if cksum, err := fileutil.ChecksumFile(outfile, `sha256`); err == nil {
+		log.Infof("delta: %d added, %d changed, %d removed", len(diff.Added), len(diff.Changed), len(diff.Removed))
+
+		return &ManifestDelta{
+			Name:   filepath.Base(outfile),
+			Size:   int64(fileutil.SizeOf(outfile)),
+			SHA256: hex.EncodeToString(cksum),
+			Base:   from.ContentHash(),
+		}, nil
+	} else {
+		return nil, fmt.Errorf("delta: %v", err)
+	}
+}
+
+// Brings destdir up to date with this manifest by applying one of its deltas to the previous
+// build (in options.DeltaBase, or destdir itself).  The previous build's files are checked
+// against the delta's base manifest first, and the result against its target manifest, so any
+// error leaves it to a full fetch to put things right.
+func (self *Manifest) applyDelta(srcroot string, destdir string, options FetchOptions) error {
+	var basedir = sliceutil.OrString(options.DeltaBase, destdir)
+	var delta *ManifestDelta
+	var previous = loadGeneratedManifest(basedir)
+
+	if previous == nil {
+		return fmt.Errorf("no previous build in %s", basedir)
+	}
+
+	hash := previous.ContentHash()
+
+	for _, d := range self.Deltas {
+		if d.Base == hash {
+			delta = d
+			break
+		}
+	}
+
+	if delta == nil {
+		return fmt.Errorf("no delta applies to build %s", hash)
+	}
+
+	archive := &ManifestFile{
+		Name:    delta.Name,
+		Size:    delta.Size,
+		SHA256:  delta.SHA256,
+		Archive: true,
+	}
+
+	log.Infof("applying delta %s (%v) to %s", delta.Name, convutil.Bytes(delta.Size), basedir)
+
+	if err := archive.download(srcroot, destdir, options, newFetchTracker(ManifestFiles{archive}, options.OnProgress)); err != nil {
+		return err
+	} else if err := archive.validate(destdir); err != nil {
+		return fmt.Errorf("%s: %v", delta.Name, err)
+	}
+
+	dest := archive.destination(destdir)
+	defer os.Remove(dest)
+
+	spec, err := applyDeltaArchive(dest, basedir, destdir, delta, options)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", delta.Name, err)
+	}
+
+	// bundles listed in the manifest are now satisfied by the files the delta put in place
+	var listed = make(map[string]bool)
+
+	for _, file := range self.Files() {
+		listed[file.Name] = true
+
+		if file.Archive {
+			file.skipValidate = true
+		}
+	}
+
+	for _, file := range spec.Target.Files() {
+		if !listed[file.Name] {
+			if err := self.Append(filepath.Join(destdir, file.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyDeltaArchive(archive string, basedir string, destdir string, delta *ManifestDelta, options FetchOptions) (*DeltaSpec, error) {
+	format := ArchiveFormatFor(archive)
+
+	if format == nil {
+		return nil, fmt.Errorf("unsupported archive format")
+	}
+
+	f, err := os.Open(archive)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	ar, err := format.NewReader(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer ar.Close()
+
+	var spec DeltaSpec
+
+	if entry, data, err := ar.Next(); err != nil {
+		return nil, err
+	} else if entry.Type != ArchiveFile || archivePath(entry.Name) != DeltaFilename {
+		return nil, fmt.Errorf("archive does not start with %s", DeltaFilename)
+	} else if raw, err := ioutil.ReadAll(io.LimitReader(data, MaxBundleManifestSize+1)); err != nil {
+		return nil, err
+	} else if len(raw) > MaxBundleManifestSize {
+		return nil, fmt.Errorf("%s: larger than %d bytes", DeltaFilename, MaxBundleManifestSize)
+	} else if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", DeltaFilename, err)
+	} else if spec.Base == nil || spec.Target == nil {
+		return nil, fmt.Errorf("%s: missing base or target manifest", DeltaFilename)
+	} else if spec.Base.ContentHash() != delta.Base {
+		return nil, fmt.Errorf("%s: base manifest does not match", DeltaFilename)
+	}
+
+	// the previous build must be exactly what the delta was made against
+	for _, file := range spec.Base.Files() {
+		if err := file.validate(basedir); err != nil {
+			return nil, fmt.Errorf("base %s: %v", file.Name, err)
+		}
+	}
+
+	// when building into a new directory, unchanged files are carried over from the previous one
+	if basedir != destdir {
+		for _, file := range spec.Target.Files() {
+			if file.validate(basedir) == nil {
+				dest := file.destination(destdir)
+				os.Remove(dest)
+
+				if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+					return nil, err
+				} else if err := copyFile(file.destination(basedir), dest); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := extractEntries(destdir, ar, ExtractOptions{
+		Links: options.ArchiveLinks,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	for _, name := range spec.Removed {
+		removeStaleFile(destdir, name)
+	}
+
+	for _, file := range spec.Target.Files() {
+		if err := file.validate(destdir); err != nil {
+			return nil, fmt.Errorf("target %s: %v", file.Name, err)
+		}
+	}
+
+	return &spec, nil
+}
@@ -0,0 +1,177 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+func TestDiffManifests(t *testing.T) {
+	assert := require.New(t)
+
+	old := &Manifest{
+		Assets: ManifestFiles{
+			{Name: `same.txt`, SHA256: `1`},
+			{Name: `changed.txt`, SHA256: `2`},
+			{Name: `removed.txt`, SHA256: `3`},
+		},
+	}
+
+	new := &Manifest{
+		Assets: ManifestFiles{
+			{Name: `same.txt`, SHA256: `1`},
+			{Name: `changed.txt`, SHA256: `4`},
+			{Name: `b-added.txt`, SHA256: `5`},
+			{Name: `a-added.txt`, SHA256: `6`},
+		},
+	}
+
+	diff := DiffManifests(old, new)
+	assert.False(diff.Empty())
+
+	for _, tc := range []struct {
+		files ManifestFiles
+		names []string
+	}{
+		{diff.Added, []string{`a-added.txt`, `b-added.txt`}},
+		{diff.Removed, []string{`removed.txt`}},
+		{diff.Changed, []string{`changed.txt`}},
+	} {
+		var names []string
+
+		for _, file := range tc.files {
+			names = append(names, file.Name)
+		}
+
+		assert.Equal(tc.names, names)
+	}
+
+	assert.Equal(`4`, diff.Changed[0].SHA256)
+	assert.True(DiffManifests(new, new).Empty())
+	assert.Equal(old.ContentHash(), old.ContentHash())
+	assert.NotEqual(old.ContentHash(), new.ContentHash())
+}
+
+func TestFetchDelta(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-delta-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcdir := filepath.Join(tmp, `src`)
+	pubdir := filepath.Join(tmp, `pub`)
+	bundle := filepath.Join(pubdir, `app.tar.gz`)
+
+	writeFiles := func(files map[string]string) *Manifest {
+		for name, data := range files {
+			if data == `` {
+				assert.NoError(os.Remove(filepath.Join(srcdir, name)))
+			} else {
+				_, err := fileutil.WriteFile(data, filepath.Join(srcdir, name))
+				assert.NoError(err)
+			}
+		}
+
+		manifest, err := CreateManifest(srcdir)
+		assert.NoError(err)
+		return manifest
+	}
+
+	// publishes a bundle of the source manifest, returning the manifest that refers to it
+	publish := func(source *Manifest) *Manifest {
+		assert.NoError(os.MkdirAll(pubdir, 0755))
+		assert.NoError(source.Bundle(bundle))
+
+		published := NewManifest(pubdir)
+		assert.NoError(published.Append(bundle))
+		assert.NoError(published.MarkArchives(filepath.Base(bundle)))
+		published.Assets[0].ArchiveFileCount = source.Bundled().FileCount
+		published.Assets[0].UncompressedSize = source.Bundled().TotalSize
+
+		return published
+	}
+
+	// fetches the published manifest into destdir, leaving behind a generated manifest like Generate does
+	build := func(published *Manifest, destdir string) error {
+		var manifest = *published
+		manifest.Assets = nil
+
+		for _, file := range published.Assets {
+			copied := *file
+			manifest.Assets = append(manifest.Assets, &copied)
+		}
+
+		manifest.SetRoot(destdir)
+
+		if err := manifest.FetchWithOptions(pubdir, destdir, FetchOptions{
+			Retries: -1,
+		}); err != nil {
+			return err
+		}
+
+		return manifest.WriteFile(filepath.Join(destdir, ManifestFilename))
+	}
+
+	v1 := writeFiles(map[string]string{
+		`app.yaml`:      "root:\n  type: Window\n",
+		`lib/one.txt`:   `one`,
+		`lib/two.txt`:   `two`,
+		`assets/x.json`: `{}`,
+	})
+
+	published := publish(v1)
+	assert.NoError(build(published, filepath.Join(tmp, `a`)))
+	assert.NoError(build(published, filepath.Join(tmp, `b`)))
+
+	v2 := writeFiles(map[string]string{
+		`lib/one.txt`:   ``,
+		`lib/two.txt`:   `TWO`,
+		`lib/three.txt`: `three`,
+	})
+
+	published = publish(v2)
+	delta, err := CreateDelta(v1, v2, filepath.Join(pubdir, `delta.tar.gz`))
+	assert.NoError(err)
+	assert.Equal(v1.ContentHash(), delta.Base)
+	assert.Equal(`delta.tar.gz`, delta.Name)
+
+	published.Deltas = []*ManifestDelta{delta}
+
+	// without the full bundle available, only the delta can bring a build up to date
+	assert.NoError(os.Rename(bundle, bundle+`.bak`))
+	assert.NoError(build(published, filepath.Join(tmp, `a`)))
+
+	for name, data := range map[string]string{
+		`app.yaml`:      "root:\n  type: Window\n",
+		`lib/two.txt`:   `TWO`,
+		`lib/three.txt`: `three`,
+		`assets/x.json`: `{}`,
+	} {
+		actual, err := ioutil.ReadFile(filepath.Join(tmp, `a`, name))
+		assert.NoError(err, name)
+		assert.Equal(data, string(actual), name)
+	}
+
+	assert.False(fileutil.Exists(filepath.Join(tmp, `a`, `lib/one.txt`)))
+	assert.False(fileutil.Exists(filepath.Join(tmp, `a`, `delta.tar.gz`)))
+
+	generated := loadGeneratedManifest(filepath.Join(tmp, `a`))
+	assert.NotNil(generated)
+	assert.Equal(v2.ContentHash(), generated.ContentHash())
+
+	// a build that doesn't match the delta's base is fetched in full
+	assert.NoError(ioutil.WriteFile(filepath.Join(tmp, `b`, `lib/one.txt`), []byte(`modified`), 0644))
+	assert.Error(build(published, filepath.Join(tmp, `b`)))
+
+	assert.NoError(os.Rename(bundle+`.bak`, bundle))
+	assert.NoError(build(published, filepath.Join(tmp, `b`)))
+
+	actual, err := ioutil.ReadFile(filepath.Join(tmp, `b`, `lib/two.txt`))
+	assert.NoError(err)
+	assert.Equal(`TWO`, string(actual))
+}
@@ -0,0 +1,568 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/log"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Determines what happens to symbolic and hard links found in an archive.
+type LinkPolicy int
+
+const (
+	RejectLinks LinkPolicy = iota // fail extraction
+	SkipLinks                     // leave links out, logging a warning
+	AllowLinks                    // create links whose targets are inside the destination
+)
+
+// Parses the given link policy (reject, skip, or allow), returning an error if it is not
+// recognized.
+func ParseLinkPolicy(str string) (LinkPolicy, error) {
+	switch str {
+	case `reject`, ``:
+		return RejectLinks, nil
+	case `skip`:
+		return SkipLinks, nil
+	case `allow`:
+		return AllowLinks, nil
+	default:
+		return RejectLinks, fmt.Errorf("invalid archive link policy %q (expected reject, skip, or allow)", str)
+	}
+}
+
+// Same as ParseLinkPolicy, but logs a warning and rejects links if the policy is not
+// recognized.
+func LinkPolicyFromString(str string) LinkPolicy {
+	if policy, err := ParseLinkPolicy(str); err == nil {
+		return policy
+	} else {
+		log.Warningf("%v, links will be rejected", err)
+		return RejectLinks
+	}
+}
+
+// The largest bundle manifest that will be read from an archive.
+const MaxBundleManifestSize = 16 * 1048576
+
+type ExtractOptions struct {
+	Links     LinkPolicy
+	FileCount int64 // most files (and links) the archive may contain; zero is unchecked
+	Size      int64 // most bytes the archive's files may add up to; zero is unchecked
+}
+
+type ExtractViolation int
+
+const (
+	UnsafePath       ExtractViolation = iota // entry would be written outside the destination
+	UnsafeLink                               // link target is outside the destination
+	LinkNotAllowed                           // archive contains a link and the policy rejects them
+	UnsupportedEntry                         // device, FIFO, or some other special file
+	TooManyFiles                             // archive contains more files than expected
+	TooLarge                                 // archive contents are larger than expected
+	Incomplete                               // archive contains fewer files or bytes than expected
+	ChecksumMismatch                         // file does not match the bundle manifest
+	UnexpectedFile                           // file is not listed in the bundle manifest
+	InvalidManifest                          // bundle manifest could not be read
+)
+
+func (self ExtractViolation) String() string {
+	switch self {
+	case UnsafePath:
+		return `unsafe path`
+	case UnsafeLink:
+		return `unsafe link`
+	case LinkNotAllowed:
+		return `link not allowed`
+	case UnsupportedEntry:
+		return `unsupported entry`
+	case TooManyFiles:
+		return `too many files`
+	case TooLarge:
+		return `too large`
+	case Incomplete:
+		return `incomplete`
+	case ChecksumMismatch:
+		return `checksum mismatch`
+	case UnexpectedFile:
+		return `unexpected file`
+	case InvalidManifest:
+		return `invalid bundle manifest`
+	default:
+		return `invalid entry`
+	}
+}
+
+// Describes why an archive (or an entry in it) was refused during extraction.
+type ExtractError struct {
+	Violation ExtractViolation
+	Entry     string
+	Detail    string
+}
+
+func (self *ExtractError) Error() string {
+	msg := self.Violation.String()
+
+	if self.Entry != `` {
+		msg = self.Entry + `: ` + msg
+	}
+
+	if self.Detail != `` {
+		msg += ` (` + self.Detail + `)`
+	}
+
+	return msg
+}
+
+// Returns whether the given error is an ExtractError, optionally for one of the given violations.
+func IsExtractErr(err error, violations ...ExtractViolation) bool {
+	var xerr *ExtractError
+
+	if errors.As(err, &xerr) {
+		if len(violations) == 0 {
+			return true
+		}
+
+		for _, violation := range violations {
+			if xerr.Violation == violation {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func extractErr(violation ExtractViolation, entry string, format string, args ...interface{}) error {
+	return &ExtractError{
+		Violation: violation,
+		Entry:     entry,
+		Detail:    fmt.Sprintf(format, args...),
+	}
+}
+
+// Extracts the given archive into destdir, adding everything in it to the manifest, then
+// removes the archive.  Files that aren't archives are left alone.
+//
+// Bundles carry a manifest of their own contents (see Manifest.Bundle), which is not extracted
+// but is instead used to check that every file came out intact and that none are missing.
+func extract(manifest *Manifest, archive string, destdir string, options ExtractOptions) error {
+	format := ArchiveFormatFor(archive)
+
+	if format == nil {
+		return nil
+	}
+
+	if f, err := os.Open(archive); err == nil {
+		defer f.Close()
+
+		if ar, err := format.NewReader(f); err == nil {
+			defer ar.Close()
+
+			if err := extractEntries(destdir, ar, options, func(path string, info os.FileInfo, err error) error {
+				if err == nil {
+					return manifest.Append(path, info)
+				} else {
+					return err
+				}
+			}); err != nil {
+				return err
+			}
+
+			ar.Close()
+		} else {
+			return err
+		}
+
+		f.Close()
+
+		log.Debugf("removing extracted archive: %s", archive)
+		return os.Remove(archive)
+	} else {
+		return err
+	}
+}
+
+// tracks the limits placed on a single extraction.
+type extractor struct {
+	dest      string
+	root      string
+	options   ExtractOptions
+	files     int64
+	bytes     int64
+	checksums map[string]string
+	bundled   *Manifest
+}
+
+func extractEntries(dst string, ar ArchiveReader, options ExtractOptions, fn filepath.WalkFunc) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	// links are checked against the real location of the destination
+	root, err := filepath.EvalSymlinks(dst)
+
+	if err != nil {
+		return err
+	}
+
+	x := &extractor{
+		dest:      dst,
+		root:      root,
+		options:   options,
+		checksums: make(map[string]string),
+	}
+
+	for {
+		entry, data, err := ar.Next()
+
+		switch {
+		case err == io.EOF: // if no more files are found, make sure we got everything
+			return x.verify()
+		case err != nil: // return any other error
+			return err
+		}
+
+		target, err := x.target(entry.Name)
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Type == ArchiveFile && x.bundled == nil && filepath.Clean(filepath.FromSlash(entry.Name)) == ManifestFilename {
+			if err := x.readManifest(entry, data); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		switch entry.Type {
+		case ArchiveDir:
+			if err := x.mkdir(entry.Name, target); err != nil {
+				return err
+			}
+
+		case ArchiveFile:
+			if err := x.writeFile(entry, target, data); err != nil {
+				return err
+			}
+
+		case ArchiveSymlink, ArchiveHardlink:
+			switch options.Links {
+			case SkipLinks:
+				log.Warningf("extract: skipping %v %s -> %s", entry.Type, entry.Name, entry.Linkname)
+				continue
+			case AllowLinks:
+				if err := x.link(entry, target); err != nil {
+					return err
+				}
+			default:
+				return extractErr(LinkNotAllowed, entry.Name, "%v to %s", entry.Type, entry.Linkname)
+			}
+
+		default:
+			return extractErr(UnsupportedEntry, entry.Name, "%v", entry.Type)
+		}
+
+		if fn != nil {
+			info, serr := os.Stat(target)
+
+			if err := fn(target, info, serr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// returns where the named entry should be extracted to, provided that is inside the destination.
+func (self *extractor) target(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+
+	switch {
+	case name == ``, clean == `.`:
+		return ``, extractErr(UnsafePath, name, "empty name")
+	case filepath.IsAbs(clean), strings.HasPrefix(name, `/`), filepath.VolumeName(clean) != ``:
+		return ``, extractErr(UnsafePath, name, "absolute path")
+	case escapes(clean):
+		return ``, extractErr(UnsafePath, name, "outside of destination")
+	}
+
+	target := filepath.Join(self.dest, clean)
+
+	// a link extracted earlier (or already in the destination) must not lead elsewhere, so the
+	// closest existing ancestor of the target is resolved and checked
+	for dir := filepath.Dir(target); ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			if !self.contains(resolved) {
+				return ``, extractErr(UnsafePath, name, "parent directory leads outside of destination")
+			}
+
+			return target, nil
+		} else if !os.IsNotExist(err) || dir == self.dest || dir == filepath.Dir(dir) {
+			return ``, err
+		}
+	}
+}
+
+// returns whether the given path (with any symlinks already resolved) is inside the destination.
+func (self *extractor) contains(path string) bool {
+	if rel, err := filepath.Rel(self.root, path); err == nil {
+		return !escapes(rel)
+	}
+
+	return false
+}
+
+func escapes(rel string) bool {
+	return rel == `..` || strings.HasPrefix(rel, `..`+string(filepath.Separator))
+}
+
+func (self *extractor) mkdir(name string, target string) error {
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		return extractErr(UnsafePath, name, "already exists and is not a directory")
+	}
+
+	return os.MkdirAll(target, 0755)
+}
+
+func (self *extractor) count(name string) error {
+	self.files += 1
+
+	if self.options.FileCount > 0 && self.files > self.options.FileCount {
+		return extractErr(TooManyFiles, name, "expected %d", self.options.FileCount)
+	}
+
+	return nil
+}
+
+// prepares to create a file, link, or directory at target, removing anything already there.
+// Existing files are removed rather than written to so that neither symlinks nor hard links
+// (e.g.: into the cache) are followed.
+func (self *extractor) replace(name string, target string) error {
+	if err := self.count(name); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(target); err == nil {
+		if info.IsDir() {
+			return extractErr(UnsafePath, name, "already exists and is a directory")
+		} else if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *extractor) writeFile(entry *ArchiveEntry, target string, data io.Reader) error {
+	if err := self.replace(entry.Name, target); err != nil {
+		return err
+	}
+
+	var limit int64 = -1
+
+	if self.options.Size > 0 {
+		limit = self.options.Size - self.bytes
+	}
+
+	if f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, entry.Mode|0600); err == nil {
+		defer f.Close()
+
+		var n int64
+		var err error
+		var hash = sha256.New()
+		var w = io.MultiWriter(f, hash)
+
+		// the sizes reported by the archive are not trusted; the limit is applied to what is read
+		if limit >= 0 {
+			n, err = io.CopyN(w, data, limit+1)
+
+			if err == io.EOF {
+				err = nil
+			}
+		} else {
+			n, err = io.Copy(w, data)
+		}
+
+		self.bytes += n
+
+		if err != nil {
+			return err
+		} else if limit >= 0 && n > limit {
+			f.Close()
+			os.Remove(target)
+			return extractErr(TooLarge, entry.Name, "expected %d bytes", self.options.Size)
+		}
+
+		self.checksums[archivePath(entry.Name)] = hex.EncodeToString(hash.Sum(nil))
+		return f.Close()
+	} else {
+		return err
+	}
+}
+
+func (self *extractor) link(entry *ArchiveEntry, target string) error {
+	if entry.Linkname == `` {
+		return extractErr(UnsafeLink, entry.Name, "empty link target")
+	}
+
+	switch entry.Type {
+	case ArchiveSymlink:
+		linkname := filepath.FromSlash(entry.Linkname)
+
+		if filepath.IsAbs(linkname) || strings.HasPrefix(entry.Linkname, `/`) {
+			return extractErr(UnsafeLink, entry.Name, "absolute link target %s", entry.Linkname)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		// the target is followed from where the link really is, not where its name says it is
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(target)); err == nil {
+			if err := self.followLink(dir, linkname); err != nil {
+				return extractErr(UnsafeLink, entry.Name, "link target %s %v", entry.Linkname, err)
+			}
+		} else {
+			return err
+		}
+
+		if err := self.replace(entry.Name, target); err != nil {
+			return err
+		}
+
+		return os.Symlink(linkname, target)
+
+	default:
+		// hard links refer to a file extracted earlier from the same archive
+		source, err := self.target(entry.Linkname)
+
+		if err != nil {
+			return extractErr(UnsafeLink, entry.Name, "link target %s is outside of destination", entry.Linkname)
+		}
+
+		if info, err := os.Lstat(source); err != nil || !info.Mode().IsRegular() {
+			return extractErr(UnsafeLink, entry.Name, "link target %s is not a regular file", entry.Linkname)
+		}
+
+		if err := self.replace(entry.Name, target); err != nil {
+			return err
+		}
+
+		self.checksums[archivePath(entry.Name)] = self.checksums[archivePath(entry.Linkname)]
+		return os.Link(source, target)
+	}
+}
+
+// checks that following the given (relative) link target from dir stays inside the destination.
+// Links already extracted are followed too, so that a chain of them can't lead anywhere a single
+// one couldn't.  Since links can be replaced and missing paths created by later entries, ".." is
+// only allowed to step out of the real directories walked through before either of those.
+func (self *extractor) followLink(dir string, linkname string) error {
+	var path = dir
+	var real = true
+
+	for _, part := range strings.Split(linkname, string(filepath.Separator)) {
+		switch part {
+		case ``, `.`:
+			continue
+		case `..`:
+			if !real {
+				return fmt.Errorf("steps out of a link or a path that does not exist yet")
+			}
+
+			path = filepath.Dir(path)
+		default:
+			path = filepath.Join(path, part)
+
+			if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				if resolved, err := filepath.EvalSymlinks(path); err == nil {
+					path = resolved
+					real = false
+				} else {
+					return fmt.Errorf("leads through broken link %s", part)
+				}
+			} else if err != nil || !info.IsDir() {
+				real = false
+			}
+		}
+
+		if !self.contains(path) {
+			return fmt.Errorf("is outside of destination")
+		}
+	}
+
+	return nil
+}
+
+// returns the given archive entry name in the form used by manifests, for comparing the two.
+func archivePath(name string) string {
+	return filepath.ToSlash(filepath.Clean(filepath.FromSlash(name)))
+}
+
+// reads the manifest a bundle carries of its own contents.
+func (self *extractor) readManifest(entry *ArchiveEntry, data io.Reader) error {
+	var app Application
+
+	if raw, err := ioutil.ReadAll(io.LimitReader(data, MaxBundleManifestSize+1)); err != nil {
+		return extractErr(InvalidManifest, entry.Name, "%v", err)
+	} else if len(raw) > MaxBundleManifestSize {
+		return extractErr(InvalidManifest, entry.Name, "larger than %d bytes", MaxBundleManifestSize)
+	} else if err := yaml.Unmarshal(raw, &app); err != nil {
+		return extractErr(InvalidManifest, entry.Name, "%v", err)
+	} else if app.Manifest == nil {
+		return extractErr(InvalidManifest, entry.Name, "no manifest")
+	}
+
+	self.bundled = app.Manifest
+	return nil
+}
+
+// checks what was extracted against the bundle manifest, if there is one.  Only then are the
+// expected counts known to be exact; bundles made before they carried a manifest recorded counts
+// that may include files that were never bundled, so for those they are only an upper bound.
+func (self *extractor) verify() error {
+	if self.bundled != nil {
+		if self.options.FileCount > 0 && self.files != self.options.FileCount {
+			return extractErr(Incomplete, ``, "expected %d files, got %d", self.options.FileCount, self.files)
+		}
+
+		if self.options.Size > 0 && self.bytes != self.options.Size {
+			return extractErr(Incomplete, ``, "expected %d bytes, got %d", self.options.Size, self.bytes)
+		}
+
+		var listed = make(map[string]bool)
+
+		for _, file := range self.bundled.Files() {
+			name := archivePath(file.Name)
+			listed[name] = true
+
+			if sum, ok := self.checksums[name]; !ok {
+				return extractErr(Incomplete, name, "listed in bundle manifest but not in archive")
+			} else if sum != file.SHA256 {
+				return extractErr(ChecksumMismatch, name, "expected sha256 %s, got %s", file.SHA256, sum)
+			}
+		}
+
+		for name := range self.checksums {
+			if !listed[name] {
+				return extractErr(UnexpectedFile, name, "not listed in bundle manifest")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package hydra
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	data     string
+	linkname string
+}
+
+// writes a tar archive containing exactly the given entries, returning its path.
+func writeTestTar(assert *require.Assertions, dir string, entries ...testTarEntry) string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	for _, entry := range entries {
+		if entry.typeflag == 0 {
+			entry.typeflag = tar.TypeReg
+		}
+
+		assert.NoError(tw.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Mode:     0644,
+			Size:     int64(len(entry.data)),
+			Linkname: entry.linkname,
+		}))
+
+		_, err := tw.Write([]byte(entry.data))
+		assert.NoError(err)
+	}
+
+	assert.NoError(tw.Close())
+
+	archive, err := ioutil.TempFile(dir, `test-*.tar`)
+	assert.NoError(err)
+	defer archive.Close()
+
+	_, err = archive.Write(buf.Bytes())
+	assert.NoError(err)
+
+	return archive.Name()
+}
+
+func TestExtractViolations(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-extract-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	destdir := filepath.Join(tmp, `out`)
+
+	for _, tc := range []struct {
+		violation ExtractViolation
+		options   ExtractOptions
+		entries   []testTarEntry
+	}{
+		{UnsafePath, ExtractOptions{}, []testTarEntry{{name: `../escape.txt`, data: `x`}}},
+		{UnsafePath, ExtractOptions{}, []testTarEntry{{name: `a/../../escape.txt`, data: `x`}}},
+		{UnsafePath, ExtractOptions{}, []testTarEntry{{name: `/etc/escape.txt`, data: `x`}}},
+		{LinkNotAllowed, ExtractOptions{}, []testTarEntry{{name: `link`, typeflag: tar.TypeSymlink, linkname: `file.txt`}}},
+		{UnsafeLink, ExtractOptions{Links: AllowLinks}, []testTarEntry{{name: `link`, typeflag: tar.TypeSymlink, linkname: `/etc/passwd`}}},
+		{UnsafeLink, ExtractOptions{Links: AllowLinks}, []testTarEntry{{name: `a/link`, typeflag: tar.TypeSymlink, linkname: `../../..`}}},
+		{UnsafeLink, ExtractOptions{Links: AllowLinks}, []testTarEntry{{name: `hard`, typeflag: tar.TypeLink, linkname: `../outside.txt`}}},
+		{UnsupportedEntry, ExtractOptions{}, []testTarEntry{{name: `fifo`, typeflag: tar.TypeFifo}}},
+		{TooManyFiles, ExtractOptions{FileCount: 1}, []testTarEntry{{name: `one`, data: `1`}, {name: `two`, data: `2`}}},
+		{TooLarge, ExtractOptions{Size: 4}, []testTarEntry{{name: `one`, data: `123`}, {name: `two`, data: `45`}}},
+	} {
+		archive := writeTestTar(assert, tmp, tc.entries...)
+		err := extract(NewManifest(destdir), archive, destdir, tc.options)
+
+		assert.Error(err, tc.entries[0].name)
+		assert.True(IsExtractErr(err, tc.violation), "%s: %v", tc.entries[0].name, err)
+	}
+
+	assert.False(fileutil.FileExists(filepath.Join(tmp, `escape.txt`)))
+	assert.False(fileutil.FileExists(`/etc/escape.txt`))
+}
+
+func TestParseLinkPolicy(t *testing.T) {
+	assert := require.New(t)
+
+	for str, expected := range map[string]LinkPolicy{
+		``:       RejectLinks,
+		`reject`: RejectLinks,
+		`skip`:   SkipLinks,
+		`allow`:  AllowLinks,
+	} {
+		policy, err := ParseLinkPolicy(str)
+		assert.NoError(err)
+		assert.Equal(expected, policy)
+	}
+
+	_, err := ParseLinkPolicy(`alow`)
+	assert.Error(err)
+	assert.Contains(err.Error(), `invalid archive link policy "alow"`)
+	assert.Equal(RejectLinks, LinkPolicyFromString(`alow`))
+}
+
+func TestExtractLinks(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-extract-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	entries := []testTarEntry{
+		{name: `lib/file.txt`, data: `contents`},
+		{name: `lib/link.txt`, typeflag: tar.TypeSymlink, linkname: `file.txt`},
+		{name: `hard.txt`, typeflag: tar.TypeLink, linkname: `lib/file.txt`},
+	}
+
+	// links are left out when skipped...
+	destdir := filepath.Join(tmp, `skip`)
+	manifest := NewManifest(destdir)
+	assert.NoError(extract(manifest, writeTestTar(assert, tmp, entries...), destdir, ExtractOptions{
+		Links: SkipLinks,
+	}))
+
+	assert.EqualValues(1, manifest.FileCount)
+	assert.False(fileutil.Exists(filepath.Join(destdir, `lib/link.txt`)))
+
+	// ...and created when allowed
+	destdir = filepath.Join(tmp, `allow`)
+	manifest = NewManifest(destdir)
+	assert.NoError(extract(manifest, writeTestTar(assert, tmp, entries...), destdir, ExtractOptions{
+		Links: AllowLinks,
+	}))
+
+	assert.EqualValues(3, manifest.FileCount)
+
+	for _, name := range []string{`lib/link.txt`, `hard.txt`} {
+		data, err := ioutil.ReadFile(filepath.Join(destdir, name))
+		assert.NoError(err)
+		assert.Equal(`contents`, string(data))
+	}
+
+	// a file is never written through an existing link
+	outside := filepath.Join(tmp, `outside.txt`)
+	assert.NoError(ioutil.WriteFile(outside, []byte(`untouched`), 0644))
+	assert.NoError(os.Symlink(outside, filepath.Join(destdir, `target.txt`)))
+
+	assert.NoError(extract(NewManifest(destdir), writeTestTar(assert, tmp, testTarEntry{
+		name: `target.txt`,
+		data: `new`,
+	}), destdir, ExtractOptions{}))
+
+	data, err := ioutil.ReadFile(outside)
+	assert.NoError(err)
+	assert.Equal(`untouched`, string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(destdir, `target.txt`))
+	assert.NoError(err)
+	assert.Equal(`new`, string(data))
+
+	// nor written into a directory that leads outside of the destination
+	assert.NoError(os.Symlink(tmp, filepath.Join(destdir, `up`)))
+
+	err = extract(NewManifest(destdir), writeTestTar(assert, tmp, testTarEntry{
+		name: `up/new/escape.txt`,
+		data: `x`,
+	}), destdir, ExtractOptions{})
+
+	assert.True(IsExtractErr(err, UnsafePath), "%v", err)
+	assert.False(fileutil.Exists(filepath.Join(tmp, `new`)))
+
+	// links are checked from where they really end up, following any extracted before them
+	for _, chain := range [][]testTarEntry{{
+		{name: `lib/up`, typeflag: tar.TypeSymlink, linkname: `..`},
+		{name: `lib/up/escape`, typeflag: tar.TypeSymlink, linkname: `..`},
+	}, {
+		{name: `lib/up`, typeflag: tar.TypeSymlink, linkname: `..`},
+		{name: `lib/escape`, typeflag: tar.TypeSymlink, linkname: `up/..`},
+	}, {
+		{name: `escape`, typeflag: tar.TypeSymlink, linkname: `later/../outside`},
+		{name: `later`, typeflag: tar.TypeSymlink, linkname: `.`},
+	}} {
+		destdir = filepath.Join(tmp, `chain`)
+
+		err = extract(NewManifest(destdir), writeTestTar(assert, tmp, chain...), destdir, ExtractOptions{
+			Links: AllowLinks,
+		})
+
+		assert.True(IsExtractErr(err, UnsafeLink), "%s: %v", chain[1].name, err)
+		assert.NoError(os.RemoveAll(destdir))
+	}
+}
+
+func TestExtractBundleManifest(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-extract-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	bundleManifest := func(files map[string]string) testTarEntry {
+		manifest := (&testFileServer{
+			files: make(map[string][]byte),
+		})
+
+		for name, data := range files {
+			manifest.files[name] = []byte(data)
+		}
+
+		data, err := yaml.Marshal(&Application{
+			Manifest: manifest.manifest(),
+		})
+		assert.NoError(err)
+
+		return testTarEntry{
+			name: ManifestFilename,
+			data: string(data),
+		}
+	}
+
+	listed := bundleManifest(map[string]string{
+		`one.txt`:     `1`,
+		`lib/two.txt`: `22`,
+	})
+
+	for _, tc := range []struct {
+		violation ExtractViolation
+		options   ExtractOptions
+		entries   []testTarEntry
+	}{
+		{Incomplete, ExtractOptions{}, []testTarEntry{listed, {name: `one.txt`, data: `1`}}},
+		{Incomplete, ExtractOptions{FileCount: 3}, []testTarEntry{listed, {name: `one.txt`, data: `1`}, {name: `lib/two.txt`, data: `22`}}},
+		{Incomplete, ExtractOptions{Size: 4}, []testTarEntry{listed, {name: `one.txt`, data: `1`}, {name: `lib/two.txt`, data: `22`}}},
+		{ChecksumMismatch, ExtractOptions{}, []testTarEntry{listed, {name: `one.txt`, data: `1`}, {name: `lib/two.txt`, data: `XX`}}},
+		{UnexpectedFile, ExtractOptions{}, []testTarEntry{listed, {name: `one.txt`, data: `1`}, {name: `lib/two.txt`, data: `22`}, {name: `three.txt`, data: `3`}}},
+		{InvalidManifest, ExtractOptions{}, []testTarEntry{{name: ManifestFilename, data: `[not a manifest`}}},
+	} {
+		destdir := filepath.Join(tmp, `out`)
+		err := extract(NewManifest(destdir), writeTestTar(assert, tmp, tc.entries...), destdir, tc.options)
+
+		assert.True(IsExtractErr(err, tc.violation), "%v: %v", tc.violation, err)
+		os.RemoveAll(destdir)
+	}
+
+	destdir := filepath.Join(tmp, `out`)
+	manifest := NewManifest(destdir)
+
+	assert.NoError(extract(manifest, writeTestTar(assert, tmp,
+		listed,
+		testTarEntry{name: `one.txt`, data: `1`},
+		testTarEntry{name: `./lib/two.txt`, data: `22`},
+	), destdir, ExtractOptions{
+		FileCount: 2,
+		Size:      3,
+	}))
+
+	assert.EqualValues(2, manifest.FileCount)
+	assert.False(fileutil.FileExists(filepath.Join(destdir, ManifestFilename)))
+}
+
+func TestExtractBaselineBundle(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-extract-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	// bundles without a manifest of their own recorded the file count and size of the whole
+	// manifest they were made from, which needn't match what was actually bundled
+	entries := []testTarEntry{
+		{name: `lib`, typeflag: tar.TypeDir},
+		{name: `one.txt`, data: `1`},
+		{name: `lib/two.txt`, data: `22`},
+	}
+
+	destdir := filepath.Join(tmp, `out`)
+	manifest := NewManifest(destdir)
+
+	assert.NoError(extract(manifest, writeTestTar(assert, tmp, entries...), destdir, ExtractOptions{
+		FileCount: 5,
+		Size:      64,
+	}))
+
+	assert.EqualValues(2, manifest.FileCount)
+
+	// ...but they are still limits
+	err = extract(NewManifest(destdir), writeTestTar(assert, tmp, entries...), destdir, ExtractOptions{
+		FileCount: 1,
+	})
+
+	assert.True(IsExtractErr(err, TooManyFiles), "%v", err)
+
+	err = extract(NewManifest(destdir), writeTestTar(assert, tmp, entries...), destdir, ExtractOptions{
+		Size: 2,
+	})
+
+	assert.True(IsExtractErr(err, TooLarge), "%v", err)
+}
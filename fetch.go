@@ -0,0 +1,429 @@
+package hydra
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/convutil"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// Files are downloaded to a temporary name alongside their destination, and only moved into
+// place once they are complete and verified.  An interrupted download leaves this file behind,
+// and the next attempt resumes from wherever it left off.
+const PartialFileSuffix = `.part`
+
+var DefaultFetchConcurrency = 4
+var DefaultFetchRetries = 3
+var DefaultFetchRetryDelay = 500 * time.Millisecond
+
+// Describes how far along fetching the files in a manifest is.
+type FetchProgress struct {
+	File       string        `json:"file,omitempty"`
+	FilesDone  int           `json:"files_done"`
+	FilesTotal int           `json:"files_total"`
+	BytesDone  int64         `json:"bytes_done"`
+	BytesTotal int64         `json:"bytes_total"`
+	Elapsed    time.Duration `json:"elapsed"`
+}
+
+// Estimates how much longer the fetch will take based on the average transfer rate so far.
+func (self FetchProgress) ETA() time.Duration {
+	if self.BytesDone <= 0 || self.BytesDone >= self.BytesTotal || self.Elapsed <= 0 {
+		return 0
+	}
+
+	rate := float64(self.BytesDone) / self.Elapsed.Seconds()
+	remaining := float64(self.BytesTotal-self.BytesDone) / rate
+
+	return time.Duration(remaining * float64(time.Second)).Round(time.Second)
+}
+
+func (self FetchProgress) Done() bool {
+	return self.FilesDone >= self.FilesTotal
+}
+
+func (self FetchProgress) String() string {
+	out := fmt.Sprintf(
+		"%d/%d files, %v/%v",
+		self.FilesDone,
+		self.FilesTotal,
+		convutil.Bytes(self.BytesDone),
+		convutil.Bytes(self.BytesTotal),
+	)
+
+	if eta := self.ETA(); eta > 0 {
+		out += fmt.Sprintf(", ETA %v", eta)
+	}
+
+	return out
+}
+
+type ProgressFunc func(progress FetchProgress)
+
+type FetchOptions struct {
+	Concurrency  int           // number of files to download at once
+	Retries      int           // times to retry a failed download; zero is the default, negative disables retrying (see WithRetries)
+	RetryDelay   time.Duration // delay before the first retry, doubling after each attempt
+	OnProgress   ProgressFunc
+	Cache        *Cache     // if set, files are retrieved from (and added to) this cache
+	ArchiveLinks LinkPolicy // what to do with symbolic and hard links in archives
+	DeltaBase    string     // directory holding the previous build that deltas apply to; defaults to destdir
+}
+
+// Returns these options set to retry a failed download exactly n times, where n of zero (or
+// less) disables retrying rather than leaving the default in place.
+func (self FetchOptions) WithRetries(n int) FetchOptions {
+	if n <= 0 {
+		self.Retries = -1
+	} else {
+		self.Retries = n
+	}
+
+	return self
+}
+
+func (self FetchOptions) withDefaults() FetchOptions {
+	if self.Concurrency <= 0 {
+		self.Concurrency = DefaultFetchConcurrency
+	}
+
+	if self.Retries < 0 {
+		self.Retries = 0
+	} else if self.Retries == 0 {
+		self.Retries = DefaultFetchRetries
+	}
+
+	if self.RetryDelay <= 0 {
+		self.RetryDelay = DefaultFetchRetryDelay
+	}
+
+	return self
+}
+
+// accumulates progress from all of the fetch workers, reporting it as it changes.
+type fetchTracker struct {
+	sync.Mutex
+	progress   FetchProgress
+	perFile    map[string]int64
+	started    time.Time
+	onProgress ProgressFunc
+}
+
+func newFetchTracker(files ManifestFiles, onProgress ProgressFunc) *fetchTracker {
+	return &fetchTracker{
+		progress: FetchProgress{
+			FilesTotal: len(files),
+			BytesTotal: int64(files.TotalSize()),
+		},
+		perFile:    make(map[string]int64),
+		started:    time.Now(),
+		onProgress: onProgress,
+	}
+}
+
+// records that the given number of bytes of a file have been written so far.
+func (self *fetchTracker) update(file string, written int64) {
+	self.Lock()
+	defer self.Unlock()
+
+	self.progress.BytesDone += written - self.perFile[file]
+	self.perFile[file] = written
+	self.progress.File = file
+	self.report()
+}
+
+func (self *fetchTracker) done(file string) {
+	self.Lock()
+	defer self.Unlock()
+
+	self.progress.FilesDone += 1
+	self.progress.File = file
+	self.report()
+}
+
+func (self *fetchTracker) report() {
+	if self.onProgress != nil {
+		self.progress.Elapsed = time.Since(self.started)
+		self.onProgress(self.progress)
+	}
+}
+
+type progressReader struct {
+	io.Reader
+	onRead func(n int)
+}
+
+func (self *progressReader) Read(p []byte) (int, error) {
+	n, err := self.Reader.Read(p)
+
+	if n > 0 {
+		self.onRead(n)
+	}
+
+	return n, err
+}
+
+// Retrieves any files in this manifest that are missing or invalid in destdir, using a pool of
+// concurrent workers.  Failed downloads are retried with exponential backoff, resuming from
+// where they left off when the source supports it.  Files already in the cache (if one is
+// given) are taken from there instead of being downloaded.  If any TrustedKeys are configured, nothing
+// is fetched unless the manifest carries a valid signature from one of them.
+//
+// If the manifest lists Deltas and one of them applies to the build already in destdir (or
+// options.DeltaBase), only that delta is downloaded and applied.  Should that fail for any reason,
+// the manifest is fetched as usual.
+func (self *Manifest) FetchWithOptions(srcroot string, destdir string, options FetchOptions) error {
+	var toFetch ManifestFiles
+
+	if err := self.verifyTrusted(); err != nil {
+		return err
+	}
+
+	options = options.withDefaults()
+
+	if len(self.Deltas) > 0 {
+		if err := self.applyDelta(srcroot, destdir, options); err != nil {
+			log.Infof("not applying delta: %v", err)
+		}
+	}
+
+	for _, file := range self.Files() {
+		if file.skipValidate {
+			continue
+		} else if err := file.validate(destdir); err != nil {
+			toFetch = append(toFetch, file)
+		}
+	}
+
+	if len(toFetch) > 0 {
+		log.Infof("fetching %d files (%v) into %s", len(toFetch), toFetch.TotalSize(), destdir)
+
+		var wg sync.WaitGroup
+		var errlock sync.Mutex
+		var errs []error
+		var queue = make(chan *ManifestFile)
+		var tracker = newFetchTracker(toFetch, options.OnProgress)
+
+		for i := 0; i < options.Concurrency && i < len(toFetch); i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for file := range queue {
+					if err := file.download(srcroot, destdir, options, tracker); err == nil {
+						tracker.done(file.Name)
+					} else {
+						errlock.Lock()
+						errs = append(errs, err)
+						errlock.Unlock()
+					}
+				}
+			}()
+		}
+
+		for _, file := range toFetch {
+			queue <- file
+		}
+
+		close(queue)
+		wg.Wait()
+
+		if options.Cache != nil && options.Cache.MaxSize > 0 {
+			if _, err := options.Cache.Prune(options.Cache.MaxSize); err != nil {
+				log.Warningf("fetch: %v", err)
+			}
+		}
+
+		if len(errs) > 0 {
+			for _, err := range errs[1:] {
+				log.Errorf("fetch: %v", err)
+			}
+
+			return errs[0]
+		}
+
+		// archives add their contents to the manifest, so they are extracted one at a time
+		for _, file := range toFetch {
+			if file.Archive {
+				dest := file.destination(destdir)
+				log.Debugf("extracting archive: %s -> %s", dest, destdir)
+
+				if err := extract(self, dest, destdir, ExtractOptions{
+					Links:     options.ArchiveLinks,
+					FileCount: file.ArchiveFileCount,
+					Size:      file.UncompressedSize,
+				}); err == nil {
+					file.skipValidate = true
+				} else {
+					return fmt.Errorf("%s: extract: %w", file.Name, err)
+				}
+			}
+		}
+	}
+
+	for _, file := range self.Files() {
+		if file.skipValidate {
+			continue
+		}
+
+		if err := file.validate(destdir); err != nil {
+			os.Remove(file.destination(destdir))
+			return fmt.Errorf("%s: invalid file: %v", file.destination(destdir), err)
+		}
+	}
+
+	return nil
+}
+
+// returns the location this file should be retrieved from, given the manifest's source root.
+func (self *ManifestFile) uri(root string) string {
+	if strings.Contains(self.Name, `://`) {
+		return self.Name
+	} else if strings.Contains(root, `://`) {
+		if u, err := url.Parse(root); err == nil {
+			return resolveURL(u, self.Name).String()
+		}
+	}
+
+	return filepath.Join(root, self.Name)
+}
+
+// returns the path this file is written to in the given directory.
+func (self *ManifestFile) destination(destdir string) string {
+	if strings.Contains(self.Name, `://`) {
+		if u, err := url.Parse(self.Name); err == nil {
+			return filepath.Join(destdir, path.Base(u.Path))
+		}
+	}
+
+	return filepath.Join(destdir, self.Name)
+}
+
+// retrieves this file into destdir, retrying with exponential backoff.
+func (self *ManifestFile) download(srcroot string, destdir string, options FetchOptions, tracker *fetchTracker) error {
+	var err error
+	var uri = self.uri(srcroot)
+	var dest = self.destination(destdir)
+	var delay = options.RetryDelay
+
+	if fileutil.SameFile(uri, dest) {
+		return nil
+	}
+
+	if options.Cache != nil {
+		if err := options.Cache.Get(self.SHA256, dest); err == nil {
+			log.Debugf("  using cached %s", self.Name)
+			tracker.update(self.Name, self.Size)
+			return nil
+		}
+	}
+
+	for attempt := 0; attempt <= options.Retries; attempt++ {
+		if attempt > 0 {
+			log.Warningf("%s: %v (retrying in %v)", self.Name, err, delay)
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		log.Debugf("fetching file: %s", uri)
+
+		if err = self.downloadOnce(uri, dest, tracker); err == nil {
+			if options.Cache != nil {
+				if err := options.Cache.Put(self.SHA256, dest); err != nil {
+					log.Warningf("%s: %v", self.Name, err)
+				}
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: retrieve: %v", self.Name, err)
+}
+
+func (self *ManifestFile) downloadOnce(uri string, dest string, tracker *fetchTracker) error {
+	var partial = dest + PartialFileSuffix
+	var offset int64
+
+	if stat, err := os.Stat(partial); err == nil {
+		if self.Size <= 0 || stat.Size() < self.Size {
+			offset = stat.Size()
+		}
+	}
+
+	if u, err := url.Parse(uri); err != nil {
+		return fmt.Errorf("uri: %v", err)
+	} else if res, err := Fetch(&FetchRequest{
+		URL:    u,
+		Offset: offset,
+	}); err == nil {
+		var rc = res.Body
+		var resumed = res.Resumed
+
+		defer rc.Close()
+
+		var flags = os.O_CREATE | os.O_WRONLY
+
+		if resumed {
+			log.Debugf("  resuming %s at %v", self.Name, convutil.Bytes(offset))
+			flags |= os.O_APPEND
+		} else {
+			flags |= os.O_TRUNC
+			offset = 0
+		}
+
+		if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+			return err
+		}
+
+		if file, err := os.OpenFile(partial, flags, 0644); err == nil {
+			defer file.Close()
+
+			var written = offset
+
+			tracker.update(self.Name, written)
+
+			if _, err := io.Copy(file, &progressReader{
+				Reader: rc,
+				onRead: func(n int) {
+					written += int64(n)
+					tracker.update(self.Name, written)
+				},
+			}); err != nil {
+				return fmt.Errorf("write: %v", err)
+			}
+
+			if err := file.Close(); err != nil {
+				return fmt.Errorf("write: %v", err)
+			}
+		} else {
+			return fmt.Errorf("write: %v", err)
+		}
+	} else {
+		return err
+	}
+
+	// a complete file that doesn't match can't be resumed, so start over next time
+	if self.SHA256 != `` {
+		if err := checkSHA256(partial, self.SHA256); err != nil {
+			if err == ErrChecksumMismatch {
+				os.Remove(partial)
+			}
+
+			return err
+		}
+	}
+
+	log.Debugf("  writing file to: %s", dest)
+	return os.Rename(partial, dest)
+}
@@ -0,0 +1,200 @@
+package hydra
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+type testFileServer struct {
+	sync.Mutex
+	files    map[string][]byte
+	failures map[string]int
+	ranges   []string
+}
+
+func (self *testFileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	self.Lock()
+	name := strings.TrimPrefix(req.URL.Path, `/`)
+	data, ok := self.files[name]
+
+	if rng := req.Header.Get(`Range`); rng != `` {
+		self.ranges = append(self.ranges, name+` `+rng)
+	}
+
+	if self.failures[name] > 0 {
+		self.failures[name] -= 1
+		self.Unlock()
+		http.Error(w, `try again`, http.StatusServiceUnavailable)
+		return
+	}
+
+	self.Unlock()
+
+	if ok {
+		http.ServeContent(w, req, name, time.Time{}, bytes.NewReader(data))
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+func (self *testFileServer) manifest() *Manifest {
+	manifest := NewManifest(``)
+
+	for name, data := range self.files {
+		sum := sha256.Sum256(data)
+
+		manifest.Assets = append(manifest.Assets, &ManifestFile{
+			Name:   name,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+
+		manifest.FileCount += 1
+		manifest.TotalSize += int64(len(data))
+	}
+
+	return manifest
+}
+
+func TestFetchParallel(t *testing.T) {
+	assert := require.New(t)
+	files := &testFileServer{
+		files: make(map[string][]byte),
+		failures: map[string]int{
+			`assets/flaky.txt`: 2,
+		},
+	}
+
+	for i := 0; i < 8; i++ {
+		files.files[fmt.Sprintf("assets/file%d.txt", i)] = bytes.Repeat([]byte{byte('a' + i)}, 1024*(i+1))
+	}
+
+	files.files[`assets/flaky.txt`] = []byte(`eventually`)
+
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	destdir, err := ioutil.TempDir(``, `hydra-fetch-`)
+	assert.NoError(err)
+	defer os.RemoveAll(destdir)
+
+	var last FetchProgress
+	var updates int
+
+	manifest := files.manifest()
+
+	assert.NoError(manifest.FetchWithOptions(server.URL+`/`, destdir, FetchOptions{
+		Concurrency: 3,
+		RetryDelay:  time.Millisecond,
+		OnProgress: func(progress FetchProgress) {
+			updates += 1
+			last = progress
+		},
+	}))
+
+	for name, data := range files.files {
+		actual, err := ioutil.ReadFile(filepath.Join(destdir, name))
+		assert.NoError(err)
+		assert.Equal(data, actual)
+		assert.False(fileutil.FileExists(filepath.Join(destdir, name+PartialFileSuffix)))
+	}
+
+	assert.True(updates > 0)
+	assert.True(last.Done())
+	assert.Equal(len(files.files), last.FilesTotal)
+	assert.Equal(manifest.TotalSize, last.BytesDone)
+	assert.Equal(manifest.TotalSize, last.BytesTotal)
+
+	// a file that keeps failing gives up after the configured retries
+	files.failures[`assets/flaky.txt`] = 10
+	os.Remove(filepath.Join(destdir, `assets/flaky.txt`))
+
+	assert.Error(manifest.FetchWithOptions(server.URL+`/`, destdir, FetchOptions{
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	}))
+
+	assert.Equal(7, files.failures[`assets/flaky.txt`])
+
+	// ...and asking for no retries means exactly that
+	assert.Error(manifest.FetchWithOptions(server.URL+`/`, destdir, FetchOptions{
+		RetryDelay: time.Millisecond,
+	}.WithRetries(0)))
+
+	assert.Equal(6, files.failures[`assets/flaky.txt`])
+
+	assert.Error(manifest.FetchWithOptions(server.URL+`/`, destdir, FetchOptions{
+		RetryDelay: time.Millisecond,
+	}.WithRetries(1)))
+
+	assert.Equal(4, files.failures[`assets/flaky.txt`])
+}
+
+func TestFetchResume(t *testing.T) {
+	assert := require.New(t)
+	data := bytes.Repeat([]byte(`0123456789`), 1000)
+	files := &testFileServer{
+		files: map[string][]byte{
+			`big.bin`: data,
+		},
+	}
+
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	destdir, err := ioutil.TempDir(``, `hydra-fetch-`)
+	assert.NoError(err)
+	defer os.RemoveAll(destdir)
+
+	// simulate an interrupted download
+	_, err = fileutil.WriteFile(data[:4000], filepath.Join(destdir, `big.bin`+PartialFileSuffix))
+	assert.NoError(err)
+
+	assert.NoError(files.manifest().Fetch(server.URL, destdir))
+	assert.Equal([]string{`big.bin bytes=4000-`}, files.ranges)
+
+	actual, err := ioutil.ReadFile(filepath.Join(destdir, `big.bin`))
+	assert.NoError(err)
+	assert.Equal(data, actual)
+
+	// a corrupt partial file is discarded rather than completed
+	_, err = fileutil.WriteFile(`garbage`, filepath.Join(destdir, `big.bin`+PartialFileSuffix))
+	assert.NoError(err)
+	os.Remove(filepath.Join(destdir, `big.bin`))
+
+	assert.NoError(files.manifest().FetchWithOptions(server.URL, destdir, FetchOptions{
+		RetryDelay: time.Millisecond,
+	}))
+
+	actual, err = ioutil.ReadFile(filepath.Join(destdir, `big.bin`))
+	assert.NoError(err)
+	assert.Equal(data, actual)
+}
+
+func TestFetchProgressETA(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(10*time.Second, FetchProgress{
+		BytesDone:  100,
+		BytesTotal: 200,
+		Elapsed:    10 * time.Second,
+	}.ETA())
+
+	assert.Equal(time.Duration(0), FetchProgress{
+		BytesTotal: 200,
+	}.ETA())
+}
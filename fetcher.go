@@ -0,0 +1,220 @@
+package hydra
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+)
+
+// Describes a resource to retrieve from a Fetcher.
+type FetchRequest struct {
+	URL    *url.URL
+	Offset int64  // start this many bytes in, if the source is able to
+	ETag   string // if the resource still matches this, ErrNotModified is returned instead
+}
+
+// The result of a successful FetchRequest.  The caller must close Body.
+type FetchResponse struct {
+	Filename    string
+	Body        io.ReadCloser
+	Resumed     bool   // whether Body starts at the requested offset rather than the beginning
+	ETag        string // identifies this version of the resource, if the source can tell
+	ContentType string // the MIME type of the resource, if the source can tell
+}
+
+// A Fetcher retrieves resources from one kind of source, identified by URL scheme.
+type Fetcher interface {
+	Fetch(request *FetchRequest) (*FetchResponse, error)
+}
+
+// Fetchers whose URLs don't locate resources by path alone (e.g. git, which names the file in
+// the fragment) implement this to control how relative names are resolved against them.
+type URLResolver interface {
+	Resolve(base *url.URL, name string) *url.URL
+}
+
+type FetcherFunc func(request *FetchRequest) (*FetchResponse, error)
+
+func (self FetcherFunc) Fetch(request *FetchRequest) (*FetchResponse, error) {
+	return self(request)
+}
+
+var fetchers = make(map[string]Fetcher)
+var fetchersLock sync.RWMutex
+
+// Makes the given fetcher responsible for URLs with the given scheme, replacing any fetcher
+// previously registered for it.  Registering a nil fetcher removes support for the scheme.
+func RegisterFetcher(scheme string, fetcher Fetcher) {
+	fetchersLock.Lock()
+	defer fetchersLock.Unlock()
+
+	if fetcher == nil {
+		delete(fetchers, strings.ToLower(scheme))
+	} else {
+		fetchers[strings.ToLower(scheme)] = fetcher
+	}
+}
+
+// Returns the fetcher registered for the given scheme.
+func GetFetcher(scheme string) (Fetcher, bool) {
+	fetchersLock.RLock()
+	defer fetchersLock.RUnlock()
+
+	fetcher, ok := fetchers[strings.ToLower(scheme)]
+	return fetcher, ok
+}
+
+// Returns the schemes that fetchers are registered for, sorted.
+func FetcherSchemes() (schemes []string) {
+	fetchersLock.RLock()
+	defer fetchersLock.RUnlock()
+
+	for scheme := range fetchers {
+		if scheme != `` {
+			schemes = append(schemes, scheme)
+		}
+	}
+
+	sort.Strings(schemes)
+	return
+}
+
+// Retrieves a resource using the fetcher registered for the scheme of its URL.
+func Fetch(request *FetchRequest) (*FetchResponse, error) {
+	if fetcher, ok := GetFetcher(request.URL.Scheme); ok {
+		return fetcher.Fetch(request)
+	} else {
+		return nil, fmt.Errorf("unsupported scheme %q", request.URL.Scheme)
+	}
+}
+
+// resolves name relative to the directory-like location base.  A name of ".." yields the
+// location containing base.
+func resolveURL(base *url.URL, name string) *url.URL {
+	if fetcher, ok := GetFetcher(base.Scheme); ok {
+		if resolver, ok := fetcher.(URLResolver); ok {
+			return resolver.Resolve(base, name)
+		}
+	}
+
+	resolved := *base
+	resolved.Path = path.Join(base.Path, filepath.ToSlash(name))
+	return &resolved
+}
+
+func fetch(uri string) (string, io.ReadCloser, error) {
+	if u, err := url.Parse(uri); err == nil {
+		if res, err := Fetch(&FetchRequest{
+			URL: u,
+		}); err == nil {
+			return res.Filename, res.Body, nil
+		} else {
+			return ``, nil, err
+		}
+	} else {
+		return ``, nil, fmt.Errorf("uri: %v", err)
+	}
+}
+
+// retrieves resources over HTTP, resuming with Range requests.
+type httpFetcher struct{}
+
+func (self httpFetcher) Fetch(request *FetchRequest) (*FetchResponse, error) {
+	if req, err := http.NewRequest(http.MethodGet, request.URL.String(), nil); err == nil {
+		if request.Offset > 0 {
+			req.Header.Set(`Range`, fmt.Sprintf("bytes=%d-", request.Offset))
+		}
+
+		if request.ETag != `` {
+			req.Header.Set(`If-None-Match`, request.ETag)
+		}
+
+		return doFetch(Client, req, request)
+	} else {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+}
+
+// performs an HTTP request on behalf of a fetcher, handling the status codes of ranged and
+// conditional requests.
+func doFetch(client *http.Client, req *http.Request, request *FetchRequest) (*FetchResponse, error) {
+	if res, err := client.Do(req); err == nil {
+		var response = &FetchResponse{
+			Filename: path.Base(req.URL.Path),
+			Body:     res.Body,
+			ETag:     res.Header.Get(`ETag`),
+
+			ContentType: res.Header.Get(`Content-Type`),
+		}
+
+		switch {
+		case res.StatusCode == http.StatusNotModified:
+			res.Body.Close()
+			return nil, ErrNotModified
+		case res.StatusCode == http.StatusPartialContent && request.Offset > 0:
+			response.Resumed = true
+		case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && request.Offset > 0:
+			res.Body.Close()
+			req.Header.Del(`Range`)
+			return doFetch(client, req, &FetchRequest{URL: request.URL, ETag: request.ETag})
+		case res.StatusCode >= 400:
+			res.Body.Close()
+			return nil, fmt.Errorf("http: HTTP %v", res.Status)
+		}
+
+		return response, nil
+	} else {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+}
+
+// reads local files.
+type fileFetcher struct{}
+
+func (self fileFetcher) Fetch(request *FetchRequest) (*FetchResponse, error) {
+	filename := fileutil.MustExpandUser(
+		filepath.Join(request.URL.Host, request.URL.Path),
+	)
+
+	if f, err := os.Open(filename); err == nil {
+		var response = &FetchResponse{
+			Filename: filepath.Base(filename),
+			Body:     f,
+			ETag:     fileETag(f),
+		}
+
+		if request.ETag != `` && request.ETag == response.ETag {
+			f.Close()
+			return nil, ErrNotModified
+		}
+
+		if request.Offset > 0 {
+			if _, err := f.Seek(request.Offset, io.SeekStart); err == nil {
+				response.Resumed = true
+			} else {
+				f.Close()
+				return nil, fmt.Errorf("file: %v", err)
+			}
+		}
+
+		return response, nil
+	} else {
+		return nil, fmt.Errorf("file: %v", err)
+	}
+}
+
+func init() {
+	RegisterFetcher(`http`, httpFetcher{})
+	RegisterFetcher(`https`, httpFetcher{})
+	RegisterFetcher(`file`, fileFetcher{})
+	RegisterFetcher(``, fileFetcher{})
+}
@@ -10,6 +10,7 @@ type Function struct {
 	Name       string   `yaml:"name"       json:"name"`
 	Arguments  []string `yaml:"args"       json:"args"`
 	Definition string   `yaml:"definition" json:"definition"`
+	origin     *SourcePosition
 }
 
 func (self *Function) Validate() error {
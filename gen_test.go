@@ -1,11 +1,75 @@
 package hydra
 
 import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghetzel/go-stockutil/fileutil"
 	"github.com/ghetzel/testify/require"
 )
 
+var updateGolden = flag.Bool(`update`, false, `Regenerate the expected output of the golden-file tests.`)
+
+// the generated files that are compared against the golden copies (the builtin Hydra
+// module is omitted, as it is not derived from the test inputs)
+func isGoldenFile(name string) bool {
+	switch filepath.Base(name) {
+	case `Hydra.qml`:
+		return false
+	case `qmldir`, AppQrcFile:
+		return true
+	default:
+		return (filepath.Ext(name) == `.qml`)
+	}
+}
+
+func goldenFiles(root string) (files []string, err error) {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			if !info.IsDir() && isGoldenFile(path) {
+				if rel, err := filepath.Rel(root, path); err == nil {
+					files = append(files, rel)
+				} else {
+					return err
+				}
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	})
+
+	sort.Strings(files)
+	return
+}
+
+// copies the files from a directory under testdata into the given directory
+func copyTestdata(t *testing.T, from string, into string) {
+	require.NoError(t, filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			if rel, err := filepath.Rel(from, path); err == nil {
+				if data, err := ioutil.ReadFile(path); err == nil {
+					_, err = fileutil.WriteFile(data, filepath.Join(into, rel))
+					return err
+				} else {
+					return err
+				}
+			} else {
+				return err
+			}
+		}
+
+		return err
+	}))
+}
+
 func TestGenerateBasic(t *testing.T) {
 	assert := require.New(t)
 
@@ -15,5 +79,132 @@ func TestGenerateBasic(t *testing.T) {
 	win.Set(`visible`, true)
 	win.Set(`color`, `#FF00CC`)
 
-	assert.Equal("ApplicationWindow {\n  visible: true;\n  color: \"#FF00CC\";\n}", win.String())
+	assert.Equal("ApplicationWindow {\n  visible: true\n  color: \"#FF00CC\"\n}", win.String())
+}
+
+// Each directory in testdata/generate contains a "src" directory holding an app.yaml (and any
+// modules it uses), and a "golden" directory containing the expected QML, qmldir, and app.qrc
+// output.  Run "go test -update" to regenerate the golden files.
+func TestGenerateGolden(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join(`testdata`, `generate`, `*`))
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+
+	for _, dir := range cases {
+		dir := dir
+
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			assert := require.New(t)
+			golden := filepath.Join(dir, `golden`)
+			outdir, err := ioutil.TempDir(``, `hydra-golden-`)
+			assert.NoError(err)
+			defer os.RemoveAll(outdir)
+
+			app := new(Application)
+
+			assert.NoError(FromFile(app, filepath.Join(dir, `src`, EntrypointFilename)))
+			assert.NoError(app.Generate(GenerateOptions{
+				DestDir: outdir,
+			}))
+
+			actual, err := goldenFiles(outdir)
+			assert.NoError(err)
+			assert.NotEmpty(actual)
+
+			if *updateGolden {
+				assert.NoError(os.RemoveAll(golden))
+
+				for _, name := range actual {
+					data, err := ioutil.ReadFile(filepath.Join(outdir, name))
+					assert.NoError(err)
+
+					_, err = fileutil.WriteFile(data, filepath.Join(golden, name))
+					assert.NoError(err)
+				}
+
+				return
+			}
+
+			expected, err := goldenFiles(golden)
+			assert.NoError(err)
+			assert.Equal(expected, actual, "generated file list differs from %s", golden)
+
+			for _, name := range expected {
+				want, err := ioutil.ReadFile(filepath.Join(golden, name))
+				assert.NoError(err)
+
+				got, err := ioutil.ReadFile(filepath.Join(outdir, name))
+				assert.NoError(err)
+
+				assert.Equal(string(want), string(got), "%s differs (run with -update to regenerate)", strings.TrimPrefix(name, outdir))
+			}
+		})
+	}
+}
+
+func TestGenerateIncremental(t *testing.T) {
+	assert := require.New(t)
+	tmp, err := ioutil.TempDir(``, `hydra-incremental-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcDir := filepath.Join(tmp, `src`)
+	outDir := filepath.Join(tmp, `out`)
+	copyTestdata(t, filepath.Join(`testdata`, `generate`, `signals`, `src`), srcDir)
+
+	generate := func(incremental bool) {
+		app := new(Application)
+
+		assert.NoError(FromFile(app, filepath.Join(srcDir, EntrypointFilename)))
+		assert.NoError(app.Generate(GenerateOptions{
+			DestDir:     outDir,
+			Incremental: incremental,
+		}))
+	}
+
+	modtimes := func() map[string]time.Time {
+		times := make(map[string]time.Time)
+
+		for _, name := range []string{`app.qml`, `qmldir`, AppQrcFile, ManifestFilename, `lib/Toggle.qml`, `main.cpp`} {
+			stat, err := os.Stat(filepath.Join(outDir, name))
+			assert.NoError(err)
+			times[name] = stat.ModTime()
+		}
+
+		return times
+	}
+
+	generate(false)
+	before := modtimes()
+
+	// simulate the output of a previous build
+	_, err = fileutil.WriteFile(`obj`, filepath.Join(outDir, `qt`, `obj`, `main.o`))
+	assert.NoError(err)
+	_, err = fileutil.WriteFile(`all:`, filepath.Join(outDir, `Makefile`))
+	assert.NoError(err)
+
+	time.Sleep(10 * time.Millisecond)
+	generate(true)
+
+	assert.Equal(before, modtimes())
+	assert.FileExists(filepath.Join(outDir, `qt`, `obj`, `main.o`))
+
+	qrc, err := ioutil.ReadFile(filepath.Join(outDir, AppQrcFile))
+	assert.NoError(err)
+	assert.NotContains(string(qrc), `qt/obj`)
+	assert.NotContains(string(qrc), `Makefile`)
+	assert.NotContains(string(qrc), `main.cpp`)
+
+	// files no longer in the manifest are removed, along with what was generated from them
+	assert.NoError(os.Remove(filepath.Join(srcDir, `lib`, `Toggle.yaml`)))
+	_, err = fileutil.WriteFile("definition:\n  type: Item\n", filepath.Join(srcDir, EntrypointFilename))
+	assert.NoError(err)
+
+	generate(true)
+
+	for _, name := range []string{`Toggle.yaml`, `Toggle.qml`, `Toggle.qml` + SourceMapSuffix, `qmldir`} {
+		assert.False(fileutil.FileExists(filepath.Join(outDir, `lib`, name)), "lib/%s should have been removed", name)
+	}
+
+	assert.FileExists(filepath.Join(outDir, `qt`, `obj`, `main.o`))
 }
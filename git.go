@@ -0,0 +1,230 @@
+package hydra
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/stringutil"
+)
+
+// Retrieves files from git repositories, addressed as git+<transport>://<repository>#<ref>:<path>
+// (e.g. git+https://github.com/example/kiosk.git#v1.2:apps/lobby/app.yaml).  Without a ref,
+// the repository's HEAD is used.  Repositories are fetched (shallowly, and only the refs asked
+// for) into bare clones under CacheDir using the git command.
+type GitFetcher struct {
+	Command  string        // the git executable
+	CacheDir string        // where repositories are cloned to
+	MaxAge   time.Duration // how long a ref is trusted before it is fetched again
+	commits  map[string]gitCommit
+	lock     sync.Mutex
+}
+
+type gitCommit struct {
+	ID        string
+	FetchedAt time.Time
+}
+
+func NewGitFetcher() *GitFetcher {
+	return &GitFetcher{
+		Command:  executil.Env(`HYDRA_GIT`, `git`),
+		CacheDir: filepath.Join(os.TempDir(), `hydra-git`),
+		MaxAge:   10 * time.Second,
+		commits:  make(map[string]gitCommit),
+	}
+}
+
+func (self *GitFetcher) Fetch(request *FetchRequest) (*FetchResponse, error) {
+	repo, ref, file := parseGitURL(request.URL)
+
+	if file == `` {
+		return nil, fmt.Errorf("git: no file given in %q (expected #<ref>:<path>)", request.URL.String())
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if repodir, commit, err := self.resolve(repo, ref); err == nil {
+		if blob, err := self.git(repodir, `rev-parse`, commit+`:`+file); err == nil {
+			var response = &FetchResponse{
+				Filename: path.Base(file),
+				ETag:     blob,
+			}
+
+			if request.ETag != `` && request.ETag == response.ETag {
+				return nil, ErrNotModified
+			}
+
+			cmd := exec.Command(self.Command, `-C`, repodir, `cat-file`, `blob`, blob)
+
+			if stdout, err := cmd.StdoutPipe(); err == nil {
+				if err := cmd.Start(); err != nil {
+					return nil, fmt.Errorf("git: %v", err)
+				}
+
+				response.Body = &commandReader{
+					cmd:    cmd,
+					stdout: stdout,
+				}
+
+				// there's no seeking in a pipe, but skipping ahead is cheap enough locally
+				if request.Offset > 0 {
+					if _, err := io.CopyN(ioutil.Discard, response.Body, request.Offset); err == nil {
+						response.Resumed = true
+					} else {
+						response.Body.Close()
+						return nil, fmt.Errorf("git: %v", err)
+					}
+				}
+
+				return response, nil
+			} else {
+				return nil, fmt.Errorf("git: %v", err)
+			}
+		} else {
+			return nil, fmt.Errorf("git: %s: %v", file, err)
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Resolves name against the directory named in the fragment of a git URL.
+func (self *GitFetcher) Resolve(base *url.URL, name string) *url.URL {
+	var resolved = *base
+	var ref, dir = splitGitFragment(base.Fragment)
+
+	resolved.Fragment = ref + `:` + strings.TrimPrefix(path.Join(dir, filepath.ToSlash(name)), `/`)
+	return &resolved
+}
+
+// returns the bare clone of the repository and the commit the ref points to, fetching it if it
+// hasn't been recently.
+func (self *GitFetcher) resolve(repo string, ref string) (string, string, error) {
+	var key = repo + `#` + ref
+	var id = sha256.Sum256([]byte(repo))
+	var repodir = filepath.Join(self.CacheDir, hex.EncodeToString(id[:8]))
+
+	// refs come straight from the URL, so they mustn't be mistaken for options
+	if strings.HasPrefix(ref, `-`) {
+		return ``, ``, fmt.Errorf("git: invalid ref %q", ref)
+	}
+
+	if commit, ok := self.commits[key]; ok && time.Since(commit.FetchedAt) < self.MaxAge {
+		return repodir, commit.ID, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(repodir, `HEAD`)); os.IsNotExist(err) {
+		if _, err := self.git(``, `init`, `--quiet`, `--bare`, repodir); err != nil {
+			return ``, ``, fmt.Errorf("git: %v", err)
+		}
+	}
+
+	if _, err := self.git(repodir, `fetch`, `--quiet`, `--depth`, `1`, `--end-of-options`, repo, ref); err != nil {
+		return ``, ``, fmt.Errorf("git: fetch %s %s: %v", repo, ref, err)
+	}
+
+	if commit, err := self.git(repodir, `rev-parse`, `FETCH_HEAD`); err == nil {
+		self.commits[key] = gitCommit{
+			ID:        commit,
+			FetchedAt: time.Now(),
+		}
+
+		return repodir, commit, nil
+	} else {
+		return ``, ``, fmt.Errorf("git: %v", err)
+	}
+}
+
+// runs git (in the given repository, if any) and returns its trimmed output.
+func (self *GitFetcher) git(repodir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	if repodir != `` {
+		args = append([]string{`-C`, repodir}, args...)
+	}
+
+	cmd := exec.Command(self.Command, args...)
+	cmd.Stderr = &stderr
+
+	if out, err := cmd.Output(); err == nil {
+		return strings.TrimSpace(string(out)), nil
+	} else if msg := strings.TrimSpace(stderr.String()); msg != `` {
+		return ``, fmt.Errorf("%s", msg)
+	} else {
+		return ``, err
+	}
+}
+
+// splits a git+<transport>:// URL into the repository URL, the ref and the path of the file.
+func parseGitURL(u *url.URL) (string, string, string) {
+	var repo = *u
+	var ref, file = splitGitFragment(u.Fragment)
+
+	repo.Scheme = strings.TrimPrefix(u.Scheme, `git+`)
+	repo.Fragment = ``
+
+	return repo.String(), sliceutil.OrString(ref, `HEAD`), strings.TrimPrefix(file, `/`)
+}
+
+// splits a <ref>:<path> fragment; a fragment without a colon is taken to be just the path.
+func splitGitFragment(fragment string) (string, string) {
+	if strings.Contains(fragment, `:`) {
+		return stringutil.SplitPair(fragment, `:`)
+	}
+
+	return ``, fragment
+}
+
+// reads the output of a running command, reporting a failed exit as an error once the output is
+// exhausted.
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	done   bool
+}
+
+func (self *commandReader) Read(p []byte) (int, error) {
+	n, err := self.stdout.Read(p)
+
+	if err == io.EOF && !self.done {
+		self.done = true
+
+		if werr := self.cmd.Wait(); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+func (self *commandReader) Close() error {
+	if !self.done {
+		self.done = true
+		self.cmd.Process.Kill()
+		self.cmd.Wait()
+	}
+
+	return nil
+}
+
+func init() {
+	var git = NewGitFetcher()
+
+	for _, transport := range []string{`https`, `http`, `ssh`, `file`} {
+		RegisterFetcher(`git+`+transport, git)
+	}
+}
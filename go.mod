@@ -3,9 +3,15 @@ module github.com/ghetzel/hydra
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/ghetzel/cli v1.17.0
 	github.com/ghetzel/diecast v1.16.2
 	github.com/ghetzel/go-stockutil v1.8.35
 	github.com/ghetzel/testify v1.4.1
+	github.com/klauspost/compress v1.11.13
+	github.com/ulikunitz/xz v0.5.11
+	golang.org/x/sys v0.7.0 // indirect
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
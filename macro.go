@@ -0,0 +1,488 @@
+package hydra
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/maputil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// The slot that the components given to a template (under components:) are placed in.
+const DefaultSlot = `default`
+
+// How many templates can be expanded within one another before giving up (and assuming one of
+// them uses itself).
+var MaxTemplateDepth = 16
+
+var rxTemplateParam = regexp.MustCompile(`\$\(([\w\-]+)\)`)
+
+// A ComponentTemplate is a reusable piece of a component tree, declared under a module's
+// templates: and stamped out wherever a component says "use: <name>".  Unlike a module, which
+// becomes a QML type of its own, a template is expanded into the YAML that uses it before any
+// QML is generated.
+//
+// Parameters are given by the component using the template (under with:), and are referred to
+// in the definition as $(name).  A value that is nothing but a parameter takes on the
+// parameter's value (whatever its type), otherwise the parameter is substituted as a string.
+// Components declared with "slot: <name>" are placeholders for the components the template is
+// given: those under components: go in the "default" slot, and those for any others under
+// slots:.  A placeholder's own components are used when its slot is left empty.
+type ComponentTemplate struct {
+	Params     map[string]*TemplateParam `yaml:"params,omitempty" json:"params,omitempty"`
+	Definition yaml.MapSlice             `yaml:"definition"       json:"definition"`
+}
+
+// Describes a parameter of a ComponentTemplate.  If given, Type is one of string, number, bool,
+// list or map.
+type TemplateParam struct {
+	Type        string      `yaml:"type,omitempty"        json:"type,omitempty"`
+	Default     interface{} `yaml:"default,omitempty"     json:"default,omitempty"`
+	Required    bool        `yaml:"required,omitempty"    json:"required,omitempty"`
+	Description string      `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// reports whether the given value is of the named parameter type.  Null is any type.
+func isTemplateParamType(kind string, value interface{}) (bool, error) {
+	switch kind {
+	case ``, `string`, `number`, `bool`, `list`, `map`:
+		if value == nil {
+			return true, nil
+		}
+	default:
+		return false, fmt.Errorf("unknown parameter type %q (must be string, number, bool, list or map)", kind)
+	}
+
+	switch rv := reflect.ValueOf(value); kind {
+	case `string`:
+		return (rv.Kind() == reflect.String), nil
+	case `number`:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true, nil
+		default:
+			return false, nil
+		}
+	case `bool`:
+		return (rv.Kind() == reflect.Bool), nil
+	case `list`:
+		return typeutil.IsArray(value), nil
+	case `map`:
+		return typeutil.IsMap(value), nil
+	default:
+		return true, nil
+	}
+}
+
+// Expands every component that uses a template in this module's definition (and those of its
+// inline modules, which can use this module's templates as well as their own).
+func (self *Module) expandTemplates() error {
+	v := &validator{
+		filename: self.sourceFile,
+	}
+
+	v.expandModule(self, self.sourceNode, nil)
+
+	return v.diagnostics.err()
+}
+
+func (self *validator) expandModule(mod *Module, node *yamlv3.Node, inherited map[string]*ComponentTemplate) {
+	var templates = make(map[string]*ComponentTemplate)
+
+	for name, tmpl := range inherited {
+		templates[name] = tmpl
+	}
+
+	for _, name := range maputil.StringKeys(mod.Templates) {
+		tmpl := mod.Templates[name]
+		tmplNode := orNode(mapValue(mapValue(node, `templates`), name), node)
+
+		if tmpl == nil || len(tmpl.Definition) == 0 {
+			self.add(tmplNode, "template %q: no definition", name)
+			continue
+		}
+
+		for _, pname := range maputil.StringKeys(tmpl.Params) {
+			if param := tmpl.Params[pname]; param == nil {
+				continue
+			} else if ok, err := isTemplateParamType(param.Type, param.Default); err != nil {
+				self.add(tmplNode, "template %q: parameter %q: %v", name, pname, err)
+			} else if !ok && param.Default != nil {
+				self.add(tmplNode, "template %q: parameter %q: default must be a %s", name, pname, param.Type)
+			}
+		}
+
+		templates[name] = tmpl
+	}
+
+	for i, submod := range mod.Modules {
+		if submod != nil {
+			self.expandModule(submod, seqItem(mapValue(node, `modules`), i, node), templates)
+		}
+	}
+
+	if mod.Definition != nil {
+		mod.Definition = self.expandComponent(mod.Definition, orNode(mapValue(node, `definition`), node), templates, 0)
+	}
+}
+
+// expands the given component (if it uses a template) and those within it.  Problems in
+// expanded components are reported at the component that used the template.
+func (self *validator) expandComponent(component *Component, node *yamlv3.Node, templates map[string]*ComponentTemplate, depth int) *Component {
+	for component.Use != `` {
+		if depth >= MaxTemplateDepth {
+			self.add(node, "template %q: nested too deeply (does it use itself?)", component.Use)
+			return component
+		} else if result, err := expandTemplate(component, templates); err == nil {
+			result.markExpanded(component.Use)
+			component = result
+			depth += 1
+		} else {
+			self.add(node, "%v", err)
+			return component
+		}
+	}
+
+	for i, child := range component.Components {
+		if child != nil {
+			component.Components[i] = self.expandComponent(child, component.childNode(node, i), templates, depth)
+		}
+	}
+
+	return component
+}
+
+// records that this component (and everything in it) was expanded from the named template.
+func (self *Component) markExpanded(template string) {
+	if self.template == `` {
+		self.template = template
+	}
+
+	for _, child := range self.Components {
+		if child != nil {
+			child.markExpanded(template)
+		}
+	}
+}
+
+// returns the YAML node the given child of this component was declared in.  Components expanded
+// from a template are attributed to the node where the template was used.
+func (self *Component) childNode(node *yamlv3.Node, i int) *yamlv3.Node {
+	if self.template != `` {
+		return node
+	}
+
+	return seqItem(mapValue(node, `components`), i, node)
+}
+
+// returns the component tree that the given component's use of a template expands into.
+func expandTemplate(use *Component, templates map[string]*ComponentTemplate) (*Component, error) {
+	var name = use.Use
+	var tmpl, ok = templates[name]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+
+	var values = make(map[string]interface{})
+
+	for _, pname := range maputil.StringKeys(use.With) {
+		if _, ok := tmpl.Params[pname]; !ok {
+			return nil, fmt.Errorf("template %q: unknown parameter %q", name, pname)
+		}
+	}
+
+	for _, pname := range maputil.StringKeys(tmpl.Params) {
+		var param = tmpl.Params[pname]
+
+		if param == nil {
+			param = new(TemplateParam)
+		}
+
+		if value, ok := use.With[pname]; ok {
+			if ok, err := isTemplateParamType(param.Type, value); err != nil {
+				return nil, fmt.Errorf("template %q: parameter %q: %v", name, pname, err)
+			} else if !ok {
+				return nil, fmt.Errorf("template %q: parameter %q must be a %s, got %v", name, pname, param.Type, typeutil.String(value))
+			}
+
+			values[pname] = value
+		} else if param.Required {
+			return nil, fmt.Errorf("template %q: missing required parameter %q", name, pname)
+		} else {
+			values[pname] = param.Default
+		}
+	}
+
+	var expanded Component
+
+	if body, err := substituteTemplateParams(tmpl.Definition, values); err == nil {
+		if data, err := yaml.Marshal(body); err == nil {
+			if err := yaml.UnmarshalStrict(data, &expanded); err != nil {
+				return nil, fmt.Errorf("template %q: %v", name, err)
+			}
+		} else {
+			return nil, fmt.Errorf("template %q: %v", name, err)
+		}
+	} else {
+		return nil, fmt.Errorf("template %q: %v", name, err)
+	}
+
+	var slots = make(map[string][]*Component)
+	var filled = make(map[string]bool)
+
+	for slot, children := range use.Slots {
+		slots[slot] = children
+	}
+
+	if len(use.Components) > 0 {
+		slots[DefaultSlot] = append(slots[DefaultSlot], use.Components...)
+	}
+
+	expanded.Components = fillTemplateSlots(expanded.Components, slots, filled)
+
+	for _, slot := range maputil.StringKeys(slots) {
+		if !filled[slot] {
+			return nil, fmt.Errorf("template %q has no slot %q", name, slot)
+		}
+	}
+
+	// whatever else the component using the template declares is applied over what it expands to
+	if use.Type != `` {
+		expanded.Type = use.Type
+	}
+
+	if use.ID != `` {
+		expanded.ID = use.ID
+	}
+
+	for _, pname := range use.PropertyNames() {
+		if source, ok := use.propSources[pname]; ok {
+			expanded.Set(pname, source)
+		} else {
+			expanded.Set(pname, use.Properties[pname])
+		}
+	}
+
+	if use.Layout != nil {
+		expanded.Layout = use.Layout
+	}
+
+	if use.Fill != nil {
+		expanded.Fill = use.Fill
+	}
+
+	if use.Flex != 0 {
+		expanded.Flex = use.Flex
+	}
+
+	expanded.Public = append(expanded.Public, use.Public...)
+	expanded.Functions = append(expanded.Functions, use.Functions...)
+	expanded.Signals = append(expanded.Signals, use.Signals...)
+	expanded.Behaviors = append(expanded.Behaviors, use.Behaviors...)
+
+	return &expanded, nil
+}
+
+// replaces the slot placeholders among (and within) the given components with copies of the
+// components given for them, so that a slot placed more than once shares nothing between places.
+func fillTemplateSlots(components []*Component, slots map[string][]*Component, filled map[string]bool) []*Component {
+	var out []*Component
+
+	for _, child := range components {
+		if child == nil {
+			continue
+		} else if child.Slot != `` {
+			filled[child.Slot] = true
+
+			if given, ok := slots[child.Slot]; ok {
+				for _, component := range given {
+					out = append(out, component.clone())
+				}
+			} else {
+				out = append(out, fillTemplateSlots(child.Components, slots, filled)...)
+			}
+		} else {
+			child.Components = fillTemplateSlots(child.Components, slots, filled)
+			out = append(out, child)
+		}
+	}
+
+	return out
+}
+
+// returns a deep copy of this component and the components within it.
+func (self *Component) clone() *Component {
+	if self == nil {
+		return nil
+	}
+
+	var out = *self
+
+	if self.Layout != nil {
+		layout := *self.Layout
+		out.Layout = &layout
+	}
+
+	if self.Properties != nil {
+		out.Properties = make(map[string]interface{}, len(self.Properties))
+
+		for name, value := range self.Properties {
+			out.Properties[name] = value
+		}
+	}
+
+	if self.With != nil {
+		out.With = make(map[string]interface{}, len(self.With))
+
+		for name, value := range self.With {
+			out.With[name] = value
+		}
+	}
+
+	if self.propSources != nil {
+		out.propSources = make(map[string]yaml.MapSlice, len(self.propSources))
+
+		for name, source := range self.propSources {
+			out.propSources[name] = source
+		}
+	}
+
+	if self.propOrigins != nil {
+		out.propOrigins = make(map[string]*SourcePosition, len(self.propOrigins))
+
+		for name, origin := range self.propOrigins {
+			out.propOrigins[name] = origin
+		}
+	}
+
+	out.propOrder = append([]string(nil), self.propOrder...)
+	out.Functions = append([]Function(nil), self.Functions...)
+	out.Public = nil
+	out.private = nil
+	out.Signals = nil
+	out.Behaviors = nil
+	out.Components = nil
+	out.Slots = nil
+
+	for _, property := range self.Public {
+		if property != nil {
+			p := *property
+			property = &p
+		}
+
+		out.Public = append(out.Public, property)
+	}
+
+	for _, property := range self.private {
+		if property != nil {
+			p := *property
+			property = &p
+		}
+
+		out.private = append(out.private, property)
+	}
+
+	for _, signal := range self.Signals {
+		if signal != nil {
+			s := *signal
+			s.Arguments = append([]Argument(nil), signal.Arguments...)
+			signal = &s
+		}
+
+		out.Signals = append(out.Signals, signal)
+	}
+
+	for _, behavior := range self.Behaviors {
+		behavior.Animation = behavior.Animation.clone()
+		out.Behaviors = append(out.Behaviors, behavior)
+	}
+
+	for _, child := range self.Components {
+		out.Components = append(out.Components, child.clone())
+	}
+
+	if self.Slots != nil {
+		out.Slots = make(map[string][]*Component, len(self.Slots))
+
+		for slot, children := range self.Slots {
+			for _, child := range children {
+				out.Slots[slot] = append(out.Slots[slot], child.clone())
+			}
+		}
+	}
+
+	return &out
+}
+
+// returns a copy of the given YAML value with every $(name) replaced by the named value.
+func substituteTemplateParams(value interface{}, values map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		var out = make(yaml.MapSlice, 0, len(v))
+
+		for _, item := range v {
+			if key, err := substituteTemplateParams(item.Key, values); err == nil {
+				if val, err := substituteTemplateParams(item.Value, values); err == nil {
+					out = append(out, yaml.MapItem{Key: key, Value: val})
+				} else {
+					return nil, err
+				}
+			} else {
+				return nil, err
+			}
+		}
+
+		return out, nil
+
+	case []interface{}:
+		var out = make([]interface{}, 0, len(v))
+
+		for _, item := range v {
+			if val, err := substituteTemplateParams(item, values); err == nil {
+				out = append(out, val)
+			} else {
+				return nil, err
+			}
+		}
+
+		return out, nil
+
+	case string:
+		var missing []string
+
+		for _, match := range rxTemplateParam.FindAllStringSubmatch(v, -1) {
+			if _, ok := values[match[1]]; !ok {
+				missing = append(missing, match[1])
+			}
+		}
+
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return nil, fmt.Errorf("undeclared parameter(s): %s", strings.Join(missing, `, `))
+		}
+
+		// a value that is only a parameter takes on the parameter's value, type and all
+		if match := rxTemplateParam.FindStringSubmatch(v); match != nil && match[0] == v {
+			return values[match[1]], nil
+		}
+
+		return rxTemplateParam.ReplaceAllStringFunc(v, func(match string) string {
+			if value := values[rxTemplateParam.FindStringSubmatch(match)[1]]; value != nil {
+				return typeutil.String(value)
+			}
+
+			return ``
+		}), nil
+
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,257 @@
+package hydra
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestComponentTemplates(t *testing.T) {
+	assert := require.New(t)
+
+	app := new(Application)
+
+	assert.NoError(FromReader(app, bytes.NewBufferString(`
+imports:
+- QtQuick 2.0
+templates:
+  LabeledField:
+    params:
+      label:
+        type: string
+        required: true
+      width:
+        type: number
+        default: 120
+    definition:
+      type: Row
+      components:
+      - type: Text
+        properties:
+          text: '$(label):'
+      - type: TextField
+        properties:
+          width: $(width)
+  Card:
+    definition:
+      type: Rectangle
+      components:
+      - type: Text
+        slot: title
+        components:
+        - type: Text
+          properties:
+            text: Untitled
+      - type: Column
+        components:
+        - slot: default
+definition:
+  type: Column
+  components:
+  - use: LabeledField
+    id: name
+    with:
+      label: Name
+  - use: Card
+    properties:
+      color: red
+    components:
+    - use: LabeledField
+      with:
+        label: Age
+        width: 40
+`)))
+
+	root := app.Definition
+	assert.Len(root.Components, 2)
+
+	field := root.Components[0]
+	assert.Equal(`Row`, field.Type)
+	assert.Equal(`name`, field.ID)
+	assert.Len(field.Components, 2)
+	assert.Equal(`Name:`, field.Components[0].Properties[`text`])
+	assert.Equal(120, field.Components[1].Properties[`width`])
+
+	card := root.Components[1]
+	assert.Equal(`Rectangle`, card.Type)
+	assert.Equal(`red`, card.Properties[`color`])
+	assert.Len(card.Components, 2)
+	assert.Equal(`Untitled`, card.Components[0].Properties[`text`])
+	assert.Equal(`Column`, card.Components[1].Type)
+	assert.Len(card.Components[1].Components, 1)
+
+	inner := card.Components[1].Components[0]
+	assert.Equal(`Row`, inner.Type)
+	assert.Equal(`Age:`, inner.Components[0].Properties[`text`])
+	assert.Equal(40, inner.Components[1].Properties[`width`])
+
+	qml, err := root.QML(0)
+	assert.NoError(err)
+	assert.Contains(string(qml), `text: "Name:"`)
+	assert.Contains(string(qml), `id: name`)
+	assert.NotContains(string(qml), `$(`)
+}
+
+func TestComponentTemplateSlotPlacedTwice(t *testing.T) {
+	assert := require.New(t)
+
+	app := new(Application)
+
+	assert.NoError(FromReader(app, bytes.NewBufferString(`
+imports:
+- QtQuick 2.0
+templates:
+  Twice:
+    definition:
+      type: Column
+      components:
+      - slot: default
+      - type: Rectangle
+        components:
+        - slot: default
+definition:
+  use: Twice
+  components:
+  - type: Text
+    properties:
+      text: Hello
+    components:
+    - type: Item
+`)))
+
+	root := app.Definition
+	assert.Len(root.Components, 2)
+
+	first := root.Components[0]
+	second := root.Components[1].Components[0]
+
+	assert.Equal(`Text`, first.Type)
+	assert.Equal(`Text`, second.Type)
+	assert.False(first == second)
+	assert.False(first.Components[0] == second.Components[0])
+
+	first.Set(`text`, `Goodbye`)
+	first.Components[0].Type = `Rectangle`
+
+	assert.Equal(`Hello`, second.Properties[`text`])
+	assert.Equal(`Item`, second.Components[0].Type)
+}
+
+func TestComponentTemplateErrors(t *testing.T) {
+	assert := require.New(t)
+
+	for doc, message := range map[string]string{
+		`
+templates:
+  Field:
+    params:
+      label: {required: true}
+    definition: {type: Text}
+definition:
+  use: Field
+`: `missing required parameter "label"`,
+		`
+templates:
+  Field:
+    definition: {type: Text}
+definition:
+  use: Field
+  with: {label: Name}
+`: `unknown parameter "label"`,
+		`
+templates:
+  Field:
+    params:
+      width: {type: number}
+    definition: {type: Text}
+definition:
+  use: Field
+  with: {width: wide}
+`: `parameter "width" must be a number`,
+		`
+templates:
+  Field:
+    definition:
+      type: Text
+      properties: {text: $(label)}
+definition:
+  use: Field
+`: `undeclared parameter(s): label`,
+		`
+definition:
+  use: Nothing
+`: `unknown template "Nothing"`,
+		`
+templates:
+  Field:
+    definition: {type: Text}
+definition:
+  use: Field
+  slots:
+    footer: [{type: Text}]
+`: `template "Field" has no slot "footer"`,
+		`
+templates:
+  Loop:
+    definition: {use: Loop}
+definition:
+  use: Loop
+`: `nested too deeply`,
+	} {
+		err := FromReader(new(Application), bytes.NewBufferString(doc))
+		assert.Error(err)
+		assert.Contains(err.Error(), message)
+	}
+}
+
+func TestValidateComponentTemplates(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-macro-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	appfile := filepath.Join(tmp, `app.yaml`)
+
+	assert.NoError(ioutil.WriteFile(appfile, []byte(`imports:
+- QtQuick 2.0
+templates:
+  Field:
+    params:
+      label: {type: string}
+    definition:
+      type: Text
+      properties: {text: $(label)}
+definition:
+  type: Column
+  components:
+  - use: Field
+    with: {label: 5}
+  - id: a
+    type: Text
+  - use: Field
+    id: a
+`), 0644))
+
+	err = ValidateFile(appfile)
+	assert.Error(err)
+
+	diags, ok := err.(Diagnostics)
+	assert.True(ok)
+
+	var messages []string
+
+	for _, diag := range diags {
+		messages = append(messages, diag.Message)
+	}
+
+	assert.Equal([]string{
+		`template "Field": parameter "label" must be a string, got 5`,
+		`duplicate id "a" (first declared at 15:9)`,
+	}, messages)
+	assert.Equal(13, diags[0].Line)
+}
@@ -1,8 +1,7 @@
 package hydra
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -20,13 +19,13 @@ import (
 )
 
 type ManifestFile struct {
-	Name             string `yaml:"name"`
-	Size             int64  `yaml:"size"`
-	SHA256           string `yaml:"sha256"`
-	MIME             string `yaml:"mime"`
-	Archive          bool   `yaml:"archive,omitempty"`
-	ArchiveFileCount int64  `yaml:"archive_file_count,omitempty"`
-	UncompressedSize int64  `yaml:"uncompressed_size,omitempty"`
+	Name             string `yaml:"name"                         json:"name"`
+	Size             int64  `yaml:"size"                         json:"size"`
+	SHA256           string `yaml:"sha256"                       json:"sha256"`
+	MIME             string `yaml:"mime"                         json:"mime"`
+	Archive          bool   `yaml:"archive,omitempty"            json:"archive,omitempty"` // extract the file when it is fetched
+	ArchiveFileCount int64  `yaml:"archive_file_count,omitempty" json:"archive_file_count,omitempty"`
+	UncompressedSize int64  `yaml:"uncompressed_size,omitempty"  json:"uncompressed_size,omitempty"`
 	skipValidate     bool
 }
 
@@ -39,7 +38,7 @@ func (self *ManifestFile) open(root string) (*os.File, error) {
 }
 
 func (self *ManifestFile) validate(root string) error {
-	path := filepath.Join(root, self.Name)
+	path := self.destination(root)
 
 	if fileutil.FileExists(path) {
 		if cksum, err := fileutil.ChecksumFile(path, `sha256`); err == nil {
@@ -56,16 +55,6 @@ func (self *ManifestFile) validate(root string) error {
 	}
 }
 
-func (self *ManifestFile) fetch(root string) (string, io.ReadCloser, error) {
-	if strings.Contains(self.Name, `://`) {
-		return fetch(self.Name)
-	} else if _, rc, err := fetch(filepath.Join(root, self.Name)); err == nil {
-		return self.Name, rc, err
-	} else {
-		return ``, nil, err
-	}
-}
-
 type ManifestFiles []*ManifestFile
 
 func (self ManifestFiles) TotalSize() (s convutil.Bytes) {
@@ -77,13 +66,16 @@ func (self ManifestFiles) TotalSize() (s convutil.Bytes) {
 }
 
 type Manifest struct {
-	Assets        ManifestFiles `yaml:"assets,omitempty"`
-	Modules       ManifestFiles `yaml:"modules,omitempty"`
-	GlobalImports []string      `yaml:"globals,omitempty"`
-	GeneratedAt   time.Time     `yaml:"generated_at,omitempty"`
-	TotalSize     int64         `yaml:"size"`
-	FileCount     int64         `yaml:"file_count"`
+	Assets        ManifestFiles      `yaml:"assets,omitempty"       json:"assets,omitempty"`
+	Modules       ManifestFiles      `yaml:"modules,omitempty"      json:"modules,omitempty"`
+	GlobalImports []string           `yaml:"globals,omitempty"      json:"globals,omitempty"`
+	GeneratedAt   time.Time          `yaml:"generated_at,omitempty" json:"generated_at,omitempty"`
+	TotalSize     int64              `yaml:"size"                   json:"size"`
+	FileCount     int64              `yaml:"file_count"             json:"file_count"`
+	Deltas        []*ManifestDelta   `yaml:"deltas,omitempty"       json:"deltas,omitempty"`
+	Signature     *ManifestSignature `yaml:"signature,omitempty"    json:"signature,omitempty"`
 	rootDir       string
+	verified      bool
 }
 
 // Returns a new, empty manifest rooted at the given directory.
@@ -148,7 +140,7 @@ func (self *Manifest) ShouldAppend(path string) bool {
 
 func (self *Manifest) refreshGlobalImports() error {
 	return filepath.Walk(self.rootDir, func(path string, info os.FileInfo, err error) error {
-		if filepath.Base(path) == ModuleSpecFilename {
+		if isModuleSpecFile(path) {
 			if spec, err := LoadModuleSpec(path); err == nil {
 				if spec.Global {
 					self.AddGlobalImportPath(filepath.Dir(info.Name()))
@@ -193,8 +185,7 @@ func (self *Manifest) Append(path string, fi ...os.FileInfo) error {
 		if cksum, err := fileutil.ChecksumFile(path, `sha256`); err == nil {
 			relPath := self.rel(path)
 
-			switch base := filepath.Base(path); base {
-			case ModuleSpecFilename:
+			if isModuleSpecFile(path) {
 				if spec, err := LoadModuleSpec(path); err == nil {
 					if spec.Global {
 						self.AddGlobalImportPath(filepath.Dir(path))
@@ -202,18 +193,15 @@ func (self *Manifest) Append(path string, fi ...os.FileInfo) error {
 				} else {
 					return fmt.Errorf("manifest: invalid module spec %s: %v", path, err)
 				}
-			default:
-				if !self.ShouldAppend(path) {
-					return nil
-				}
+			} else if !self.ShouldAppend(path) {
+				return nil
 			}
 
 			entry := &ManifestFile{
-				Name:    relPath,
-				Size:    info.Size(),
-				SHA256:  hex.EncodeToString(cksum),
-				MIME:    fileutil.GetMimeType(path),
-				Archive: (getArchiveType(path) != NoArchive),
+				Name:   relPath,
+				Size:   info.Size(),
+				SHA256: hex.EncodeToString(cksum),
+				MIME:   fileutil.GetMimeType(path),
 			}
 
 			if IsValidModuleFile(path) {
@@ -234,81 +222,131 @@ func (self *Manifest) Append(path string, fi ...os.FileInfo) error {
 	return nil
 }
 
+// Marks the files in this manifest whose names match any of the given patterns as archives,
+// which are extracted in place of the file itself when fetched.  Files are never treated as
+// archives just because of their name; it is an error for a pattern to match a file that is not
+// in a supported archive format, or to match nothing at all.
+func (self *Manifest) MarkArchives(patterns ...string) error {
+	for _, pattern := range patterns {
+		var matched bool
+
+		for _, file := range self.Files() {
+			if ok, err := filepath.Match(pattern, file.Name); err != nil {
+				return fmt.Errorf("manifest: invalid pattern %q: %v", pattern, err)
+			} else if ok {
+				if ArchiveFormatFor(file.Name) == nil {
+					return fmt.Errorf("manifest: %s is not a supported archive (must be one of: %s)", file.Name, strings.Join(ArchiveFormatNames(), `, `))
+				}
+
+				file.Archive = true
+				matched = true
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("manifest: no files match %q", pattern)
+		}
+	}
+
+	return nil
+}
+
 func (self *Manifest) QRC() (*RCC, error) {
 	return QrcFromDir(self.rootDir)
 }
 
+// Retrieves any files in this manifest that are missing or invalid in destdir using the default
+// fetch options.
 func (self *Manifest) Fetch(srcroot string, destdir string) error {
-	var toFetch ManifestFiles
+	return self.FetchWithOptions(srcroot, destdir, FetchOptions{})
+}
+
+func (self *Manifest) Files() ManifestFiles {
+	return append(self.Assets, self.Modules...)
+}
+
+// Loads the manifest that a previous Generate wrote into the given output directory, if any.
+func loadGeneratedManifest(intoDir string) *Manifest {
+	if file, err := os.Open(filepath.Join(intoDir, ManifestFilename)); err == nil {
+		defer file.Close()
+
+		var app Application
 
-	for _, file := range append(self.Assets, self.Modules...) {
-		if err := file.validate(destdir); err != nil {
-			toFetch = append(toFetch, file)
+		if err := yaml.NewDecoder(file).Decode(&app); err == nil {
+			return app.Manifest
+		} else {
+			log.Warningf("ignoring previous manifest: %v", err)
 		}
 	}
 
-	if len(toFetch) > 0 {
-		log.Infof("fetching %d files (%v) into %s", len(toFetch), toFetch.TotalSize(), destdir)
+	return nil
+}
 
-		for _, file := range toFetch {
-			log.Debugf("fetching file: %s", file.Name)
+// Returns whether both manifests list exactly the same files with the same contents.
+func (self *Manifest) sameFiles(other *Manifest) bool {
+	var mine = self.Files()
+	var theirs = other.Files()
 
-			if filename, rc, err := file.fetch(srcroot); err == nil {
-				dest := filepath.Join(destdir, filename)
+	if len(mine) != len(theirs) {
+		return false
+	}
 
-				if fileutil.SameFile(filename, dest) {
-					continue
-				}
+	for i, file := range mine {
+		if file.Name != theirs[i].Name || file.SHA256 != theirs[i].SHA256 {
+			return false
+		}
+	}
 
-				log.Debugf("  writing file to: %s", dest)
+	return true
+}
 
-				defer rc.Close()
+// Removes files that were retrieved for a previous manifest but are not part of this one, along
+// with any QML and source maps that were generated from them.
+func (self *Manifest) removeStale(previous *Manifest, destdir string) {
+	var current = make(map[string]bool)
 
-				if _, err := fileutil.WriteFile(rc, dest); err == nil {
-					rc.Close()
-				} else {
-					return fmt.Errorf("%s: write: %v", file.Name, err)
-				}
+	for _, file := range self.Files() {
+		current[file.Name] = true
+	}
 
-				if file.Archive {
-					log.Debugf("extracting archive: %s -> %s", dest, destdir)
+	for _, file := range previous.Modules {
+		if !current[file.Name] {
+			qmlfile := fileutil.SetExt(file.Name, `.qml`)
 
-					if err := extract(self, dest, destdir); err == nil {
-						file.skipValidate = true
-					} else {
-						return fmt.Errorf("%s: extract: %v", file.Name, err)
-					}
+			for _, generated := range []string{
+				qmlfile,
+				qmlfile + SourceMapSuffix,
+			} {
+				if !current[generated] {
+					removeStaleFile(destdir, generated)
 				}
-			} else {
-				return fmt.Errorf("%s: retrieve: %v", file.Name, err)
 			}
 		}
 	}
 
-	for _, file := range self.Files() {
-		if file.skipValidate {
-			continue
-		}
-
-		if err := file.validate(destdir); err != nil {
-			os.Remove(filepath.Join(destdir, file.Name))
-			return fmt.Errorf("%s: invalid file: %v", filepath.Join(destdir, file.Name), err)
+	for _, file := range previous.Files() {
+		if !current[file.Name] && !strings.Contains(file.Name, `://`) {
+			removeStaleFile(destdir, file.Name)
 		}
 	}
-
-	return nil
 }
 
-func (self *Manifest) Files() ManifestFiles {
-	return append(self.Assets, self.Modules...)
+func removeStaleFile(destdir string, name string) {
+	path := filepath.Join(destdir, name)
+
+	if fileutil.FileExists(path) {
+		log.Debugf("removing stale file: %s", path)
+
+		if err := os.Remove(path); err != nil {
+			log.Warningf("cannot remove stale file %s: %v", path, err)
+		}
+	}
 }
 
 func (self *Manifest) isAutogenerated(file *ManifestFile) bool {
 	if filepath.Ext(file.Name) == `.qml` {
-		yamlFile := fileutil.SetExt(file.Name, `.yaml`)
-
 		for _, mod := range self.Modules {
-			if mod.Name == yamlFile {
+			if fileutil.SetExt(mod.Name, `.qml`) == file.Name {
 				return true
 			}
 		}
@@ -317,22 +355,96 @@ func (self *Manifest) isAutogenerated(file *ManifestFile) bool {
 	return false
 }
 
+// Returns a manifest listing only the files that Bundle puts into an archive.
+func (self *Manifest) Bundled() *Manifest {
+	bundled := NewManifest(self.rootDir)
+	bundled.GlobalImports = self.GlobalImports
+	bundled.GeneratedAt = self.GeneratedAt
+
+	for _, list := range []struct {
+		from ManifestFiles
+		into *ManifestFiles
+	}{
+		{self.Assets, &bundled.Assets},
+		{self.Modules, &bundled.Modules},
+	} {
+		for _, file := range list.from {
+			if file.Archive || self.isAutogenerated(file) {
+				continue
+			}
+
+			*list.into = append(*list.into, file)
+			bundled.FileCount += 1
+			bundled.TotalSize += file.Size
+		}
+	}
+
+	return bundled
+}
+
 // Bundling is the process of taking the files in this manifest, omitting the
-// autogenerated ones, and putting them all in one big Gzipped Tar archive.
+// autogenerated ones, and putting them all in one big archive.  The archive format is
+// determined by the extension of outfile (e.g.: app.tar.gz, app.zip, app.tar.zst).
 // This archive can then be served as a complete standalone application.
+//
+// The archive starts with a manifest.yaml listing the bundled files (see Bundled), which is
+// used to verify them when the bundle is extracted.
 func (self *Manifest) Bundle(outfile string) error {
-	if targz, err := os.Create(outfile); err == nil {
-		gzw := gzip.NewWriter(targz)
-		tw := tar.NewWriter(gzw)
+	return writeBundle(outfile, self.Bundled())
+}
 
-		defer targz.Close()
-		defer gzw.Close()
-		defer tw.Close()
+// A file that is written to the start of a bundle from memory rather than from disk.
+type bundleHeader struct {
+	Name string
+	Data []byte
+}
+
+// Writes the files listed in bundled (read from its root directory) into an archive at outfile,
+// preceded by the given headers and then by a manifest.yaml listing those files.
+func writeBundle(outfile string, bundled *Manifest, headers ...bundleHeader) error {
+	format := ArchiveFormatFor(outfile)
+
+	if format == nil {
+		return fmt.Errorf("bundle: unsupported archive format %q (must be one of: %s)", filepath.Base(outfile), strings.Join(ArchiveFormatNames(), `, `))
+	}
+
+	if data, err := yaml.Marshal(&Application{
+		Manifest: bundled,
+	}); err == nil {
+		headers = append(headers, bundleHeader{
+			Name: ManifestFilename,
+			Data: data,
+		})
+	} else {
+		return fmt.Errorf("bundle: manifest: %v", err)
+	}
+
+	if out, err := os.Create(outfile); err == nil {
+		defer out.Close()
+
+		aw, err := format.NewWriter(out)
+
+		if err != nil {
+			return fmt.Errorf("bundle: %v", err)
+		}
+
+		defer aw.Close()
+
+		for _, header := range headers {
+			if err := aw.WriteEntry(&ArchiveEntry{
+				Name:    header.Name,
+				Mode:    0644,
+				Size:    int64(len(header.Data)),
+				ModTime: bundled.GeneratedAt,
+			}, bytes.NewReader(header.Data)); err != nil {
+				return fmt.Errorf("bundle: %s: %v", header.Name, err)
+			}
+		}
 
 		// go through all our files and build a list of unique directories
 		var dirs []string
 
-		for _, file := range self.Files() {
+		for _, file := range bundled.Files() {
 			if dir := filepath.Dir(file.Name); dir != `.` {
 				dirs = append(dirs, dir)
 			}
@@ -342,21 +454,15 @@ func (self *Manifest) Bundle(outfile string) error {
 		sort.Strings(dirs)
 		dirs = sliceutil.UniqueStrings(dirs)
 
-		// add the directories as headers in the archive
+		// add the directories as entries in the archive
 		for _, dir := range dirs {
 			relDir := dir
-			dir = filepath.Join(self.rootDir, dir)
+			dir = filepath.Join(bundled.rootDir, dir)
 
 			if stat, err := os.Stat(dir); err == nil {
-				if header, err := tar.FileInfoHeader(stat, stat.Name()); err == nil {
-					header.Name = relDir
-					log.Debugf("bundling  dir: %s", header.Name)
+				log.Debugf("bundling  dir: %s", relDir)
 
-					// write the header
-					if err := tw.WriteHeader(header); err != nil {
-						return fmt.Errorf("bundle: header %s: %v", dir, err)
-					}
-				} else {
+				if err := aw.WriteEntry(archiveEntryFromInfo(relDir, stat), nil); err != nil {
 					return fmt.Errorf("bundle: header %s: %v", dir, err)
 				}
 			} else {
@@ -364,48 +470,35 @@ func (self *Manifest) Bundle(outfile string) error {
 			}
 		}
 
-		for _, file := range self.Files() {
-			if file.Archive {
-				continue
-			} else if self.isAutogenerated(file) {
-				continue
-			} else if err := file.validate(self.rootDir); err != nil {
+		for _, file := range bundled.Files() {
+			if err := file.validate(bundled.rootDir); err != nil {
 				return fmt.Errorf("bundle: invalid file %s: %v", file.Name, err)
 			}
 
-			if stat, err := file.stat(self.rootDir); err == nil {
-				if header, err := tar.FileInfoHeader(stat, stat.Name()); err == nil {
-					header.Name = file.Name
-					log.Debugf("bundling file: %s", header.Name)
+			if stat, err := file.stat(bundled.rootDir); err == nil {
+				log.Debugf("bundling file: %s", file.Name)
 
-					// write the header
-					if err := tw.WriteHeader(header); err != nil {
-						return fmt.Errorf("bundle: header %s: %v", file.Name, err)
-					}
+				// copy file contents
+				if f, err := file.open(bundled.rootDir); err == nil {
+					err := aw.WriteEntry(archiveEntryFromInfo(file.Name, stat), f)
+					f.Close()
 
-					// copy file contents
-					if f, err := file.open(self.rootDir); err == nil {
-						defer f.Close()
-
-						if _, err := io.Copy(tw, f); err == nil {
-							f.Close()
-						} else {
-							return fmt.Errorf("bundle: archive %s: %v", file.Name, err)
-						}
-					} else {
-						return fmt.Errorf("bundle: read %s: %v", file.Name, err)
+					if err != nil {
+						return fmt.Errorf("bundle: archive %s: %v", file.Name, err)
 					}
 				} else {
-					return fmt.Errorf("bundle: header %s: %v", file.Name, err)
+					return fmt.Errorf("bundle: read %s: %v", file.Name, err)
 				}
 			} else {
 				return fmt.Errorf("bundle: file %s: %v", file.Name, err)
 			}
 		}
 
-		tw.Close()
-		gzw.Close()
-		targz.Close()
+		if err := aw.Close(); err != nil {
+			return fmt.Errorf("bundle: %v", err)
+		}
+
+		out.Close()
 		log.Noticef("wrote bundle: %s (%v)", outfile, fileutil.SizeOf(outfile))
 		return nil
 	} else {
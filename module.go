@@ -1,6 +1,7 @@
 package hydra
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -10,21 +11,30 @@ import (
 	"github.com/ghetzel/go-stockutil/fileutil"
 	"github.com/ghetzel/go-stockutil/log"
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 type ModuleSpec struct {
 	Global bool `yaml:"global" json:"global"`
 }
 
+// Reports whether the given file is a module: YAML (or in the format of a registered Decoder)
+// that parses as one.
 func IsValidModuleFile(path string) bool {
+	if !IsDocumentFile(path) {
+		return false
+	}
+
 	if file, err := os.Open(path); err == nil {
 		defer file.Close()
 
 		if data, err := ioutil.ReadAll(file); err == nil {
 			var mod Module
 
-			if err := yaml.UnmarshalStrict(data, &mod); err == nil {
-				return true
+			if data, err := decodeDocument(path, DecoderFor(path), data, filepath.Dir(path)); err == nil {
+				if err := yaml.UnmarshalStrict(data, &mod); err == nil {
+					return true
+				}
 			}
 		}
 	}
@@ -39,6 +49,10 @@ func LoadModuleSpec(path string) (*ModuleSpec, error) {
 		if data, err := ioutil.ReadAll(file); err == nil {
 			spec := new(ModuleSpec)
 
+			if data, err = decodeDocument(path, DecoderFor(path), data, filepath.Dir(path)); err != nil {
+				return nil, err
+			}
+
 			if err := yaml.UnmarshalStrict(data, spec); err == nil {
 				return spec, nil
 			} else {
@@ -53,14 +67,19 @@ func LoadModuleSpec(path string) (*ModuleSpec, error) {
 }
 
 type Module struct {
-	Name       string     `yaml:"name,omitempty"       json:"name,omitempty"`
-	Source     string     `yaml:"source,omitempty"     json:"source,omitempty"`
-	Imports    []string   `yaml:"imports,omitempty"    json:"imports,omitempty"`
-	Assets     []Asset    `yaml:"assets,omitempty"     json:"assets,omitempty"`
-	Modules    []*Module  `yaml:"modules,omitempty"    json:"modules,omitempty"`
-	Definition *Component `yaml:"definition,omitempty" json:"definition,omitempty"`
-	Singleton  bool       `yaml:"singleton,omitempty"  json:"singleton,omitempty"`
+	Name       string                        `yaml:"name,omitempty"       json:"name,omitempty"`
+	Source     string                        `yaml:"source,omitempty"     json:"source,omitempty"`
+	Imports    []string                      `yaml:"imports,omitempty"    json:"imports,omitempty"`
+	Assets     []Asset                       `yaml:"assets,omitempty"     json:"assets,omitempty"`
+	Modules    []*Module                     `yaml:"modules,omitempty"    json:"modules,omitempty"`
+	Definition *Component                    `yaml:"definition,omitempty" json:"definition,omitempty"`
+	Singleton  bool                          `yaml:"singleton,omitempty"  json:"singleton,omitempty"`
+	Vars       map[string]interface{}        `yaml:"vars,omitempty"       json:"vars,omitempty"` // see RenderTemplate
+	Data       map[string]string             `yaml:"data,omitempty"       json:"data,omitempty"`
+	Templates  map[string]*ComponentTemplate `yaml:"templates,omitempty"  json:"templates,omitempty"`
 	spec       *ModuleSpec
+	sourceFile string
+	sourceNode *yamlv3.Node
 }
 
 func LoadModule(uri string, module *Module) error {
@@ -72,11 +91,22 @@ func LoadModule(uri string, module *Module) error {
 				module = new(Module)
 			}
 
+			if data, err = decodeDocument(uri, DecoderFor(uri), data, locationDir(uri)); err != nil {
+				return err
+			}
+
 			if err := yaml.UnmarshalStrict(data, module); err == nil {
 				if strings.TrimSpace(module.Name) == `` {
 					module.Name = strings.TrimSuffix(filepath.Base(uri), filepath.Ext(uri))
 				}
 
+				module.sourceFile = uri
+				module.sourceNode = parseSourceNode(data)
+
+				if err := module.expandTemplates(); err != nil {
+					return err
+				}
+
 				log.Debugf("module loaded from: %s", uri)
 				return nil
 			} else {
@@ -123,78 +153,76 @@ func (self *Module) writeModuleQml(rootDir string, globalImports []string) error
 		if defn := self.Definition; defn != nil {
 			log.Debugf("Generating %q", qmlfile)
 
-			if out, err := os.Create(qmlfile); err == nil {
-				defer out.Close()
+			var out bytes.Buffer
 
-				if self.Singleton {
-					log.Debugf("  singleton: true")
-					out.WriteString("pragma Singleton\n")
-				}
+			self.annotate(self.RelativePath())
 
-				log.Debugf("  imports:")
+			if self.Singleton {
+				log.Debugf("  singleton: true")
+				out.WriteString("pragma Singleton\n")
+			}
 
-				for _, imp := range self.Imports {
-					if stmt, err := toImportStatement(imp); err == nil {
-						log.Debugf("    %s", stmt)
-						out.WriteString(stmt + "\n")
-					} else {
-						return fmt.Errorf("module %q: import %s: %s", self.Name, imp, err)
-					}
+			log.Debugf("  imports:")
+
+			for _, imp := range self.Imports {
+				if stmt, err := toImportStatement(imp); err == nil {
+					log.Debugf("    %s", stmt)
+					out.WriteString(stmt + "\n")
+				} else {
+					return fmt.Errorf("module %q: import %s: %s", self.Name, imp, err)
 				}
+			}
 
-				// add paths that are supposed to be exposed to every module
-				for _, gi := range globalImports {
-					switch gi {
-					case `.`, ``:
-						continue
-					case `/`:
-						gi = `` // to get around the leading slash we add in the fmt below
-					}
-
-					gi = fmt.Sprintf("qrc:/%s", gi)
-
-					if stmt, err := toImportStatement(gi); err == nil {
-						log.Debugf("    %s", stmt)
-						out.WriteString(stmt + "\n")
-					} else {
-						return fmt.Errorf("module %q: import %s: %s", self.Name, gi, err)
-					}
+			// add paths that are supposed to be exposed to every module
+			for _, gi := range globalImports {
+				switch gi {
+				case `.`, ``:
+					continue
+				case `/`:
+					gi = `` // to get around the leading slash we add in the fmt below
 				}
 
-				// import the current directory
-				out.WriteString(fmt.Sprintf("import %q\n", `.`))
+				gi = fmt.Sprintf("qrc:/%s", gi)
 
-				log.Debugf("  type: %v", defn.Type)
-				log.Debugf("  signals:")
-				for _, sig := range defn.Signals {
-					v, _ := sig.QML()
-					log.Debugf("    %s", string(v))
+				if stmt, err := toImportStatement(gi); err == nil {
+					log.Debugf("    %s", stmt)
+					out.WriteString(stmt + "\n")
+				} else {
+					return fmt.Errorf("module %q: import %s: %s", self.Name, gi, err)
 				}
+			}
 
-				if len(defn.Public) > 0 {
-					log.Debugf("  publics:    %d", len(defn.Public))
-				}
-				if len(defn.Functions) > 0 {
-					log.Debugf("  functions:  %d", len(defn.Functions))
-				}
-				if len(defn.Properties) > 0 {
-					log.Debugf("  properties: %d", len(defn.Properties))
-				}
-				if len(defn.Components) > 0 {
-					log.Debugf("  components: %d", len(defn.Components))
-				}
+			// import the current directory
+			out.WriteString(fmt.Sprintf("import %q\n", `.`))
 
-				if data, err := defn.QML(0); err == nil {
-					if _, err := out.Write(data); err != nil {
-						return fmt.Errorf("module %q: write error %v", self.Name, err)
-					}
+			log.Debugf("  type: %v", defn.Type)
+			log.Debugf("  signals:")
+			for _, sig := range defn.Signals {
+				v, _ := sig.QML()
+				log.Debugf("    %s", string(v))
+			}
 
-					out.Close()
-				} else {
-					return err
+			if len(defn.Public) > 0 {
+				log.Debugf("  publics:    %d", len(defn.Public))
+			}
+			if len(defn.Functions) > 0 {
+				log.Debugf("  functions:  %d", len(defn.Functions))
+			}
+			if len(defn.Properties) > 0 {
+				log.Debugf("  properties: %d", len(defn.Properties))
+			}
+			if len(defn.Components) > 0 {
+				log.Debugf("  components: %d", len(defn.Components))
+			}
+
+			if data, err := defn.qml(0); err == nil {
+				out.Write(data)
+
+				if err := writeMappedQml(qmlfile, out.Bytes()); err != nil {
+					return fmt.Errorf("module %q: write error %v", self.Name, err)
 				}
 			} else {
-				return fmt.Errorf("write module %v: %s", self.Name, err)
+				return err
 			}
 		}
 	} else {
@@ -205,6 +233,13 @@ func (self *Module) writeModuleQml(rootDir string, globalImports []string) error
 	return nil
 }
 
+// records the YAML source positions of this module's definition for use in source maps.
+func (self *Module) annotate(filename string) {
+	if defn := self.Definition; defn != nil {
+		defn.annotate(filename, mapValue(self.sourceNode, `definition`))
+	}
+}
+
 func (self *Module) deepSubmodules() (modules []*Module) {
 	modules = append(modules, self.Modules...)
 
@@ -214,3 +249,15 @@ func (self *Module) deepSubmodules() (modules []*Module) {
 
 	return
 }
+
+// parses the given YAML document into a node tree, which retains the positions of all
+// elements for the purpose of reporting errors.
+func parseSourceNode(data []byte) *yamlv3.Node {
+	var root yamlv3.Node
+
+	if err := yamlv3.Unmarshal(data, &root); err == nil {
+		return documentNode(&root)
+	}
+
+	return nil
+}
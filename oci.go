@@ -0,0 +1,330 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+)
+
+// The manifest annotation that names the file a layer holds, as set by tools like oras.
+const OCITitleAnnotation = `org.opencontainers.image.title`
+
+var ociChallengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+var ociManifestTypes = []string{
+	`application/vnd.oci.image.manifest.v1+json`,
+	`application/vnd.docker.distribution.manifest.v2+json`,
+}
+
+// Retrieves files from artifacts in OCI registries (e.g. as pushed by oras), addressed as
+// oci://<registry>/<repository>#<reference>:<path>, where the reference is a tag or digest
+// (defaulting to "latest") and the path names a layer by its title annotation.  Registries
+// that only speak plain HTTP can be reached with oci+http://.  Bearer token authentication is
+// negotiated as the registry asks for it, using Username and Password if they are set.
+type OCIFetcher struct {
+	Username string
+	Password string
+	tokens   map[string]string
+	lock     sync.Mutex
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Returns an OCIFetcher with credentials from HYDRA_OCI_USERNAME and HYDRA_OCI_PASSWORD.
+func NewOCIFetcherFromEnv() *OCIFetcher {
+	return &OCIFetcher{
+		Username: executil.Env(`HYDRA_OCI_USERNAME`),
+		Password: executil.Env(`HYDRA_OCI_PASSWORD`),
+		tokens:   make(map[string]string),
+	}
+}
+
+func (self *OCIFetcher) Fetch(request *FetchRequest) (*FetchResponse, error) {
+	var client = self.client()
+	var ref, file = splitOCIFragment(request.URL.Fragment)
+	var base = self.registryURL(request.URL)
+
+	if file == `` {
+		return nil, fmt.Errorf("oci: no file given in %q (expected #<reference>:<path>)", request.URL.String())
+	}
+
+	layer, err := self.layer(client, base, sliceutil.OrString(ref, `latest`), file)
+
+	if err != nil {
+		return nil, fmt.Errorf("oci: %v", err)
+	} else if request.ETag != `` && request.ETag == layer.Digest {
+		return nil, ErrNotModified
+	}
+
+	if req, err := http.NewRequest(http.MethodGet, base+`/blobs/`+layer.Digest, nil); err == nil {
+		if request.Offset > 0 {
+			req.Header.Set(`Range`, fmt.Sprintf("bytes=%d-", request.Offset))
+		}
+
+		if res, err := doFetch(client, req, request); err == nil {
+			res.Filename = path.Base(file)
+			res.ETag = layer.Digest
+
+			// blobs are addressed by their digest, so a whole one can be checked against it
+			if !res.Resumed && strings.HasPrefix(layer.Digest, `sha256:`) {
+				res.Body = &digestReader{
+					ReadCloser: res.Body,
+					hash:       sha256.New(),
+					expected:   strings.TrimPrefix(layer.Digest, `sha256:`),
+				}
+			}
+
+			return res, nil
+		} else {
+			return nil, fmt.Errorf("oci: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("oci: %v", err)
+	}
+}
+
+// Resolves name against the directory named in the fragment of an OCI URL.
+func (self *OCIFetcher) Resolve(base *url.URL, name string) *url.URL {
+	var resolved = *base
+	var ref, dir = splitOCIFragment(base.Fragment)
+
+	resolved.Fragment = ref + `:` + strings.TrimPrefix(path.Join(dir, filepath.ToSlash(name)), `/`)
+	return &resolved
+}
+
+// returns the base URL of the repository's registry API.
+func (self *OCIFetcher) registryURL(u *url.URL) string {
+	var scheme = `https`
+	var host = u.Host
+
+	if u.Scheme == `oci+http` {
+		scheme = `http`
+	}
+
+	if host == `docker.io` {
+		host = `registry-1.docker.io`
+	}
+
+	return scheme + `://` + host + `/v2/` + strings.Trim(u.Path, `/`)
+}
+
+// retrieves the manifest for the given reference and returns the layer holding the named file.
+func (self *OCIFetcher) layer(client *http.Client, base string, ref string, file string) (*ociDescriptor, error) {
+	if req, err := http.NewRequest(http.MethodGet, base+`/manifests/`+ref, nil); err == nil {
+		req.Header.Set(`Accept`, strings.Join(ociManifestTypes, `, `))
+
+		if res, err := client.Do(req); err == nil {
+			defer res.Body.Close()
+
+			if res.StatusCode >= 400 {
+				return nil, fmt.Errorf("manifest %s: HTTP %v", ref, res.Status)
+			}
+
+			var manifest ociManifest
+
+			if err := json.NewDecoder(io.LimitReader(res.Body, MaxBundleManifestSize)).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("manifest %s: %v", ref, err)
+			}
+
+			for _, layer := range manifest.Layers {
+				if layer.Annotations[OCITitleAnnotation] == file {
+					return &layer, nil
+				}
+			}
+
+			return nil, fmt.Errorf("manifest %s: no layer titled %q", ref, file)
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// returns an HTTP client that authenticates with registries as they ask it to.
+func (self *OCIFetcher) client() *http.Client {
+	var client = *Client
+
+	client.Transport = &ociTransport{
+		fetcher: self,
+		next:    Client.Transport,
+	}
+
+	return &client
+}
+
+// Requests a bearer token as described by a registry's WWW-Authenticate challenge.
+func (self *OCIFetcher) token(challenge string) (string, error) {
+	var params = make(url.Values)
+	var realm string
+
+	for _, match := range ociChallengeParam.FindAllStringSubmatch(challenge, -1) {
+		if key := match[1]; key == `realm` {
+			realm = match[2]
+		} else {
+			params.Set(key, match[2])
+		}
+	}
+
+	if realm == `` {
+		return ``, fmt.Errorf("no realm in challenge %q", challenge)
+	}
+
+	if req, err := http.NewRequest(http.MethodGet, realm+`?`+params.Encode(), nil); err == nil {
+		req = withOwnCredentials(req)
+
+		if self.Username != `` {
+			req.SetBasicAuth(self.Username, self.Password)
+		}
+
+		if res, err := Client.Do(req); err == nil {
+			defer res.Body.Close()
+
+			if res.StatusCode >= 400 {
+				return ``, fmt.Errorf("token: HTTP %v", res.Status)
+			}
+
+			var token struct {
+				Token       string `json:"token"`
+				AccessToken string `json:"access_token"`
+			}
+
+			if err := json.NewDecoder(res.Body).Decode(&token); err == nil {
+				return sliceutil.OrString(token.Token, token.AccessToken), nil
+			} else {
+				return ``, fmt.Errorf("token: %v", err)
+			}
+		} else {
+			return ``, fmt.Errorf("token: %v", err)
+		}
+	} else {
+		return ``, fmt.Errorf("token: %v", err)
+	}
+}
+
+// adds registry credentials to requests, answering authentication challenges as they arrive.
+// Tokens are remembered per registry host.
+type ociTransport struct {
+	fetcher *OCIFetcher
+	next    http.RoundTripper
+}
+
+func (self *ociTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var next = self.next
+	var host = req.URL.Host
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	// registries are only ever sent the credentials they ask for
+	req = withOwnCredentials(req)
+
+	self.fetcher.lock.Lock()
+	token := self.fetcher.tokens[host]
+	self.fetcher.lock.Unlock()
+
+	if token != `` {
+		req = req.Clone(req.Context())
+		req.Header.Set(`Authorization`, `Bearer `+token)
+	}
+
+	res, err := next.RoundTrip(req)
+
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	challenge := res.Header.Get(`WWW-Authenticate`)
+	retry := req.Clone(req.Context())
+
+	switch strings.ToLower(strings.SplitN(challenge, ` `, 2)[0]) {
+	case `bearer`:
+		if token, err := self.fetcher.token(challenge); err == nil {
+			self.fetcher.lock.Lock()
+
+			if self.fetcher.tokens == nil {
+				self.fetcher.tokens = make(map[string]string)
+			}
+
+			self.fetcher.tokens[host] = token
+			self.fetcher.lock.Unlock()
+
+			retry.Header.Set(`Authorization`, `Bearer `+token)
+		} else {
+			res.Body.Close()
+			return nil, err
+		}
+	case `basic`:
+		if self.fetcher.Username == `` {
+			return res, nil
+		}
+
+		retry.SetBasicAuth(self.fetcher.Username, self.fetcher.Password)
+	default:
+		return res, nil
+	}
+
+	res.Body.Close()
+	return next.RoundTrip(retry)
+}
+
+// splits a <reference>:<path> fragment.  Digests contain a colon of their own, so the path is
+// whatever follows the last one; a fragment without a colon is taken to be just the path.
+func splitOCIFragment(fragment string) (string, string) {
+	if i := strings.LastIndex(fragment, `:`); i >= 0 {
+		return fragment[:i], fragment[i+1:]
+	}
+
+	return ``, fragment
+}
+
+// verifies that what was read matches the expected (hex-encoded) digest once all of it has been.
+type digestReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (self *digestReader) Read(p []byte) (int, error) {
+	n, err := self.ReadCloser.Read(p)
+	self.hash.Write(p[:n])
+
+	if err == io.EOF {
+		if actual := hex.EncodeToString(self.hash.Sum(nil)); actual != self.expected {
+			return n, fmt.Errorf("digest mismatch: expected %s, got %s", self.expected, actual)
+		}
+	}
+
+	return n, err
+}
+
+func init() {
+	var oci = NewOCIFetcherFromEnv()
+
+	RegisterFetcher(`oci`, oci)
+	RegisterFetcher(`oci+http`, oci)
+}
@@ -0,0 +1,190 @@
+package hydra
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// Where Load keeps a copy of every application it retrieves from a remote location, to fall back
+// on should that location become unreachable.  If empty, nothing is kept.
+var StateDirectory = executil.Env(`HYDRA_STATE_DIR`, `~/.local/state/hydra`)
+
+// Describes a saved copy of a remotely-loaded application.
+type SavedApplication struct {
+	Location       string    `json:"location"`
+	SourceLocation string    `json:"source_location,omitempty"`
+	Format         string    `json:"format,omitempty"` // the Decoder the application is in, if not YAML
+	SavedAt        time.Time `json:"saved_at"`
+}
+
+// returns the paths of the saved copy of the application loaded from the given location, and of
+// the file describing it.
+func savedApplicationPaths(location string) (string, string, error) {
+	if dir, err := fileutil.ExpandUser(StateDirectory); err == nil {
+		var id = sha256.Sum256([]byte(location))
+		var base = filepath.Join(dir, `apps`, hex.EncodeToString(id[:8]))
+
+		return base + `.yaml`, base + `.json`, nil
+	} else {
+		return ``, ``, err
+	}
+}
+
+// saves the data this application was loaded from, so that it can be loaded again (see
+// loadSavedApplication) without its location being reachable.  Only applications loaded from
+// remote locations are saved, and only once they have been verified (see verifyManifest).
+func (self *Application) save() error {
+	if StateDirectory == `` || len(self.data) == 0 || !isRemote(self.location) {
+		return nil
+	}
+
+	yamlfile, jsonfile, err := savedApplicationPaths(self.location)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(yamlfile), 0700); err != nil {
+		return err
+	}
+
+	if meta, err := json.MarshalIndent(SavedApplication{
+		Location:       self.location,
+		SourceLocation: self.SourceLocation,
+		Format:         self.format,
+		SavedAt:        time.Now(),
+	}, ``, `  `); err == nil {
+		if existing, err := ioutil.ReadFile(yamlfile); err != nil || !bytes.Equal(existing, self.data) {
+			if err := writeFileAtomic(yamlfile, self.data); err != nil {
+				return err
+			}
+		}
+
+		return writeFileAtomic(jsonfile, meta)
+	} else {
+		return err
+	}
+}
+
+// loads the copy of the application last loaded from the given location, marking it as offline.
+func loadSavedApplication(location string) (*Application, error) {
+	yamlfile, jsonfile, err := savedApplicationPaths(location)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var saved SavedApplication
+
+	if data, err := ioutil.ReadFile(jsonfile); err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("%s: %v", jsonfile, err)
+		}
+	} else {
+		return nil, err
+	}
+
+	if file, err := os.Open(yamlfile); err == nil {
+		defer file.Close()
+
+		var app = new(Application)
+		var decoder Decoder
+
+		if saved.Format != `` {
+			if d, ok := GetDecoder(saved.Format); ok {
+				decoder = d
+			} else {
+				return nil, fmt.Errorf("%s: unknown format %q", jsonfile, saved.Format)
+			}
+		}
+
+		if err := fromReader(app, file, decoder, saved.SourceLocation); err != nil {
+			return nil, fmt.Errorf("%s: %v", yamlfile, err)
+		}
+
+		if err := app.verifyManifest(); err != nil {
+			return nil, fmt.Errorf("%s: %v", yamlfile, err)
+		}
+
+		app.location = location
+		app.SourceLocation = saved.SourceLocation
+		app.offline = true
+		app.savedAt = saved.SavedAt
+
+		return app, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Reports whether the application is a saved copy, loaded because its location could not be
+// reached.
+func (self *Application) Offline() bool {
+	return self.offline
+}
+
+// Returns when the saved copy of an offline application was last retrieved from its location.
+func (self *Application) SavedAt() time.Time {
+	return self.savedAt
+}
+
+// returns the SavedAt time as a string for QML (empty unless the application is offline).
+func (self *Application) offlineSince() string {
+	if self.offline {
+		return self.savedAt.Format(time.RFC3339)
+	}
+
+	return ``
+}
+
+// falls back to the most recently saved copy of any of the given remote locations.
+func loadOfflineFallback(locations []string) (*Application, error) {
+	var fallback *Application
+
+	for _, location := range locations {
+		if StateDirectory == `` || !isRemote(location) {
+			continue
+		}
+
+		if app, err := loadSavedApplication(location); err == nil {
+			if fallback == nil || app.savedAt.After(fallback.savedAt) {
+				fallback = app
+			}
+		} else if !os.IsNotExist(err) {
+			log.Warningf("Load: cannot use saved copy of %s: %v", location, err)
+		}
+	}
+
+	if fallback == nil {
+		return nil, fmt.Errorf("no saved copy")
+	}
+
+	log.Warningf(
+		"Load: no application could be retrieved, running the copy of %s saved at %v (OFFLINE)",
+		fallback.location,
+		fallback.savedAt.Format(time.RFC3339),
+	)
+
+	return fallback, nil
+}
+
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + `.tmp`
+
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
@@ -0,0 +1,91 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestLoadOfflineFallback(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-state-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	defer func(dir string) {
+		StateDirectory = dir
+	}(StateDirectory)
+
+	StateDirectory = tmp
+
+	var served = "imports:\n- QtQuick 2.0\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(served))
+	}))
+
+	location := server.URL + `/apps/app.yaml`
+
+	// nothing is saved that doesn't pass verification
+	pubPEM, _, err := GenerateKeyPair()
+	assert.NoError(err)
+
+	TrustedKeys, err = ParsePublicKeys(string(pubPEM))
+	assert.NoError(err)
+
+	_, err = Load(location)
+	assert.Error(err)
+	TrustedKeys = nil
+
+	entries, err := ioutil.ReadDir(tmp)
+	assert.NoError(err)
+	assert.Empty(entries)
+
+	app, err := Load(location)
+	assert.NoError(err)
+	assert.False(app.Offline())
+	assert.Equal(server.URL+`/apps`, app.SourceLocation)
+
+	// updates are saved as they're found
+	served = "imports:\n- QtQuick 2.11\n"
+
+	app, err = LoadIfChanged(location, app.ETag())
+	assert.NoError(err)
+	assert.Equal([]string{`QtQuick 2.11`}, app.Imports)
+
+	// the server goes away, but the application it last served is still there to run
+	server.Close()
+
+	app, err = Load(location)
+	assert.NoError(err)
+	assert.True(app.Offline())
+	assert.False(app.SavedAt().IsZero())
+	assert.Equal([]string{`QtQuick 2.11`}, app.Imports)
+	assert.Equal(location, app.Location())
+	assert.Equal(server.URL+`/apps`, app.SourceLocation)
+	assert.Empty(app.ETag())
+
+	// which QML can tell
+	var offline interface{}
+
+	for _, property := range app.getBuiltinModules()[0].Definition.Public {
+		if property.Name == `offline` {
+			offline = property.Value
+		}
+	}
+
+	assert.Equal(true, offline)
+
+	// only locations that have been loaded before can be fallen back on
+	_, err = Load(server.URL + `/other.yaml`)
+	assert.Error(err)
+
+	StateDirectory = ``
+	_, err = Load(location)
+	assert.Error(err)
+}
@@ -0,0 +1,268 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/rxutil"
+	"gopkg.in/yaml.v2"
+)
+
+// Setting this key on a component, property, function or signal in an overlay removes the
+// matching one from the application instead of merging into it.
+var RemoveKey = `_remove`
+
+// Files (or URLs) layered over every application Load finds, after any environment and device
+// overlays found beside it.
+var Overlays []string
+
+// How the items of lists with these keys are matched up when merging an overlay; items that
+// match are merged, and those that don't are appended.  Other lists are replaced outright.
+var overlayListKeys = map[string]string{
+	`components`: `id`,
+	`public`:     `name`,
+	`functions`:  `name`,
+	`signals`:    `name`,
+	`modules`:    `name`,
+}
+
+// Deep-merges the overlay YAML document onto the base one, returning the result.
+//
+// Maps are merged key by key, and a null value removes the key.  Components are matched by id,
+// and public properties, functions, signals and modules by name: matching items are merged
+// (or removed, if the overlay sets _remove: true), and the rest are appended.  Imports are
+// matched by module (and alias), so an overlay can change the version of an import.  Any other
+// list, and any other value, is replaced by the overlay's.
+func MergeYAML(base []byte, overlay []byte) ([]byte, error) {
+	var b, o yaml.MapSlice
+
+	if err := yaml.Unmarshal(base, &b); err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(overlay, &o); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(mergeYAMLMaps(b, o))
+}
+
+func mergeYAMLValues(key string, base interface{}, overlay interface{}) interface{} {
+	switch ov := overlay.(type) {
+	case yaml.MapSlice:
+		if bv, ok := base.(yaml.MapSlice); ok {
+			return mergeYAMLMaps(bv, ov)
+		}
+	case []interface{}:
+		if bv, ok := base.([]interface{}); ok {
+			return mergeYAMLLists(key, bv, ov)
+		}
+	}
+
+	return overlay
+}
+
+func mergeYAMLMaps(base yaml.MapSlice, overlay yaml.MapSlice) yaml.MapSlice {
+	var merged = append(yaml.MapSlice(nil), base...)
+
+OverlayItems:
+	for _, item := range overlay {
+		var key = fmt.Sprintf("%v", item.Key)
+
+		for i, existing := range merged {
+			if fmt.Sprintf("%v", existing.Key) == key {
+				if item.Value == nil {
+					merged = append(merged[:i], merged[i+1:]...)
+				} else {
+					merged[i].Value = mergeYAMLValues(key, existing.Value, item.Value)
+				}
+
+				continue OverlayItems
+			}
+		}
+
+		if item.Value != nil {
+			merged = append(merged, item)
+		}
+	}
+
+	return merged
+}
+
+func mergeYAMLLists(key string, base []interface{}, overlay []interface{}) []interface{} {
+	var identify func(interface{}) string
+
+	if field, ok := overlayListKeys[key]; ok {
+		identify = func(item interface{}) string {
+			if m, ok := item.(yaml.MapSlice); ok {
+				for _, kv := range m {
+					if fmt.Sprintf("%v", kv.Key) == field {
+						return fmt.Sprintf("%v", kv.Value)
+					}
+				}
+			}
+
+			return ``
+		}
+	} else if key == `imports` {
+		identify = func(item interface{}) string {
+			return rxutil.Whitespace.Split(strings.TrimSpace(fmt.Sprintf("%v", item)), 2)[0]
+		}
+	} else {
+		return overlay
+	}
+
+	var merged = append([]interface{}(nil), base...)
+
+OverlayItems:
+	for _, item := range overlay {
+		var remove bool
+
+		if m, ok := item.(yaml.MapSlice); ok {
+			for i, kv := range m {
+				if fmt.Sprintf("%v", kv.Key) == RemoveKey {
+					remove = (kv.Value == true)
+					item = append(append(yaml.MapSlice(nil), m[:i]...), m[i+1:]...)
+					break
+				}
+			}
+		}
+
+		if id := identify(item); id != `` {
+			for i, existing := range merged {
+				if identify(existing) == id {
+					if remove {
+						merged = append(merged[:i], merged[i+1:]...)
+					} else {
+						merged[i] = mergeYAMLValues(``, existing, item)
+					}
+
+					continue OverlayItems
+				}
+			}
+		}
+
+		if !remove {
+			merged = append(merged, item)
+		}
+	}
+
+	return merged
+}
+
+// returns the overlays that apply to an application loaded from the given location: those for
+// the current environment and device found beside it (for local files, in any format with a
+// Decoder), followed by Overlays.
+func overlaysFor(location string) (overlays []string) {
+	if !isRemote(location) {
+		var dir, base = filepath.Split(location)
+		var name = strings.TrimPrefix(base, Environment+`.`)
+
+		for _, prefix := range []string{Environment, DeviceID()} {
+			if prefix == `` || prefix+`.`+name == base {
+				continue
+			}
+
+			for _, candidate := range documentVariants(filepath.Join(dir, prefix+`.`+name)) {
+				if fileutil.IsNonemptyFile(fileutil.MustExpandUser(candidate)) {
+					overlays = append(overlays, candidate)
+					break
+				}
+			}
+		}
+	}
+
+	return append(overlays, Overlays...)
+}
+
+// merges the given overlays onto the application, in order.  The application is parsed anew
+// from the merged document, and its ETag changes whenever any of the overlays does.
+func (self *Application) overlay(overlays []string) error {
+	if len(overlays) == 0 {
+		return nil
+	}
+
+	var merged = self.resolved
+	var etags = []string{self.etag}
+
+	for _, location := range overlays {
+		if _, rc, err := fetch(location); err == nil {
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+
+			if err != nil {
+				return fmt.Errorf("overlay %s: %v", location, err)
+			}
+
+			if data, err = decodeDocument(location, DecoderFor(location), data, locationDir(location)); err != nil {
+				return fmt.Errorf("overlay %s: %v", location, err)
+			}
+
+			if merged, err = MergeYAML(merged, data); err != nil {
+				return fmt.Errorf("overlay %s: %v", location, err)
+			}
+
+			sum := sha256.Sum256(data)
+			etags = append(etags, hex.EncodeToString(sum[:]))
+			log.Debugf("overlay: applied %s", location)
+		} else {
+			return fmt.Errorf("overlay %s: %v", location, err)
+		}
+	}
+
+	var app = new(Application)
+
+	// positions in the merged document don't correspond to any one of the files it was merged
+	// from, so none are kept: problems are reported, and source maps written, without them
+	if err := yaml.UnmarshalStrict(merged, app); err == nil {
+		app.resolved = merged
+	} else {
+		return fmt.Errorf("overlay: parse: %v", err)
+	}
+
+	if err := app.expandTemplates(); err != nil {
+		return fmt.Errorf("overlay: %v", err)
+	}
+
+	app.filename = self.filename
+	app.sourceFile = self.sourceFile
+	app.SourceLocation = self.SourceLocation
+	app.location = self.location
+
+	// offline applications keep no ETag, so that they are replaced as soon as possible
+	if self.etag != `` {
+		sum := sha256.Sum256([]byte(strings.Join(etags, "\n")))
+		app.etag = hex.EncodeToString(sum[:])
+	}
+
+	app.data = self.data
+	app.format = self.format
+	app.offline = self.offline
+	app.savedAt = self.savedAt
+	app.layers = append([]string{self.location}, overlays...)
+
+	*self = *app
+	return nil
+}
+
+// Returns the locations that make up this application: where it was loaded from, followed by
+// any overlays merged onto it.
+func (self *Application) Layers() []string {
+	if len(self.layers) > 0 {
+		return self.layers
+	}
+
+	return []string{self.location}
+}
+
+// Returns the YAML document this application was parsed from, after rendering it as a template
+// and merging any overlays.
+func (self *Application) Resolved() []byte {
+	return self.resolved
+}
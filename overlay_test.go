@@ -0,0 +1,166 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestMergeYAML(t *testing.T) {
+	assert := require.New(t)
+
+	merged, err := MergeYAML([]byte(`
+imports:
+- QtQuick 2.0
+- QtQuick.Controls 2.0
+definition:
+  type: Window
+  properties:
+    width: 800
+    height: 600
+    color: white
+  public:
+  - name: title
+    type: string
+    value: Lobby
+  components:
+  - id: header
+    type: Text
+    properties:
+      text: Welcome
+  - id: clock
+    type: Text
+  - id: banner
+    type: Image
+`), []byte(`
+imports:
+- QtQuick.Controls 2.12
+- QtMultimedia 5.12
+definition:
+  properties:
+    width: 1920
+    color: null
+  public:
+  - name: debug
+    type: bool
+    value: true
+  components:
+  - id: header
+    properties:
+      font.pixelSize: 48
+  - id: clock
+    _remove: true
+  - id: video
+    type: Video
+`))
+
+	assert.NoError(err)
+	assert.Equal(`imports:
+- QtQuick 2.0
+- QtQuick.Controls 2.12
+- QtMultimedia 5.12
+definition:
+  type: Window
+  properties:
+    width: 1920
+    height: 600
+  public:
+  - name: title
+    type: string
+    value: Lobby
+  - name: debug
+    type: bool
+    value: true
+  components:
+  - id: header
+    type: Text
+    properties:
+      text: Welcome
+      font.pixelSize: 48
+  - id: banner
+    type: Image
+  - id: video
+    type: Video
+`, string(merged))
+
+	_, err = MergeYAML([]byte("imports: []\n"), []byte("imports: [\n"))
+	assert.Error(err)
+}
+
+func TestLoadOverlays(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-overlay-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	defer func(env string, id string, overlays []string) {
+		Environment, ID, Overlays = env, id, overlays
+	}(Environment, ID, Overlays)
+
+	Environment, ID, Overlays = `prod`, `kiosk-1`, nil
+
+	write := func(name string, data string) string {
+		filename := filepath.Join(tmp, name)
+		assert.NoError(ioutil.WriteFile(filename, []byte(data), 0644))
+		return filename
+	}
+
+	base := write(`app.yaml`, "imports:\n- QtQuick 2.0\ndefinition:\n  type: Window\n  properties:\n    width: 800\n")
+
+	// without overlays, the application is just the base
+	app, err := Load(base)
+	assert.NoError(err)
+	assert.Equal([]string{base}, app.Layers())
+	assert.Equal(800, app.Definition.Properties[`width`])
+	assert.NotNil(app.sourceNode)
+
+	env := write(`prod.app.yaml`, "definition:\n  properties:\n    width: 1920\n    height: 1080\n")
+	device := write(`kiosk-1.app.yaml`, "definition:\n  properties:\n    height: 1200\n")
+	extra := write(`extra.yaml`, "imports:\n- QtMultimedia 5.12\n")
+
+	Overlays = []string{extra}
+
+	app, err = Load(base)
+	assert.NoError(err)
+	assert.Equal([]string{base, env, device, extra}, app.Layers())
+	assert.Equal(1920, app.Definition.Properties[`width`])
+	assert.Equal(1200, app.Definition.Properties[`height`])
+	assert.Equal([]string{`QtQuick 2.0`, `QtMultimedia 5.12`}, app.Imports)
+	assert.Equal(base, app.Location())
+	assert.Equal(tmp, app.SourceLocation)
+	assert.Contains(string(app.Resolved()), `QtMultimedia 5.12`)
+
+	// positions in the merged document would point at the wrong lines of the base, so there are none
+	assert.Nil(app.sourceNode)
+	app.Module.annotate(app.entrypointSource())
+	assert.Nil(app.Definition.origin)
+
+	// a change to any overlay is a change to the application
+	_, err = LoadIfChanged(base, app.ETag())
+	assert.Equal(ErrNotModified, err)
+
+	write(`extra.yaml`, "imports:\n- QtMultimedia 5.15\n")
+
+	changed, err := LoadIfChanged(base, app.ETag())
+	assert.NoError(err)
+	assert.NotEqual(app.ETag(), changed.ETag())
+	assert.Equal([]string{`QtQuick 2.0`, `QtMultimedia 5.15`}, changed.Imports)
+
+	// a base for the environment alone still gets the device overlay
+	assert.NoError(os.Remove(base))
+	Overlays = nil
+
+	app, err = Load(env)
+	assert.NoError(err)
+	assert.Equal([]string{env, device}, app.Layers())
+
+	// overlays that can't be loaded are errors, not a reason to try elsewhere
+	Overlays = []string{filepath.Join(tmp, `missing.yaml`)}
+
+	_, err = Load(env)
+	assert.Error(err)
+}
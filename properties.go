@@ -8,6 +8,7 @@ import (
 	"github.com/ghetzel/go-stockutil/maputil"
 	"github.com/ghetzel/go-stockutil/sliceutil"
 	"github.com/ghetzel/go-stockutil/typeutil"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // specifies a list of properties that, when encountered, should be treated as inline
@@ -27,6 +28,73 @@ type Property struct {
 	EnvVar   string      `yaml:"env,omitempty"      json:"env,omitempty"`
 	ReadOnly bool        `yaml:"readonly,omitempty" json:"readonly,omitempty"`
 	expose   bool
+	origin   *SourcePosition
+	source   yaml.MapSlice // the value as declared, if it is an object
+}
+
+// Decodes a property from YAML, retaining the order of the keys in its value (if it is an
+// object) so that inline components keep the order they were declared in.
+func (self *Property) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawProperty Property
+
+	var raw rawProperty
+	var ordered yaml.MapSlice
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	if err := unmarshal(&ordered); err != nil {
+		return err
+	}
+
+	*self = Property(raw)
+	self.source = nil
+
+	for _, item := range ordered {
+		if value, ok := item.Value.(yaml.MapSlice); ok && fmt.Sprintf("%v", item.Key) == `value` {
+			self.source = value
+		}
+	}
+
+	return nil
+}
+
+// Encodes a property as YAML, with an object value in the order it was declared in.
+func (self Property) MarshalYAML() (interface{}, error) {
+	type rawProperty Property
+
+	var raw = rawProperty(self)
+
+	if self.source != nil {
+		raw.Value = self.source
+	}
+
+	return raw, nil
+}
+
+// sets this property's value, keeping an ordered one (see unorderedYAML) as it was given.
+func (self *Property) setValue(value interface{}) {
+	if ordered, ok := value.(yaml.MapSlice); ok {
+		self.source = ordered
+		self.Value = unorderedYAML(ordered)
+	} else {
+		self.source = nil
+		self.Value = value
+	}
+}
+
+// returns the given ordered YAML object in the form it takes when decoded into an interface{}.
+func unorderedYAML(ordered yaml.MapSlice) interface{} {
+	var value interface{}
+
+	if data, err := yaml.Marshal(ordered); err == nil {
+		if err := yaml.Unmarshal(data, &value); err == nil {
+			return value
+		}
+	}
+
+	return ordered
 }
 
 func (self Property) shouldInline() bool {
@@ -64,15 +132,23 @@ func (self Property) QML() ([]byte, error) {
 	out.WriteString(self.Name)
 
 	if self.shouldInline() {
-		inline := new(Component)
-
-		if err := maputil.TaggedStructFromMap(self.Value, inline, `json`); err == nil {
-			if qml, err := inline.QML(0); err == nil {
-				out.WriteString(`: `)
-				out.Write(qml)
-			} else {
-				return nil, fmt.Errorf("bad inline: %v", err)
-			}
+		var inline = new(Component)
+		var definition interface{} = self.Value
+
+		// inline components are decoded just like any other, keeping their properties in order
+		if self.source != nil {
+			definition = self.source
+		}
+
+		if data, err := yaml.Marshal(definition); err != nil {
+			return nil, fmt.Errorf("bad inline: %v", err)
+		} else if err := yaml.Unmarshal(data, inline); err != nil {
+			return nil, fmt.Errorf("bad inline: %v", err)
+		}
+
+		if qml, err := inline.QML(0); err == nil {
+			out.WriteString(`: `)
+			out.Write(qml)
 		} else {
 			return nil, fmt.Errorf("bad inline: %v", err)
 		}
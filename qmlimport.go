@@ -0,0 +1,993 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"gopkg.in/yaml.v2"
+)
+
+var rxQmlGeneratedFunction = regexp.MustCompile(`^function\s*\(\s*\)\s*\{`)
+
+// Reads the given .qml file into a module named after it.  See ParseQML.
+func ImportQML(filename string) (*Module, error) {
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		return ParseQML(filename, data)
+	} else {
+		return nil, err
+	}
+}
+
+// Parses an existing QML document (its imports, pragmas and object tree) into a module, such
+// that generating QML from the module produces equivalent output.  Values that are plain
+// strings, numbers, booleans, or lists and objects of them become the same in the module;
+// anything else is kept as a {JavaScript} expression, and blocks of statements (in signal
+// handlers) as multi-line strings.
+//
+// Parts of the document hydra has no way of expressing (e.g.: enums, inline components,
+// property value sources, or lists of objects) are left out of the module and reported as
+// Diagnostics, which are returned along with the module.  A document that can't be parsed at
+// all returns a nil module.
+func ParseQML(filename string, data []byte) (*Module, error) {
+	var parser = &qmlParser{
+		filename: filename,
+		data:     string(data),
+	}
+
+	var module = &Module{
+		Name: strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)),
+	}
+
+	if err := parser.document(module); err != nil {
+		return nil, err
+	}
+
+	return module, parser.diagnostics.err()
+}
+
+// a hand-rolled parser for the subset of QML (and the JavaScript within it) needed to recover
+// the structure of a document, keeping the source text of expressions and function bodies.
+type qmlParser struct {
+	filename    string
+	data        string
+	pos         int
+	diagnostics Diagnostics
+}
+
+func (self *qmlParser) diagnostic(offset int, format string, args ...interface{}) Diagnostic {
+	var diag = Diagnostic{
+		Filename: self.filename,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	if offset > len(self.data) {
+		offset = len(self.data)
+	}
+
+	before := self.data[:offset]
+	diag.Line = strings.Count(before, "\n") + 1
+	diag.Column = utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+
+	return diag
+}
+
+// returns a syntax error at the given offset, which stops the document from being parsed.
+func (self *qmlParser) fail(offset int, format string, args ...interface{}) error {
+	return Diagnostics{self.diagnostic(offset, format, args...)}
+}
+
+// records that the construct at the given offset was left out of the module.
+func (self *qmlParser) unsupported(offset int, format string, args ...interface{}) {
+	self.diagnostics = append(self.diagnostics, self.diagnostic(offset, "not supported: "+format, args...))
+}
+
+func (self *qmlParser) peek() byte {
+	if self.pos < len(self.data) {
+		return self.data[self.pos]
+	}
+
+	return 0
+}
+
+// skips whitespace and comments, stopping at the end of the line unless newlines is true.
+func (self *qmlParser) skipSpace(newlines bool) {
+	for self.pos < len(self.data) {
+		switch c := self.data[self.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			self.pos++
+		case c == '\n':
+			if !newlines {
+				return
+			}
+
+			self.pos++
+		case strings.HasPrefix(self.data[self.pos:], `//`), strings.HasPrefix(self.data[self.pos:], `/*`):
+			self.skipLiteral()
+		default:
+			return
+		}
+	}
+}
+
+// skips over the string or comment at the current position, reporting whether there was one.
+func (self *qmlParser) skipLiteral() bool {
+	var rest = self.data[self.pos:]
+
+	switch {
+	case strings.HasPrefix(rest, `//`):
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			self.pos += end
+		} else {
+			self.pos = len(self.data)
+		}
+	case strings.HasPrefix(rest, `/*`):
+		if end := strings.Index(rest[2:], `*/`); end >= 0 {
+			self.pos += end + 4
+		} else {
+			self.pos = len(self.data)
+		}
+	case rest != `` && strings.IndexByte("\"'`", rest[0]) >= 0:
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+			} else if rest[i] == rest[0] {
+				self.pos += i + 1
+				return true
+			}
+		}
+
+		self.pos = len(self.data)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// reads a name, which may be qualified (e.g.: anchors.fill or QtQuick.Controls).
+func (self *qmlParser) name() string {
+	var start = self.pos
+
+	for self.pos < len(self.data) {
+		if c := self.data[self.pos]; isQmlIdentifierChar(c) && (self.pos > start || isQmlIdentifierStart(c)) {
+			self.pos++
+		} else if c == '.' && self.pos > start && self.pos+1 < len(self.data) && isQmlIdentifierStart(self.data[self.pos+1]) {
+			self.pos++
+		} else {
+			break
+		}
+	}
+
+	return self.data[start:self.pos]
+}
+
+// reads the type of a property declaration, e.g.: int or list<Item>
+func (self *qmlParser) typeName() string {
+	var start = self.pos
+
+	self.name()
+
+	if self.peek() == '<' {
+		if end := strings.IndexByte(self.data[self.pos:], '>'); end >= 0 {
+			self.pos += end + 1
+		}
+	}
+
+	return self.data[start:self.pos]
+}
+
+// consumes the given word (and any space following it) if it is next.
+func (self *qmlParser) keyword(word string) bool {
+	var start = self.pos
+
+	if self.name() == word {
+		self.skipSpace(false)
+		return true
+	}
+
+	self.pos = start
+	return false
+}
+
+// returns the text between the bracket at the current position and the one that closes it,
+// leaving the parser after the closing bracket.
+func (self *qmlParser) bracketed() (string, error) {
+	var start = self.pos
+	var depth int
+
+	for self.pos < len(self.data) {
+		if self.skipLiteral() {
+			continue
+		}
+
+		switch self.data[self.pos] {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			if depth--; depth == 0 {
+				self.pos++
+				return self.data[start+1 : self.pos-1], nil
+			}
+		}
+
+		self.pos++
+	}
+
+	return ``, self.fail(start, "unterminated %q", self.data[start])
+}
+
+func (self *qmlParser) document(module *Module) error {
+	for {
+		self.skipSpace(true)
+
+		var start = self.pos
+
+		switch word := self.name(); word {
+		case `pragma`:
+			self.skipSpace(false)
+
+			if pragma := self.name(); pragma == `Singleton` {
+				module.Singleton = true
+			} else {
+				self.unsupported(start, "pragma %s", pragma)
+			}
+		case `import`:
+			if err := self.importStatement(module, start); err != nil {
+				return err
+			}
+		case ``:
+			if self.pos >= len(self.data) {
+				return self.fail(start, "no object declared")
+			} else {
+				return self.fail(start, "unexpected %q", self.peek())
+			}
+		default:
+			if !isQmlTypeName(word) {
+				return self.fail(start, "expected an object, got %q", word)
+			} else if definition, err := self.object(word); err == nil {
+				module.Definition = definition
+			} else {
+				return err
+			}
+
+			if self.skipSpace(true); self.pos < len(self.data) {
+				return self.fail(self.pos, "unexpected content after the root object")
+			}
+
+			return nil
+		}
+	}
+}
+
+// reads an import statement into the form it is given in a module (see toImportStatement).
+func (self *qmlParser) importStatement(module *Module, start int) error {
+	var line = self.data[self.pos:]
+
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+
+	self.pos += len(line)
+
+	if i := strings.Index(line, `//`); i >= 0 && !strings.Contains(line[:i], `"`) {
+		line = line[:i]
+	}
+
+	var uri string
+	var fields []string
+	var quoted bool
+
+	if line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), `;`)); strings.HasPrefix(line, `"`) {
+		if end := strings.IndexByte(line[1:], '"'); end >= 0 {
+			uri, quoted = line[1:end+1], true
+			fields = strings.Fields(line[end+2:])
+		} else {
+			return self.fail(start, "unterminated import path")
+		}
+	} else if fields = strings.Fields(line); len(fields) > 0 {
+		uri, fields = fields[0], fields[1:]
+	} else {
+		return self.fail(start, "import: expected a module or path")
+	}
+
+	var version, alias string
+
+	if len(fields) > 0 && fields[0] != `as` {
+		version, fields = fields[0], fields[1:]
+	}
+
+	if len(fields) == 2 && fields[0] == `as` {
+		alias = fields[1]
+	} else if len(fields) > 0 {
+		return self.fail(start, "import: unexpected %q", strings.Join(fields, ` `))
+	}
+
+	switch {
+	case quoted && uri == `.`:
+		// generated modules always import their own directory
+		return nil
+	case quoted && version != ``, quoted && strings.HasPrefix(uri, `qrc:`) && alias != ``:
+		self.unsupported(start, "import %s", line)
+	case quoted && strings.HasPrefix(uri, `qrc:`):
+		module.Imports = append(module.Imports, uri)
+	case quoted && strings.ToLower(filepath.Ext(uri)) == `.js` && scriptImportAlias(uri) == ``:
+		self.unsupported(start, "import %s", line)
+	case quoted && strings.ToLower(filepath.Ext(uri)) == `.js` && alias == scriptImportAlias(uri):
+		module.Imports = append(module.Imports, uri)
+	case quoted && alias != ``:
+		module.Imports = append(module.Imports, alias+`:`+uri)
+	case quoted:
+		module.Imports = append(module.Imports, uri)
+	case version == ``:
+		self.unsupported(start, "imports without a version (%s)", uri)
+	case alias != ``:
+		module.Imports = append(module.Imports, alias+`:`+uri+` `+version)
+	default:
+		module.Imports = append(module.Imports, uri+` `+version)
+	}
+
+	return nil
+}
+
+// reads the body of an object of the given type, starting at its opening brace.
+func (self *qmlParser) object(typeName string) (*Component, error) {
+	var component = NewComponent(typeName)
+
+	if self.skipSpace(true); self.peek() != '{' {
+		return nil, self.fail(self.pos, "expected '{' after %s", typeName)
+	}
+
+	self.pos++
+
+	if err := self.members(component, ``); err != nil {
+		return nil, err
+	}
+
+	return component, nil
+}
+
+// reads the members of an object (or of a group of properties like: anchors { ... }, whose names
+// are given the prefix "anchors.") up to and including its closing brace.
+func (self *qmlParser) members(component *Component, prefix string) error {
+	for {
+		self.skipSpace(true)
+
+		switch c := self.peek(); {
+		case c == '}':
+			self.pos++
+			return nil
+		case c == ';':
+			self.pos++
+		case c == 0:
+			return self.fail(self.pos, "unexpected end of file in %s", component.Type)
+		case !isQmlIdentifierStart(c):
+			return self.fail(self.pos, "unexpected %q in %s", c, component.Type)
+		default:
+			if err := self.member(component, prefix); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (self *qmlParser) member(component *Component, prefix string) error {
+	var start = self.pos
+	var name = self.name()
+
+	if self.skipSpace(false); prefix == `` && self.peek() != ':' && self.peek() != '{' {
+		switch name {
+		case `property`, `readonly`, `default`, `required`:
+			return self.propertyDeclaration(component, name, start)
+		case `signal`:
+			return self.signalDeclaration(component)
+		case `function`:
+			return self.functionDeclaration(component, start)
+		case `enum`, `component`:
+			self.unsupported(start, "%s declarations", name)
+
+			for self.pos < len(self.data) && self.peek() != '{' {
+				self.pos++
+			}
+
+			_, err := self.bracketed()
+			return err
+		}
+	}
+
+	if isQmlTypeName(name) {
+		if self.keyword(`on`) {
+			target := self.name()
+
+			if name == `Behavior` && prefix == `` {
+				return self.behavior(component, target, start)
+			} else if _, err := self.object(name); err == nil {
+				self.unsupported(start, "property value sources (%s on %s)", name, target)
+			} else {
+				return err
+			}
+		} else if child, err := self.object(name); err == nil {
+			if prefix == `` {
+				component.Components = append(component.Components, child)
+			} else {
+				self.unsupported(start, "objects within grouped properties (%s%s)", prefix, name)
+			}
+		} else {
+			return err
+		}
+
+		return nil
+	}
+
+	switch self.peek() {
+	case ':':
+		self.pos++
+		name = prefix + name
+
+		if name == `id` {
+			self.skipSpace(false)
+
+			if component.ID = self.name(); component.ID == `` {
+				return self.fail(self.pos, "expected an id")
+			}
+		} else if value, err := self.value(name); err == nil {
+			if value != nil {
+				component.Set(name, value)
+			}
+		} else {
+			return err
+		}
+
+		return nil
+	case '{':
+		self.pos++
+		return self.members(component, prefix+name+`.`)
+	default:
+		return self.fail(self.pos, "expected ':' or '{' after %s", name)
+	}
+}
+
+func (self *qmlParser) propertyDeclaration(component *Component, keyword string, start int) error {
+	var property = new(Property)
+
+	for keyword != `property` {
+		switch keyword {
+		case `readonly`:
+			property.ReadOnly = true
+		case `default`, `required`:
+			self.unsupported(start, "%s properties", keyword)
+		default:
+			return self.fail(start, "expected a property declaration")
+		}
+
+		self.skipSpace(false)
+		keyword = self.name()
+	}
+
+	self.skipSpace(false)
+	property.Type = self.typeName()
+	self.skipSpace(false)
+
+	if property.Name = self.name(); property.Type == `` || property.Name == `` {
+		return self.fail(start, "expected a property type and name")
+	}
+
+	if self.skipSpace(false); self.peek() == ':' {
+		self.pos++
+
+		if value, err := self.value(property.Name); err == nil {
+			property.setValue(value)
+		} else {
+			return err
+		}
+	}
+
+	component.Public = append(component.Public, property)
+	return nil
+}
+
+func (self *qmlParser) signalDeclaration(component *Component) error {
+	var signal = &Signal{
+		Name: self.name(),
+	}
+
+	if self.skipSpace(false); self.peek() == '(' {
+		var start = self.pos
+
+		if args, err := self.bracketed(); err == nil {
+			for _, arg := range splitQml(args, ',') {
+				if pair := strings.SplitN(arg, `:`, 2); len(pair) == 2 {
+					signal.Arguments = append(signal.Arguments, Argument{
+						Name: strings.TrimSpace(pair[0]),
+						Type: strings.TrimSpace(pair[1]),
+					})
+				} else if fields := strings.Fields(arg); len(fields) == 2 {
+					signal.Arguments = append(signal.Arguments, Argument{
+						Name: fields[1],
+						Type: fields[0],
+					})
+				} else {
+					return self.fail(start, "signal %s: bad argument %q", signal.Name, arg)
+				}
+			}
+		} else {
+			return err
+		}
+	}
+
+	component.Signals = append(component.Signals, signal)
+	return nil
+}
+
+func (self *qmlParser) functionDeclaration(component *Component, start int) error {
+	var fn = Function{
+		Name: self.name(),
+	}
+
+	if self.skipSpace(false); self.peek() != '(' {
+		return self.fail(self.pos, "function %s: expected '('", fn.Name)
+	} else if args, err := self.bracketed(); err == nil {
+		fn.Arguments = splitQml(args, ',')
+	} else {
+		return err
+	}
+
+	if self.skipSpace(true); self.peek() == ':' {
+		self.unsupported(self.pos, "function %s: return types", fn.Name)
+		self.pos++
+		self.skipSpace(false)
+		self.typeName()
+		self.skipSpace(true)
+	}
+
+	if self.peek() != '{' {
+		return self.fail(self.pos, "function %s: expected '{'", fn.Name)
+	} else if body, err := self.bracketed(); err == nil {
+		fn.Definition = strings.Join(qmlStatements(body), "\n")
+	} else {
+		return err
+	}
+
+	if fn.Definition == `` {
+		self.unsupported(start, "function %s: empty functions", fn.Name)
+	} else if env(fn.Definition) != fn.Definition {
+		self.unsupported(start, "function %s: environment variable references are expanded", fn.Name)
+	} else {
+		component.Functions = append(component.Functions, fn)
+	}
+
+	return nil
+}
+
+// reads a "Behavior on <target> { ... }" declaration, which must hold only an animation.
+func (self *qmlParser) behavior(component *Component, target string, start int) error {
+	if holder, err := self.object(`Behavior`); err == nil {
+		if animations := holder.Components; len(animations) == 1 {
+			holder.Components = nil
+
+			if !holder.HasContent() && holder.ID == `` && len(holder.Signals) == 0 && len(holder.Functions) == 0 && len(holder.Behaviors) == 0 {
+				component.Behaviors = append(component.Behaviors, Behavior{
+					For:       target,
+					Animation: animations[0],
+				})
+
+				return nil
+			}
+		}
+
+		self.unsupported(start, "behavior on %s: anything other than a single animation", target)
+		return nil
+	} else {
+		return err
+	}
+}
+
+// reads the value bound to the named property, returning nil if it can't be expressed.
+func (self *qmlParser) value(name string) (interface{}, error) {
+	self.skipSpace(true)
+
+	var start = self.pos
+
+	// an object, e.g.: delegate: Rectangle { ... }
+	if typeName := self.name(); isQmlTypeName(typeName) {
+		if self.skipSpace(false); self.peek() == '{' {
+			if inline, err := self.object(typeName); err == nil {
+				return inlineComponentValue(name, inline)
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	self.pos = start
+
+	switch self.peek() {
+	case '{':
+		if body, err := self.bracketed(); err == nil {
+			// objects (as generated from maps)
+			if value, ok := qmlLiteral(`{` + body + `}`); ok {
+				if sliceutil.ContainsString(ElementalProperties, name) {
+					value.(map[string]interface{})[ForceInlineKey] = false
+				}
+
+				return value, nil
+			}
+
+			return self.blockValue(name, body, start), nil
+		} else {
+			return nil, err
+		}
+	case '[':
+		self.pos++
+		self.skipSpace(true)
+		typeName := self.name()
+		self.skipSpace(true)
+		isObjectList := (isQmlTypeName(typeName) && self.peek() == '{')
+		self.pos = start
+
+		if isObjectList {
+			self.unsupported(start, "lists of objects (%s)", name)
+			_, err := self.bracketed()
+			return nil, err
+		}
+	}
+
+	// functions generated from multi-line values are read back into the same
+	if match := rxQmlGeneratedFunction.FindString(self.data[self.pos:]); match != `` {
+		self.pos += len(match) - 1
+
+		if body, err := self.bracketed(); err == nil {
+			if self.skipSpace(false); strings.IndexByte("\n;}", self.peek()) >= 0 {
+				if value := strings.Join(qmlLines(body), "\n") + "\n"; env(value) == value {
+					return value, nil
+				}
+			}
+		} else {
+			return nil, err
+		}
+
+		self.pos = start
+	}
+
+	if expr, err := self.expression(); err == nil {
+		return self.expressionValue(name, expr, start), nil
+	} else {
+		return nil, err
+	}
+}
+
+// returns the value of a binding to a block of statements.  Signal handlers become multi-line
+// strings (or a single expression), while other properties can only return a value.
+func (self *qmlParser) blockValue(name string, body string, start int) interface{} {
+	var statements = qmlStatements(body)
+
+	if handler := name[strings.LastIndexByte(name, '.')+1:]; isSignalHandler(handler) {
+		if len(statements) == 1 {
+			return self.expressionValue(name, statements[0], start)
+		} else if value := strings.Join(statements, "\n"); env(value) == value {
+			return value
+		} else {
+			self.unsupported(start, "%s: environment variable references are expanded", name)
+			return nil
+		}
+	} else if len(statements) == 1 && strings.HasPrefix(statements[0], `return `) {
+		return self.expressionValue(name, strings.TrimPrefix(statements[0], `return `), start)
+	}
+
+	self.unsupported(start, "%s: blocks of statements outside of signal handlers", name)
+	return nil
+}
+
+// returns the given expression as a literal value if it is one hydra would write the same way,
+// or as a {JavaScript} expression.
+func (self *qmlParser) expressionValue(name string, expr string, start int) interface{} {
+	if value, ok := qmlLiteral(expr); ok {
+		return value
+	} else if env(expr) != expr {
+		self.unsupported(start, "%s: environment variable references are expanded", name)
+		return nil
+	}
+
+	return `{` + expr + `}`
+}
+
+// reads the expression at the current position, up to the end of the statement, returning it
+// on a single line without comments.
+func (self *qmlParser) expression() (string, error) {
+	var start = self.pos
+	var out strings.Builder
+	var brackets []byte
+
+	for self.pos < len(self.data) {
+		var c = self.data[self.pos]
+
+		if begin := self.pos; self.skipLiteral() {
+			if c == '/' {
+				out.WriteByte(' ')
+			} else {
+				out.WriteString(self.data[begin:self.pos])
+			}
+
+			continue
+		}
+
+		switch c {
+		case '(', '[', '{':
+			brackets = append(brackets, c)
+		case ')', ']', '}':
+			if len(brackets) == 0 {
+				if c == '}' {
+					return self.finishExpression(start, out.String())
+				}
+
+				return ``, self.fail(self.pos, "unexpected %q", c)
+			}
+
+			brackets = brackets[:len(brackets)-1]
+		case ';':
+			if len(brackets) == 0 {
+				return self.finishExpression(start, out.String())
+			}
+		case '\n':
+			var prev = strings.TrimRight(out.String(), " \t\r")
+
+			if len(brackets) == 0 && !self.continues(prev) {
+				return self.finishExpression(start, out.String())
+			}
+
+			self.pos++
+			self.skipSpace(false)
+			out.Reset()
+			out.WriteString(prev)
+
+			// lines within a block become statements on the same line
+			if len(brackets) > 0 && brackets[len(brackets)-1] == '{' && prev != `` && strings.IndexByte("{;,", prev[len(prev)-1]) < 0 && self.peek() != '}' && self.peek() != '\n' {
+				out.WriteString(`; `)
+			} else {
+				out.WriteByte(' ')
+			}
+
+			continue
+		}
+
+		out.WriteByte(c)
+		self.pos++
+	}
+
+	if len(brackets) > 0 {
+		return ``, self.fail(start, "unterminated expression")
+	}
+
+	return self.finishExpression(start, out.String())
+}
+
+func (self *qmlParser) finishExpression(start int, expr string) (string, error) {
+	var collapsed []string
+
+	// remove the doubled-up spaces left by joining lines and removing comments
+	for _, part := range splitQml(expr, ' ') {
+		if part != `` {
+			collapsed = append(collapsed, part)
+		}
+	}
+
+	if len(collapsed) == 0 {
+		return ``, self.fail(start, "expected a value")
+	}
+
+	return strings.Join(collapsed, ` `), nil
+}
+
+// reports whether an expression continues past the end of the given (previous) line, because it
+// or the next line begins or ends with an operator.
+func (self *qmlParser) continues(prev string) bool {
+	if prev == `` || strings.IndexByte("+-*/%&|^!~?:=<>,.", prev[len(prev)-1]) >= 0 {
+		return true
+	}
+
+	var next = strings.TrimLeft(self.data[self.pos:], " \t\r\n")
+
+	if next == `` || strings.HasPrefix(next, `//`) || strings.HasPrefix(next, `/*`) {
+		return false
+	}
+
+	return (strings.IndexByte("?:.+-*/%&|^=<>,", next[0]) >= 0)
+}
+
+// returns the given value for a property set to an object, which is inlined into the QML
+// rather than declared as a child component (see ElementalProperties and ForceInlineKey).
+// The value is ordered, so that it keeps the order the inline component was declared in.
+func inlineComponentValue(name string, inline *Component) (interface{}, error) {
+	var value yaml.MapSlice
+
+	// this is the same form the value takes when it is read back from YAML
+	if data, err := yaml.Marshal(inline); err == nil {
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	if !sliceutil.ContainsString(ElementalProperties, name) {
+		value = append(yaml.MapSlice{{Key: ForceInlineKey, Value: true}}, value...)
+	}
+
+	return value, nil
+}
+
+// parses the given expression as a string, number, boolean, or a list or object of them,
+// reporting whether it was one (that qmlvalue would write back out the same way).
+func qmlLiteral(expr string) (interface{}, bool) {
+	// single-quoted strings (without quotes inside them) are made JSON
+	if len(expr) > 1 && strings.HasPrefix(expr, `'`) && strings.HasSuffix(expr, `'`) {
+		if inner := expr[1 : len(expr)-1]; !strings.ContainsAny(inner, `'"\`) {
+			expr = `"` + inner + `"`
+		}
+	}
+
+	var value interface{}
+	var reader = strings.NewReader(expr)
+	var decoder = json.NewDecoder(reader)
+
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	} else if rest, _ := ioutil.ReadAll(decoder.Buffered()); reader.Len() > 0 || strings.TrimSpace(string(rest)) != `` {
+		return nil, false
+	}
+
+	return qmlLiteralValue(value)
+}
+
+func qmlLiteralValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return i, true
+		} else if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+	case bool:
+		return v, true
+	case string:
+		if qmlstring(v) == `` && env(v) == v {
+			return v, true
+		}
+	case map[string]interface{}:
+		var out = make(map[string]interface{})
+
+		for key, item := range v {
+			if item, ok := qmlLiteralValue(item); ok {
+				out[key] = item
+			} else {
+				return nil, false
+			}
+		}
+
+		return out, true
+	case []interface{}:
+		var out = make([]interface{}, 0, len(v))
+
+		for _, item := range v {
+			if item, ok := qmlLiteralValue(item); ok {
+				out = append(out, item)
+			} else {
+				return nil, false
+			}
+		}
+
+		return out, true
+	}
+
+	return nil, false
+}
+
+// returns the statements in the given block, one per line with their common indentation removed.
+// A block written on a single line is split into its statements.
+func qmlStatements(body string) []string {
+	if statements := qmlLines(body); len(statements) == 1 {
+		return splitQml(statements[0], ';')
+	} else {
+		return statements
+	}
+}
+
+// returns the non-blank lines of the given block with their common indentation removed.
+func qmlLines(body string) []string {
+	var first string
+	var rest []string
+	var indent = -1
+
+	for i, line := range strings.Split(strings.Replace(body, "\r", ``, -1), "\n") {
+		if strings.TrimSpace(line) == `` {
+			continue
+		} else if i == 0 {
+			// text on the same line as the opening brace doesn't count towards the indentation
+			first = strings.TrimSpace(line)
+			continue
+		}
+
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+
+		rest = append(rest, strings.TrimRight(line, " \t"))
+	}
+
+	var lines []string
+
+	if first != `` {
+		lines = append(lines, first)
+	}
+
+	for _, line := range rest {
+		lines = append(lines, line[indent:])
+	}
+
+	return lines
+}
+
+// splits the given QML (or JavaScript) on the given separator, wherever it appears outside of
+// strings, comments and brackets.  Parts are trimmed, and empty ones are left out.
+func splitQml(text string, sep byte) (parts []string) {
+	var scanner = &qmlParser{
+		data: text,
+	}
+
+	var depth int
+	var last int
+
+	for scanner.pos < len(text) {
+		if scanner.skipLiteral() {
+			continue
+		}
+
+		switch c := text[scanner.pos]; {
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			if part := strings.TrimSpace(text[last:scanner.pos]); part != `` {
+				parts = append(parts, part)
+			}
+
+			last = scanner.pos + 1
+		}
+
+		scanner.pos++
+	}
+
+	if part := strings.TrimSpace(text[last:]); part != `` {
+		parts = append(parts, part)
+	}
+
+	return
+}
+
+func isQmlIdentifierStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+func isQmlIdentifierChar(c byte) bool {
+	return isQmlIdentifierStart(c) || (c >= '0' && c <= '9')
+}
+
+// reports whether the given name is that of an object type (e.g.: Rectangle or Controls.Button)
+// rather than a property.
+func isQmlTypeName(name string) bool {
+	if name = name[strings.LastIndexByte(name, '.')+1:]; name != `` {
+		return unicode.IsUpper(rune(name[0]))
+	}
+
+	return false
+}
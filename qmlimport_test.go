@@ -0,0 +1,210 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseQML(t *testing.T) {
+	assert := require.New(t)
+
+	module, err := ParseQML(`Panel.qml`, []byte(`pragma Singleton
+import QtQuick 2.15
+import QtQuick.Controls 2.15 as QQC
+import "util.js" as Util
+import "js/format.js" as Fmt
+import "components"
+import "."
+
+// a panel with a title and a list of items
+Rectangle {
+    id: panel
+    signal activated(string name, int index)
+    property string title: "Untitled"
+    readonly property int count: list.count
+    property var selected
+
+    width: 200; height: parent.height * 0.5
+    color: panel.selected ? "#336699"
+                          : "transparent"
+    tags: ['a', "b", 3]
+    anchors {
+        top: parent.top
+        margins: 10
+    }
+
+    Behavior on opacity {
+        NumberAnimation { duration: 200 }
+    }
+
+    function select(name, index) {
+        selected = name
+        if (index >= 0) {
+            activated(name, index) // notify
+        }
+    }
+
+    ListView {
+        id: list
+        delegate: Text { text: modelData }
+        onCurrentIndexChanged: select(currentItem.text, currentIndex)
+        Component.onCompleted: {
+            console.log("ready")
+            positionViewAtEnd()
+        }
+    }
+}
+`))
+
+	assert.NoError(err)
+	assert.Equal(`Panel`, module.Name)
+	assert.True(module.Singleton)
+	assert.Equal([]string{
+		`QtQuick 2.15`,
+		`QQC:QtQuick.Controls 2.15`,
+		`util.js`,
+		`Fmt:js/format.js`,
+		`components`,
+	}, module.Imports)
+
+	panel := module.Definition
+	assert.Equal(`Rectangle`, panel.Type)
+	assert.Equal(`panel`, panel.ID)
+	assert.Len(panel.Signals, 1)
+	assert.Equal([]Argument{{Name: `name`, Type: `string`}, {Name: `index`, Type: `int`}}, panel.Signals[0].Arguments)
+	assert.Len(panel.Public, 3)
+	assert.Equal(`Untitled`, panel.Public[0].Value)
+	assert.True(panel.Public[1].ReadOnly)
+	assert.Equal(`{list.count}`, panel.Public[1].Value)
+	assert.Nil(panel.Public[2].Value)
+
+	assert.Equal([]string{
+		`width`,
+		`height`,
+		`color`,
+		`tags`,
+		`anchors.top`,
+		`anchors.margins`,
+	}, panel.PropertyNames())
+
+	assert.Equal(200, panel.Properties[`width`])
+	assert.Equal(`{parent.height * 0.5}`, panel.Properties[`height`])
+	assert.Equal(`{panel.selected ? "#336699" : "transparent"}`, panel.Properties[`color`])
+	assert.Equal(`{['a', "b", 3]}`, panel.Properties[`tags`])
+	assert.Equal(10, panel.Properties[`anchors.margins`])
+
+	assert.Len(panel.Behaviors, 1)
+	assert.Equal(`opacity`, panel.Behaviors[0].For)
+	assert.Equal(`NumberAnimation`, panel.Behaviors[0].Animation.Type)
+
+	assert.Len(panel.Functions, 1)
+	assert.Equal([]string{`name`, `index`}, panel.Functions[0].Arguments)
+	assert.Equal("selected = name\nif (index >= 0) {\n    activated(name, index) // notify\n}", panel.Functions[0].Definition)
+
+	assert.Len(panel.Components, 1)
+	list := panel.Components[0]
+	assert.Equal(`list`, list.ID)
+	assert.Equal("console.log(\"ready\")\npositionViewAtEnd()", list.Properties[`Component.onCompleted`])
+	assert.Equal(`{select(currentItem.text, currentIndex)}`, list.Properties[`onCurrentIndexChanged`])
+
+	// the module generates the same QML once it has been written out as YAML and read back in
+	imported, err := panel.QML(0)
+	assert.NoError(err)
+	assert.Contains(string(imported), "delegate: Text {\n      text: modelData\n    }")
+
+	data, err := yaml.Marshal(module)
+	assert.NoError(err)
+
+	var reloaded Module
+	assert.NoError(yaml.UnmarshalStrict(data, &reloaded))
+
+	regenerated, err := reloaded.Definition.QML(0)
+	assert.NoError(err)
+	assert.Equal(string(imported), string(regenerated))
+}
+
+func TestParseQMLGolden(t *testing.T) {
+	assert := require.New(t)
+
+	files, err := filepath.Glob(`testdata/generate/*/golden/*.qml`)
+	assert.NoError(err)
+
+	nested, err := filepath.Glob(`testdata/generate/*/golden/*/*.qml`)
+	assert.NoError(err)
+
+	for _, file := range append(files, nested...) {
+		golden, err := ioutil.ReadFile(file)
+		assert.NoError(err)
+
+		module, err := ImportQML(file)
+		assert.NoError(err, file)
+
+		qml, err := module.Definition.QML(0)
+		assert.NoError(err)
+
+		// everything after the imports
+		var lines = strings.Split(string(golden), "\n")
+
+		for len(lines) > 0 && (strings.HasPrefix(lines[0], `import `) || strings.HasPrefix(lines[0], `pragma `) || lines[0] == ``) {
+			lines = lines[1:]
+		}
+
+		assert.Equal(strings.Join(lines, "\n"), string(qml), file)
+	}
+}
+
+func TestParseQMLUnsupported(t *testing.T) {
+	assert := require.New(t)
+
+	module, err := ParseQML(`List.qml`, []byte(`import QtQuick
+Item {
+    enum Mode { Off, On }
+    required property int size
+    states: [
+        State { name: "open" }
+    ]
+    NumberAnimation on x { to: 50 }
+    width: { var w = 5; return w * 2 }
+    Text {}
+}
+`))
+
+	assert.NotNil(module)
+	assert.Len(module.Definition.Components, 1)
+
+	diags, ok := err.(Diagnostics)
+	assert.True(ok)
+
+	var messages []string
+
+	for _, diag := range diags {
+		messages = append(messages, diag.String())
+	}
+
+	assert.Equal([]string{
+		`List.qml:1:1: not supported: imports without a version (QtQuick)`,
+		`List.qml:3:5: not supported: enum declarations`,
+		`List.qml:4:5: not supported: required properties`,
+		`List.qml:5:13: not supported: lists of objects (states)`,
+		`List.qml:8:5: not supported: property value sources (NumberAnimation on x)`,
+		`List.qml:9:12: not supported: width: blocks of statements outside of signal handlers`,
+	}, messages)
+
+	// scripts named only for their extension have no qualifier to import them by
+	module, err = ParseQML(`Script.qml`, []byte("import \".js\" as X\nItem {}\n"))
+	assert.NotNil(module)
+	assert.Empty(module.Imports)
+	assert.EqualError(err, `Script.qml:1:1: not supported: import ".js" as X`)
+
+	_, err = toImportStatement(`lib/.js`)
+	assert.Error(err)
+
+	module, err = ParseQML(`Broken.qml`, []byte("Item {\n    width: 5\n"))
+	assert.Nil(module)
+	assert.EqualError(err, `Broken.qml:3:1: unexpected end of file in Item`)
+}
@@ -0,0 +1,103 @@
+package hydra
+
+// A snapshot of the commonly-used types from the QtQml, QtQuick, QtQuick.Window, QtQuick.Controls
+// (2.x), and QtQuick.Layouts modules.  This is not exhaustive; more complete type information can
+// be loaded from the .qmltypes files shipped with Qt using TypeCatalog.LoadFile.
+const builtinQmlTypes = `[
+{"name": "QtObject", "module": "QtQml", "properties": ["objectName"], "signals": ["destroyed"]},
+{"name": "Component", "module": "QtQml", "prototype": "QtObject", "properties": ["progress", "status", "url"], "signals": ["completed", "destruction"]},
+{"name": "Connections", "module": "QtQml", "prototype": "QtObject", "properties": ["target", "enabled", "ignoreUnknownSignals"]},
+{"name": "Binding", "module": "QtQml", "prototype": "QtObject", "properties": ["target", "property", "value", "when", "delayed", "restoreMode"]},
+{"name": "Timer", "module": "QtQml", "prototype": "QtObject", "properties": ["interval", "repeat", "running", "triggeredOnStart"], "signals": ["triggered"]},
+{"name": "Instantiator", "module": "QtQml", "prototype": "QtObject", "properties": ["active", "asynchronous", "count", "delegate", "model", "object"], "signals": ["objectAdded", "objectRemoved"]},
+
+{"name": "Item", "module": "QtQuick", "prototype": "QtObject", "properties": ["activeFocus", "activeFocusOnTab", "anchors", "antialiasing", "baselineOffset", "children", "childrenRect", "clip", "containmentMask", "data", "enabled", "focus", "height", "implicitHeight", "implicitWidth", "layer", "opacity", "parent", "resources", "rotation", "scale", "smooth", "state", "states", "transform", "transformOrigin", "transitions", "visible", "visibleChildren", "width", "x", "y", "z"]},
+{"name": "FocusScope", "module": "QtQuick", "prototype": "Item"},
+{"name": "Rectangle", "module": "QtQuick", "prototype": "Item", "properties": ["border", "color", "gradient", "radius"]},
+{"name": "Text", "module": "QtQuick", "prototype": "Item", "properties": ["advance", "baseUrl", "bottomPadding", "color", "contentHeight", "contentWidth", "effectiveHorizontalAlignment", "elide", "font", "fontInfo", "fontSizeMode", "horizontalAlignment", "hoveredLink", "leftPadding", "lineCount", "lineHeight", "lineHeightMode", "linkColor", "maximumLineCount", "minimumPixelSize", "minimumPointSize", "padding", "renderType", "rightPadding", "style", "styleColor", "text", "textFormat", "topPadding", "truncated", "verticalAlignment", "wrapMode"], "signals": ["lineLaidOut", "linkActivated", "linkHovered"]},
+{"name": "TextInput", "module": "QtQuick", "prototype": "Item", "properties": ["acceptableInput", "activeFocusOnPress", "autoScroll", "bottomPadding", "canPaste", "canRedo", "canUndo", "color", "contentHeight", "contentWidth", "cursorDelegate", "cursorPosition", "cursorRectangle", "cursorVisible", "displayText", "echoMode", "font", "horizontalAlignment", "inputMask", "inputMethodComposing", "inputMethodHints", "leftPadding", "length", "maximumLength", "mouseSelectionMode", "overwriteMode", "padding", "passwordCharacter", "passwordMaskDelay", "persistentSelection", "preeditText", "readOnly", "renderType", "rightPadding", "selectByMouse", "selectedText", "selectedTextColor", "selectionColor", "selectionEnd", "selectionStart", "text", "topPadding", "validator", "verticalAlignment", "wrapMode"], "signals": ["accepted", "editingFinished", "textEdited"]},
+{"name": "TextEdit", "module": "QtQuick", "prototype": "Item", "properties": ["activeFocusOnPress", "baseUrl", "bottomPadding", "canPaste", "canRedo", "canUndo", "color", "contentHeight", "contentWidth", "cursorDelegate", "cursorPosition", "cursorRectangle", "cursorVisible", "font", "horizontalAlignment", "hoveredLink", "inputMethodComposing", "inputMethodHints", "leftPadding", "length", "lineCount", "mouseSelectionMode", "overwriteMode", "padding", "persistentSelection", "preeditText", "readOnly", "renderType", "rightPadding", "selectByKeyboard", "selectByMouse", "selectedText", "selectedTextColor", "selectionColor", "selectionEnd", "selectionStart", "tabStopDistance", "text", "textDocument", "textFormat", "textMargin", "topPadding", "verticalAlignment", "wrapMode"], "signals": ["editingFinished", "linkActivated", "linkHovered"]},
+{"name": "Image", "module": "QtQuick", "prototype": "Item", "properties": ["asynchronous", "autoTransform", "cache", "fillMode", "horizontalAlignment", "mipmap", "mirror", "paintedHeight", "paintedWidth", "progress", "source", "sourceClipRect", "sourceSize", "status", "verticalAlignment"]},
+{"name": "AnimatedImage", "module": "QtQuick", "prototype": "Image", "properties": ["currentFrame", "frameCount", "paused", "playing", "speed"]},
+{"name": "BorderImage", "module": "QtQuick", "prototype": "Item", "properties": ["asynchronous", "border", "cache", "horizontalTileMode", "mirror", "progress", "source", "sourceSize", "status", "verticalTileMode"]},
+{"name": "Canvas", "module": "QtQuick", "prototype": "Item", "properties": ["available", "canvasSize", "context", "contextType", "renderStrategy", "renderTarget"], "signals": ["imageLoaded", "paint", "painted"]},
+{"name": "MouseArea", "module": "QtQuick", "prototype": "Item", "properties": ["acceptedButtons", "containsMouse", "containsPress", "cursorShape", "drag", "hoverEnabled", "mouseX", "mouseY", "pressAndHoldInterval", "pressed", "pressedButtons", "preventStealing", "propagateComposedEvents", "scrollGestureEnabled"], "signals": ["canceled", "clicked", "doubleClicked", "entered", "exited", "positionChanged", "pressAndHold", "pressed", "released", "wheel"]},
+{"name": "MultiPointTouchArea", "module": "QtQuick", "prototype": "Item", "properties": ["maximumTouchPoints", "minimumTouchPoints", "mouseEnabled", "touchPoints"], "signals": ["canceled", "gestureStarted", "pressed", "released", "touchUpdated", "updated"]},
+{"name": "Flickable", "module": "QtQuick", "prototype": "Item", "properties": ["atXBeginning", "atXEnd", "atYBeginning", "atYEnd", "bottomMargin", "boundsBehavior", "boundsMovement", "contentHeight", "contentItem", "contentWidth", "contentX", "contentY", "dragging", "draggingHorizontally", "draggingVertically", "flickDeceleration", "flickableDirection", "flicking", "flickingHorizontally", "flickingVertically", "horizontalOvershoot", "horizontalVelocity", "interactive", "leftMargin", "maximumFlickVelocity", "moving", "movingHorizontally", "movingVertically", "originX", "originY", "pixelAligned", "pressDelay", "rebound", "rightMargin", "synchronousDrag", "topMargin", "verticalOvershoot", "verticalVelocity", "visibleArea"], "signals": ["flickEnded", "flickStarted", "movementEnded", "movementStarted"]},
+{"name": "ListView", "module": "QtQuick", "prototype": "Flickable", "properties": ["add", "addDisplaced", "cacheBuffer", "count", "currentIndex", "currentItem", "currentSection", "delegate", "displaceMarginBeginning", "displaceMarginEnd", "displaced", "effectiveLayoutDirection", "footer", "footerItem", "footerPositioning", "header", "headerItem", "headerPositioning", "highlight", "highlightFollowsCurrentItem", "highlightItem", "highlightMoveDuration", "highlightMoveVelocity", "highlightRangeMode", "highlightResizeDuration", "highlightResizeVelocity", "keyNavigationEnabled", "keyNavigationWraps", "layoutDirection", "model", "move", "moveDisplaced", "orientation", "populate", "preferredHighlightBegin", "preferredHighlightEnd", "remove", "removeDisplaced", "section", "snapMode", "spacing", "verticalLayoutDirection"]},
+{"name": "GridView", "module": "QtQuick", "prototype": "Flickable", "properties": ["add", "addDisplaced", "cacheBuffer", "cellHeight", "cellWidth", "count", "currentIndex", "currentItem", "delegate", "displaceMarginBeginning", "displaceMarginEnd", "displaced", "effectiveLayoutDirection", "flow", "footer", "footerItem", "header", "headerItem", "highlight", "highlightFollowsCurrentItem", "highlightItem", "highlightMoveDuration", "highlightRangeMode", "keyNavigationEnabled", "keyNavigationWraps", "layoutDirection", "model", "move", "moveDisplaced", "populate", "preferredHighlightBegin", "preferredHighlightEnd", "remove", "removeDisplaced", "snapMode", "verticalLayoutDirection"]},
+{"name": "PathView", "module": "QtQuick", "prototype": "Item", "properties": ["cacheItemCount", "count", "currentIndex", "currentItem", "delegate", "dragMargin", "dragging", "flickDeceleration", "flicking", "highlight", "highlightItem", "highlightMoveDuration", "highlightRangeMode", "interactive", "maximumFlickVelocity", "model", "movementDirection", "moving", "offset", "path", "pathItemCount", "preferredHighlightBegin", "preferredHighlightEnd", "snapMode"], "signals": ["dragEnded", "dragStarted", "flickEnded", "flickStarted", "movementEnded", "movementStarted"]},
+{"name": "Repeater", "module": "QtQuick", "prototype": "Item", "properties": ["count", "delegate", "model"], "signals": ["itemAdded", "itemRemoved"]},
+{"name": "Loader", "module": "QtQuick", "prototype": "Item", "properties": ["active", "asynchronous", "item", "progress", "source", "sourceComponent", "status"], "signals": ["loaded"]},
+{"name": "Column", "module": "QtQuick", "prototype": "Item", "properties": ["add", "bottomPadding", "leftPadding", "move", "padding", "populate", "rightPadding", "spacing", "topPadding"], "signals": ["positioningComplete"]},
+{"name": "Row", "module": "QtQuick", "prototype": "Item", "properties": ["add", "bottomPadding", "effectiveLayoutDirection", "layoutDirection", "leftPadding", "move", "padding", "populate", "rightPadding", "spacing", "topPadding"], "signals": ["positioningComplete"]},
+{"name": "Grid", "module": "QtQuick", "prototype": "Item", "properties": ["add", "bottomPadding", "columnSpacing", "columns", "effectiveHorizontalItemAlignment", "effectiveLayoutDirection", "flow", "horizontalItemAlignment", "layoutDirection", "leftPadding", "move", "padding", "populate", "rightPadding", "rowSpacing", "rows", "spacing", "topPadding", "verticalItemAlignment"], "signals": ["positioningComplete"]},
+{"name": "Flow", "module": "QtQuick", "prototype": "Item", "properties": ["add", "bottomPadding", "effectiveLayoutDirection", "flow", "layoutDirection", "leftPadding", "move", "padding", "populate", "rightPadding", "spacing", "topPadding"], "signals": ["positioningComplete"]},
+{"name": "ListModel", "module": "QtQuick", "prototype": "QtObject", "properties": ["count", "dynamicRoles"]},
+{"name": "ListElement", "module": "QtQuick", "prototype": "QtObject"},
+{"name": "FontLoader", "module": "QtQuick", "prototype": "QtObject", "properties": ["name", "source", "status"]},
+{"name": "Gradient", "module": "QtQuick", "prototype": "QtObject", "properties": ["orientation", "stops"]},
+{"name": "GradientStop", "module": "QtQuick", "prototype": "QtObject", "properties": ["color", "position"]},
+{"name": "Shortcut", "module": "QtQuick", "prototype": "QtObject", "properties": ["autoRepeat", "context", "enabled", "nativeText", "portableText", "sequence", "sequences"], "signals": ["activated", "activatedAmbiguously"]},
+{"name": "State", "module": "QtQuick", "prototype": "QtObject", "properties": ["changes", "extend", "name", "when"]},
+{"name": "PropertyChanges", "module": "QtQuick", "prototype": "QtObject", "properties": ["explicit", "restoreEntryValues", "target"]},
+{"name": "Transition", "module": "QtQuick", "prototype": "QtObject", "properties": ["animations", "enabled", "from", "reversible", "running", "to"]},
+{"name": "Behavior", "module": "QtQuick", "prototype": "QtObject", "properties": ["animation", "enabled"]},
+{"name": "Animation", "module": "QtQuick", "prototype": "QtObject", "properties": ["alwaysRunToEnd", "loops", "paused", "running"], "signals": ["finished", "started", "stopped"]},
+{"name": "PropertyAnimation", "module": "QtQuick", "prototype": "Animation", "properties": ["duration", "easing", "exclude", "from", "properties", "property", "target", "targets", "to"]},
+{"name": "NumberAnimation", "module": "QtQuick", "prototype": "PropertyAnimation"},
+{"name": "ColorAnimation", "module": "QtQuick", "prototype": "PropertyAnimation"},
+{"name": "RotationAnimation", "module": "QtQuick", "prototype": "PropertyAnimation", "properties": ["direction"]},
+{"name": "SmoothedAnimation", "module": "QtQuick", "prototype": "NumberAnimation", "properties": ["maximumEasingTime", "reversingMode", "velocity"]},
+{"name": "SpringAnimation", "module": "QtQuick", "prototype": "NumberAnimation", "properties": ["damping", "epsilon", "mass", "modulus", "spring", "velocity"]},
+{"name": "SequentialAnimation", "module": "QtQuick", "prototype": "Animation", "properties": ["animations"]},
+{"name": "ParallelAnimation", "module": "QtQuick", "prototype": "Animation", "properties": ["animations"]},
+{"name": "PauseAnimation", "module": "QtQuick", "prototype": "Animation", "properties": ["duration"]},
+{"name": "ScriptAction", "module": "QtQuick", "prototype": "Animation", "properties": ["script", "scriptName"]},
+{"name": "PropertyAction", "module": "QtQuick", "prototype": "Animation", "properties": ["exclude", "properties", "property", "target", "targets", "value"]},
+
+{"name": "Window", "module": "QtQuick.Window", "prototype": "QtObject", "properties": ["active", "activeFocusItem", "color", "contentItem", "contentOrientation", "data", "flags", "height", "maximumHeight", "maximumWidth", "minimumHeight", "minimumWidth", "modality", "opacity", "screen", "title", "transientParent", "visibility", "visible", "width", "x", "y"], "signals": ["activeFocusItemChanged", "afterRendering", "beforeRendering", "closing", "frameSwapped", "sceneGraphError"]},
+
+{"name": "Control", "module": "QtQuick.Controls", "prototype": "Item", "properties": ["availableHeight", "availableWidth", "background", "bottomInset", "bottomPadding", "contentItem", "focusPolicy", "focusReason", "font", "horizontalPadding", "hoverEnabled", "hovered", "leftInset", "leftPadding", "locale", "mirrored", "padding", "palette", "rightInset", "rightPadding", "spacing", "topInset", "topPadding", "verticalPadding", "visualFocus", "wheelEnabled"]},
+{"name": "AbstractButton", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["action", "autoExclusive", "autoRepeat", "autoRepeatDelay", "autoRepeatInterval", "checkable", "checked", "display", "down", "icon", "indicator", "pressX", "pressY", "pressed", "text"], "signals": ["canceled", "clicked", "doubleClicked", "pressAndHold", "pressed", "released", "toggled"]},
+{"name": "Button", "module": "QtQuick.Controls", "prototype": "AbstractButton", "properties": ["flat", "highlighted"]},
+{"name": "RoundButton", "module": "QtQuick.Controls", "prototype": "Button", "properties": ["radius"]},
+{"name": "ToolButton", "module": "QtQuick.Controls", "prototype": "Button"},
+{"name": "CheckBox", "module": "QtQuick.Controls", "prototype": "AbstractButton", "properties": ["checkState", "tristate"]},
+{"name": "RadioButton", "module": "QtQuick.Controls", "prototype": "AbstractButton"},
+{"name": "Switch", "module": "QtQuick.Controls", "prototype": "AbstractButton", "properties": ["position", "visualPosition"]},
+{"name": "TabButton", "module": "QtQuick.Controls", "prototype": "AbstractButton"},
+{"name": "MenuItem", "module": "QtQuick.Controls", "prototype": "AbstractButton", "properties": ["arrow", "highlighted", "menu", "subMenu"], "signals": ["triggered"]},
+{"name": "Label", "module": "QtQuick.Controls", "prototype": "Text", "properties": ["background", "bottomInset", "leftInset", "palette", "rightInset", "topInset"]},
+{"name": "TextField", "module": "QtQuick.Controls", "prototype": "TextInput", "properties": ["background", "bottomInset", "focusReason", "hoverEnabled", "hovered", "leftInset", "palette", "placeholderText", "placeholderTextColor", "rightInset", "topInset"], "signals": ["pressAndHold", "pressed", "released"]},
+{"name": "TextArea", "module": "QtQuick.Controls", "prototype": "TextEdit", "properties": ["background", "bottomInset", "focusReason", "hoverEnabled", "hovered", "leftInset", "palette", "placeholderText", "placeholderTextColor", "rightInset", "topInset"], "signals": ["pressAndHold", "pressed", "released"]},
+{"name": "Slider", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["from", "handle", "horizontal", "live", "orientation", "position", "pressed", "snapMode", "stepSize", "to", "touchDragThreshold", "value", "vertical", "visualPosition"], "signals": ["moved"]},
+{"name": "RangeSlider", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["first", "from", "horizontal", "live", "orientation", "second", "snapMode", "stepSize", "to", "touchDragThreshold", "vertical"]},
+{"name": "Dial", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["from", "handle", "inputMode", "live", "position", "pressed", "snapMode", "stepSize", "to", "value", "wrap"], "signals": ["moved"]},
+{"name": "SpinBox", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["displayText", "down", "editable", "from", "inputMethodComposing", "inputMethodHints", "stepSize", "textFromValue", "to", "up", "validator", "value", "valueFromText", "wrap"], "signals": ["valueModified"]},
+{"name": "ProgressBar", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["from", "indeterminate", "position", "to", "value", "visualPosition"]},
+{"name": "BusyIndicator", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["running"]},
+{"name": "ComboBox", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["acceptableInput", "count", "currentIndex", "currentText", "delegate", "displayText", "down", "editText", "editable", "flat", "highlightedIndex", "indicator", "inputMethodComposing", "inputMethodHints", "model", "popup", "pressed", "textRole", "validator"], "signals": ["accepted", "activated", "highlighted"]},
+{"name": "Pane", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["contentChildren", "contentData", "contentHeight", "contentWidth"]},
+{"name": "Frame", "module": "QtQuick.Controls", "prototype": "Pane"},
+{"name": "GroupBox", "module": "QtQuick.Controls", "prototype": "Frame", "properties": ["label", "title"]},
+{"name": "Page", "module": "QtQuick.Controls", "prototype": "Pane", "properties": ["footer", "header", "implicitFooterHeight", "implicitFooterWidth", "implicitHeaderHeight", "implicitHeaderWidth", "title"]},
+{"name": "ToolBar", "module": "QtQuick.Controls", "prototype": "Pane", "properties": ["position"]},
+{"name": "ScrollView", "module": "QtQuick.Controls", "prototype": "Pane"},
+{"name": "Container", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["contentChildren", "contentData", "contentModel", "count", "currentIndex", "currentItem"]},
+{"name": "TabBar", "module": "QtQuick.Controls", "prototype": "Container", "properties": ["contentHeight", "contentWidth", "position"]},
+{"name": "SwipeView", "module": "QtQuick.Controls", "prototype": "Container", "properties": ["horizontal", "interactive", "orientation", "vertical"]},
+{"name": "StackView", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["busy", "currentItem", "depth", "empty", "initialItem", "popEnter", "popExit", "pushEnter", "pushExit", "replaceEnter", "replaceExit"]},
+{"name": "ScrollBar", "module": "QtQuick.Controls", "prototype": "Control", "properties": ["active", "horizontal", "interactive", "minimumSize", "orientation", "policy", "position", "pressed", "size", "snapMode", "stepSize", "vertical", "visualPosition", "visualSize"]},
+{"name": "Popup", "module": "QtQuick.Controls", "prototype": "QtObject", "properties": ["activeFocus", "anchors", "availableHeight", "availableWidth", "background", "bottomInset", "bottomMargin", "bottomPadding", "clip", "closePolicy", "contentChildren", "contentData", "contentHeight", "contentItem", "contentWidth", "dim", "enabled", "enter", "exit", "focus", "font", "height", "horizontalPadding", "implicitHeight", "implicitWidth", "leftInset", "leftMargin", "leftPadding", "locale", "margins", "mirrored", "modal", "opacity", "opened", "padding", "palette", "parent", "rightInset", "rightMargin", "rightPadding", "scale", "spacing", "topInset", "topMargin", "topPadding", "verticalPadding", "visible", "width", "x", "y", "z"], "signals": ["aboutToHide", "aboutToShow", "closed", "opened"]},
+{"name": "Dialog", "module": "QtQuick.Controls", "prototype": "Popup", "properties": ["footer", "header", "implicitFooterHeight", "implicitFooterWidth", "implicitHeaderHeight", "implicitHeaderWidth", "result", "standardButtons", "title"], "signals": ["accepted", "applied", "discarded", "helpRequested", "rejected", "reset"]},
+{"name": "Drawer", "module": "QtQuick.Controls", "prototype": "Popup", "properties": ["dragMargin", "edge", "interactive", "position"]},
+{"name": "Menu", "module": "QtQuick.Controls", "prototype": "Popup", "properties": ["cascade", "contentModel", "count", "currentIndex", "delegate", "focus", "overlap", "title"]},
+{"name": "ToolTip", "module": "QtQuick.Controls", "prototype": "Popup", "properties": ["delay", "text", "timeout"]},
+{"name": "ApplicationWindow", "module": "QtQuick.Controls", "prototype": "Window", "properties": ["activeFocusControl", "background", "contentData", "contentItem", "font", "footer", "header", "locale", "menuBar", "palette"]},
+
+{"name": "RowLayout", "module": "QtQuick.Layouts", "prototype": "Item", "properties": ["layoutDirection", "spacing"]},
+{"name": "ColumnLayout", "module": "QtQuick.Layouts", "prototype": "Item", "properties": ["layoutDirection", "spacing"]},
+{"name": "GridLayout", "module": "QtQuick.Layouts", "prototype": "Item", "properties": ["columnSpacing", "columns", "flow", "layoutDirection", "rowSpacing", "rows"]},
+{"name": "StackLayout", "module": "QtQuick.Layouts", "prototype": "Item", "properties": ["count", "currentIndex"]}
+]`
@@ -0,0 +1,672 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+	"github.com/ghetzel/go-stockutil/maputil"
+	"github.com/ghetzel/go-stockutil/rxutil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+	"github.com/ghetzel/go-stockutil/stringutil"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+type TypeCheckMode int
+
+const (
+	TypeCheckOff TypeCheckMode = iota
+	TypeCheckWarn
+	TypeCheckFail
+)
+
+// Parses the given type checking mode (off, warn, or fail), returning an error if it is not
+// recognized.
+func ParseTypeCheckMode(str string) (TypeCheckMode, error) {
+	switch str {
+	case `off`, ``:
+		return TypeCheckOff, nil
+	case `warn`:
+		return TypeCheckWarn, nil
+	case `fail`, `error`:
+		return TypeCheckFail, nil
+	default:
+		return TypeCheckOff, fmt.Errorf("invalid type check mode %q (expected off, warn, or fail)", str)
+	}
+}
+
+// Same as ParseTypeCheckMode, but logs a warning and disables type checking if the mode is
+// not recognized.
+func TypeCheckModeFromString(str string) TypeCheckMode {
+	if mode, err := ParseTypeCheckMode(str); err == nil {
+		return mode
+	} else {
+		log.Warningf("%v, type checking is disabled", err)
+		return TypeCheckOff
+	}
+}
+
+// Describes a QML type: the properties and signals it declares, and the type it inherits
+// from (if any).
+type QmlType struct {
+	Name       string   `json:"name"`
+	Module     string   `json:"module,omitempty"`
+	Prototype  string   `json:"prototype,omitempty"`
+	Properties []string `json:"properties,omitempty"`
+	Signals    []string `json:"signals,omitempty"`
+	cppName    string
+}
+
+// A TypeCatalog is a collection of known QML types that generated components can be checked
+// against, so that misspelled types, properties, and signal handlers are caught before the
+// QML is ever run.
+type TypeCatalog struct {
+	types   map[string]*QmlType
+	modules []string
+}
+
+func NewTypeCatalog() *TypeCatalog {
+	return &TypeCatalog{
+		types: make(map[string]*QmlType),
+	}
+}
+
+// Returns a new catalog populated with the bundled snapshot of the QtQml, QtQuick,
+// QtQuick.Window, QtQuick.Controls, and QtQuick.Layouts types.
+func DefaultTypeCatalog() *TypeCatalog {
+	catalog := NewTypeCatalog()
+
+	if err := catalog.LoadJSON(strings.NewReader(builtinQmlTypes)); err != nil {
+		panic("builtin qml types: " + err.Error())
+	}
+
+	return catalog
+}
+
+// Adds a type to the catalog, replacing any existing type of the same name.
+func (self *TypeCatalog) Add(qtype *QmlType) {
+	if qtype == nil || qtype.Name == `` {
+		return
+	}
+
+	self.types[qtype.Name] = qtype
+
+	if qtype.cppName != `` {
+		self.types[qtype.cppName] = qtype
+	}
+
+	if qtype.Module != `` && !sliceutil.ContainsString(self.modules, qtype.Module) {
+		self.modules = append(self.modules, qtype.Module)
+		sort.Strings(self.modules)
+	}
+}
+
+// Retrieves a type by name.  Qualified names (e.g.: "Controls.Button") are looked up by their
+// unqualified name.
+func (self *TypeCatalog) Get(name string) (*QmlType, bool) {
+	_, name = stringutil.SplitPairRightTrailing(name, `.`)
+
+	qtype, ok := self.types[name]
+	return qtype, ok
+}
+
+// Returns the names of all QML modules (e.g.: "QtQuick.Controls") the catalog has types for.
+func (self *TypeCatalog) Modules() []string {
+	return self.modules
+}
+
+// Returns whether the named type (or any type it inherits from) declares the given property.
+func (self *TypeCatalog) HasProperty(typeName string, property string) bool {
+	return self.walk(typeName, func(qtype *QmlType) bool {
+		return sliceutil.ContainsString(qtype.Properties, property)
+	})
+}
+
+// Returns whether the named type (or any type it inherits from) declares the given signal.
+func (self *TypeCatalog) HasSignal(typeName string, signal string) bool {
+	return self.walk(typeName, func(qtype *QmlType) bool {
+		return sliceutil.ContainsString(qtype.Signals, signal)
+	})
+}
+
+func (self *TypeCatalog) walk(typeName string, fn func(*QmlType) bool) bool {
+	seen := make(map[string]bool)
+
+	for qtype, ok := self.Get(typeName); ok && !seen[qtype.Name]; qtype, ok = self.Get(qtype.Prototype) {
+		if fn(qtype) {
+			return true
+		}
+
+		seen[qtype.Name] = true
+	}
+
+	return false
+}
+
+// Loads types from a file, either a JSON array of types or a Qt .qmltypes file.
+func (self *TypeCatalog) LoadFile(filename string) error {
+	if fn, err := fileutil.ExpandUser(filename); err == nil {
+		if file, err := os.Open(fn); err == nil {
+			defer file.Close()
+
+			switch strings.ToLower(filepath.Ext(fn)) {
+			case `.json`:
+				err = self.LoadJSON(file)
+			default:
+				err = self.LoadQmltypes(file)
+			}
+
+			if err != nil {
+				return fmt.Errorf("qmltypes %s: %v", filename, err)
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// Loads types from a JSON array of type definitions.
+func (self *TypeCatalog) LoadJSON(reader io.Reader) error {
+	var types []*QmlType
+
+	if err := json.NewDecoder(reader).Decode(&types); err == nil {
+		for _, qtype := range types {
+			self.Add(qtype)
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+// Loads types from a Qt .qmltypes file (as generated by qmlplugindump).  Only types that are
+// exported to QML are added, though the C++ names of all types are used to resolve the types
+// they inherit from.
+func (self *TypeCatalog) LoadQmltypes(reader io.Reader) error {
+	if data, err := ioutil.ReadAll(reader); err == nil {
+		if root, err := parseQmltypes(string(data)); err == nil {
+			if root.Type != `Module` {
+				return fmt.Errorf("expected a Module, got %q", root.Type)
+			}
+
+			for _, component := range root.Children {
+				if component.Type != `Component` {
+					continue
+				}
+
+				qtype := &QmlType{
+					cppName:   component.String(`name`),
+					Prototype: component.String(`prototype`),
+				}
+
+				for _, member := range component.Children {
+					switch member.Type {
+					case `Property`:
+						qtype.Properties = append(qtype.Properties, member.String(`name`))
+					case `Signal`:
+						qtype.Signals = append(qtype.Signals, member.String(`name`))
+					}
+				}
+
+				// exports take the form "Module/Name Major.Minor"
+				for _, export := range component.Strings(`exports`) {
+					export, _ = stringutil.SplitPair(export, ` `)
+					qtype.Module, qtype.Name = stringutil.SplitPairRightTrailing(export, `/`)
+				}
+
+				if qtype.Name == `` {
+					qtype.Name = qtype.cppName
+				}
+
+				self.Add(qtype)
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// Adds a type for the given application module, named after the file it will be generated
+// into.  The module's public properties and signals are added to those of its definition's type.
+func (self *TypeCatalog) AddModule(module *Module) {
+	if defn := module.Definition; defn != nil {
+		base := filepath.Base(module.RelativePath())
+
+		qtype := &QmlType{
+			Name:      strings.TrimSuffix(base, filepath.Ext(base)),
+			Prototype: defn.Type,
+		}
+
+		for _, prop := range defn.Public {
+			qtype.Properties = append(qtype.Properties, prop.Name)
+		}
+
+		for _, sig := range defn.Signals {
+			qtype.Signals = append(qtype.Signals, sig.Name)
+		}
+
+		self.Add(qtype)
+	}
+}
+
+// Returns whether the catalog knows about every versioned (i.e.: not local) import in the
+// given list.  Unknown types are only reported if this is true, otherwise the type may well
+// come from a module the catalog doesn't know about.
+func (self *TypeCatalog) covers(imports []string) bool {
+	for _, imp := range imports {
+		parts := rxutil.Whitespace.Split(strings.TrimSpace(env(imp)), 2)
+
+		if len(parts) > 1 {
+			_, lib := stringutil.SplitPairTrailing(parts[0], `:`)
+
+			if !sliceutil.ContainsString(self.modules, lib) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Checks the module's component tree against the types in this catalog, reporting unknown
+// types, properties, and signal handlers.
+func (self *TypeCatalog) Check(module *Module) Diagnostics {
+	v := &validator{
+		filename: module.sourceFile,
+	}
+
+	if defn := module.Definition; defn != nil {
+		node := orNode(mapValue(module.sourceNode, `definition`), module.sourceNode)
+		self.checkComponent(v, defn, node, self.covers(module.Imports))
+	}
+
+	return v.diagnostics
+}
+
+func (self *TypeCatalog) checkComponent(v *validator, component *Component, node *yamlv3.Node, strict bool) {
+	if component.Type == `` {
+		return
+	}
+
+	var publics []string
+	var signals []string
+
+	for _, prop := range component.Public {
+		publics = append(publics, prop.Name)
+	}
+
+	for _, sig := range component.Signals {
+		signals = append(signals, sig.Name)
+	}
+
+	if _, ok := self.Get(component.Type); ok {
+		for _, name := range component.PropertyNames() {
+			propNode := orNode(mapKey(mapValue(node, `properties`), name), node)
+			first, _ := splitPropertyName(name)
+
+			switch propertyRank(name) {
+			case 0, 3: // the id and attached properties are always allowed
+				continue
+			case 2:
+				signal := string(unicode.ToLower(rune(name[2]))) + name[3:]
+
+				if sliceutil.ContainsString(signals, signal) || self.HasSignal(component.Type, signal) {
+					continue
+				} else if prop := strings.TrimSuffix(signal, `Changed`); prop != signal {
+					if sliceutil.ContainsString(publics, prop) || self.HasProperty(component.Type, prop) {
+						continue
+					}
+				}
+
+				v.add(propNode, "%s has no signal %q for handler %q", component.Type, signal, name)
+			default:
+				if sliceutil.ContainsString(publics, first) || self.HasProperty(component.Type, first) {
+					continue
+				}
+
+				v.add(propNode, "%s has no property %q", component.Type, first)
+			}
+		}
+	} else if strict {
+		v.add(orNode(mapValue(node, `type`), node), "unknown type %q", component.Type)
+	}
+
+	for i, behavior := range component.Behaviors {
+		if behavior.Animation != nil {
+			bNode := seqItem(mapValue(node, `behaviors`), i, node)
+			self.checkComponent(v, behavior.Animation, orNode(mapValue(bNode, `animation`), bNode), strict)
+		}
+	}
+
+	for _, name := range component.PropertyNames() {
+		prop := Property{
+			Name:  name,
+			Value: component.Properties[name],
+		}
+
+		if prop.shouldInline() {
+			inline := new(Component)
+
+			if err := maputil.TaggedStructFromMap(prop.Value, inline, `json`); err == nil {
+				self.checkComponent(v, inline, orNode(mapValue(mapValue(node, `properties`), name), node), strict)
+			}
+		}
+	}
+
+	for i, child := range component.Components {
+		if child != nil {
+			self.checkComponent(v, child, component.childNode(node, i), strict)
+		}
+	}
+}
+
+// Builds a catalog from the bundled types, any additional type files given in the options,
+// and the given modules, then checks every module against it.  If none of the modules is the
+// application entrypoint, the given entrypoint module is checked as well.
+func (self *Application) checkTypes(options GenerateOptions, modules []*Module, entrypoint *Module) error {
+	var checked = modules
+
+	for _, module := range modules {
+		if module.RelativePath() == EntrypointFilename {
+			entrypoint = nil
+		}
+	}
+
+	if entrypoint != nil {
+		checked = append(checked, entrypoint)
+	}
+
+	return checkModuleTypes(options, modules, checked...)
+}
+
+// checks the given modules against a catalogue built from the known QML types and all modules,
+// failing or warning according to the given options.
+func checkModuleTypes(options GenerateOptions, modules []*Module, checked ...*Module) error {
+	if options.TypeCheck == TypeCheckOff {
+		return nil
+	}
+
+	catalog := DefaultTypeCatalog()
+
+	for _, filename := range options.TypeFiles {
+		if err := catalog.LoadFile(filename); err != nil {
+			return err
+		}
+	}
+
+	for _, module := range modules {
+		catalog.AddModule(module)
+	}
+
+	var diags Diagnostics
+
+	for _, module := range checked {
+		diags = append(diags, catalog.Check(module)...)
+	}
+
+	if len(diags) > 0 {
+		switch options.TypeCheck {
+		case TypeCheckFail:
+			return diags
+		default:
+			for _, diag := range diags {
+				log.Warningf("typecheck: %v", diag)
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns the key node for the given key of a mapping node, or nil.
+func mapKey(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node != nil && node.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// a generic object in a .qmltypes file, e.g.: Component { name: "QQuickItem"; ... }
+type qmltypesObject struct {
+	Type       string
+	Attributes map[string]interface{}
+	Children   []*qmltypesObject
+}
+
+func (self *qmltypesObject) String(key string) string {
+	if v, ok := self.Attributes[key].(string); ok {
+		return v
+	}
+
+	return ``
+}
+
+func (self *qmltypesObject) Strings(key string) (out []string) {
+	if values, ok := self.Attributes[key].([]interface{}); ok {
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+
+	return
+}
+
+type qmltypesParser struct {
+	tokens []string
+	pos    int
+}
+
+// parses the QML-like object notation used by .qmltypes files, returning the top-level object.
+func parseQmltypes(data string) (*qmltypesObject, error) {
+	parser := &qmltypesParser{
+		tokens: tokenizeQmltypes(data),
+	}
+
+	// skip import statements
+	for parser.peek() == `import` {
+		for parser.pos < len(parser.tokens) && parser.tokens[parser.pos] != "\n" {
+			parser.pos++
+		}
+
+		parser.skipSeparators()
+	}
+
+	parser.skipSeparators()
+
+	return parser.object()
+}
+
+func tokenizeQmltypes(data string) (tokens []string) {
+	for i := 0; i < len(data); {
+		c := data[i]
+
+		switch {
+		case c == '\n':
+			tokens = append(tokens, "\n")
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(data[i:], `//`):
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(data[i:], `/*`):
+			if end := strings.Index(data[i+2:], `*/`); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(data)
+			}
+		case c == '"':
+			j := i + 1
+
+			for j < len(data) && data[j] != '"' {
+				if data[j] == '\\' {
+					j++
+				}
+
+				j++
+			}
+
+			if j >= len(data) {
+				j = len(data) - 1
+			}
+
+			tokens = append(tokens, data[i:j+1])
+			i = j + 1
+		case strings.ContainsRune(`{}[]:;,`, rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+
+			for j < len(data) && !strings.ContainsRune(" \t\r\n{}[]:;,\"", rune(data[j])) {
+				j++
+			}
+
+			tokens = append(tokens, data[i:j])
+			i = j
+		}
+	}
+
+	return
+}
+
+func (self *qmltypesParser) peek() string {
+	if self.pos < len(self.tokens) {
+		return self.tokens[self.pos]
+	}
+
+	return ``
+}
+
+func (self *qmltypesParser) next() string {
+	tok := self.peek()
+	self.pos++
+	return tok
+}
+
+func (self *qmltypesParser) skipSeparators() {
+	for self.peek() == "\n" || self.peek() == `;` {
+		self.pos++
+	}
+}
+
+func (self *qmltypesParser) skipNewlines() {
+	for self.peek() == "\n" {
+		self.pos++
+	}
+}
+
+func (self *qmltypesParser) object() (*qmltypesObject, error) {
+	obj := &qmltypesObject{
+		Type:       self.next(),
+		Attributes: make(map[string]interface{}),
+	}
+
+	self.skipNewlines()
+
+	if tok := self.next(); tok != `{` {
+		return nil, fmt.Errorf("expected '{' after %s, got %q", obj.Type, tok)
+	}
+
+	for {
+		self.skipSeparators()
+
+		switch tok := self.peek(); tok {
+		case `}`:
+			self.pos++
+			return obj, nil
+		case ``:
+			return nil, fmt.Errorf("unexpected end of input in %s", obj.Type)
+		default:
+			if self.pos+1 < len(self.tokens) && self.tokens[self.pos+1] == `:` {
+				self.pos += 2
+
+				if value, err := self.value(); err == nil {
+					obj.Attributes[tok] = value
+				} else {
+					return nil, err
+				}
+			} else if child, err := self.object(); err == nil {
+				obj.Children = append(obj.Children, child)
+			} else {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (self *qmltypesParser) value() (interface{}, error) {
+	self.skipNewlines()
+
+	switch tok := self.next(); tok {
+	case `[`:
+		var values []interface{}
+
+		for {
+			self.skipNewlines()
+
+			switch self.peek() {
+			case `]`:
+				self.pos++
+				return values, nil
+			case `,`:
+				self.pos++
+			case ``:
+				return nil, fmt.Errorf("unterminated list")
+			default:
+				if v, err := self.value(); err == nil {
+					values = append(values, v)
+				} else {
+					return nil, err
+				}
+			}
+		}
+	case `{`:
+		// object literals (e.g.: enum values) are skipped
+		for depth := 1; depth > 0; {
+			switch self.next() {
+			case `{`:
+				depth++
+			case `}`:
+				depth--
+			case ``:
+				return nil, fmt.Errorf("unterminated object")
+			}
+		}
+
+		return nil, nil
+	case ``:
+		return nil, fmt.Errorf("expected value")
+	default:
+		if strings.HasPrefix(tok, `"`) {
+			return strings.Trim(tok, `"`), nil
+		}
+
+		return tok, nil
+	}
+}
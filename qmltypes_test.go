@@ -0,0 +1,80 @@
+package hydra
+
+import (
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestTypeCatalogQmltypes(t *testing.T) {
+	assert := require.New(t)
+	catalog := NewTypeCatalog()
+
+	assert.NoError(catalog.LoadFile(`testdata/qmltypes/plugins.qmltypes`))
+	assert.Equal([]string{`Acme.Gauges`, `QtQuick`}, catalog.Modules())
+
+	gauge, ok := catalog.Get(`Gauge`)
+	assert.True(ok)
+	assert.Equal(`QQuickItem`, gauge.Prototype)
+	assert.Equal([]string{`value`, `minimum`, `maximum`}, gauge.Properties)
+
+	_, ok = catalog.Get(`Acme.Gauge`)
+	assert.True(ok)
+
+	assert.True(catalog.HasProperty(`Gauge`, `maximum`))
+	assert.True(catalog.HasProperty(`Gauge`, `width`))
+	assert.False(catalog.HasProperty(`Gauge`, `colour`))
+	assert.True(catalog.HasSignal(`Gauge`, `overflowed`))
+}
+
+func TestTypeCatalogCheck(t *testing.T) {
+	assert := require.New(t)
+	catalog := DefaultTypeCatalog()
+	app := new(Application)
+
+	assert.NoError(FromFile(app, `testdata/qmltypes/app.yaml`))
+
+	var messages []string
+
+	for _, diag := range catalog.Check(&app.Module) {
+		messages = append(messages, diag.String())
+	}
+
+	assert.Equal([]string{
+		`testdata/qmltypes/app.yaml:12:13: unknown type "Rectangel"`,
+		`testdata/qmltypes/app.yaml:15:9: Rectangle has no property "colour"`,
+		`testdata/qmltypes/app.yaml:17:9: Rectangle has no signal "clicked" for handler "onClicked"`,
+	}, messages)
+
+	for _, filename := range []string{
+		`testdata/generate/basic/src/app.yaml`,
+		`testdata/generate/layout/src/app.yaml`,
+		`testdata/generate/units/src/app.yaml`,
+	} {
+		app := new(Application)
+
+		assert.NoError(FromFile(app, filename))
+		assert.Empty(catalog.Check(&app.Module), filename)
+	}
+}
+
+func TestParseTypeCheckMode(t *testing.T) {
+	assert := require.New(t)
+
+	for str, expected := range map[string]TypeCheckMode{
+		``:      TypeCheckOff,
+		`off`:   TypeCheckOff,
+		`warn`:  TypeCheckWarn,
+		`fail`:  TypeCheckFail,
+		`error`: TypeCheckFail,
+	} {
+		mode, err := ParseTypeCheckMode(str)
+		assert.NoError(err)
+		assert.Equal(expected, mode)
+	}
+
+	_, err := ParseTypeCheckMode(`warning`)
+	assert.Error(err)
+	assert.Contains(err.Error(), `invalid type check mode "warning"`)
+	assert.Equal(TypeCheckOff, TypeCheckModeFromString(`warning`))
+}
@@ -39,12 +39,13 @@ func qrcSkipFile(filename string) bool {
 	}
 
 	switch ext {
-	case `.qmlc`, `.jsc`:
+	case `.qmlc`, `.jsc`, SourceMapSuffix:
 		return true
-	case `.yaml`:
-		qml := fileutil.SetExt(filename, `.qml`, `.yaml`)
-		return fileutil.FileExists(qml)
 	default:
+		if IsDocumentFile(filename) {
+			return fileutil.FileExists(fileutil.SetExt(filename, `.qml`))
+		}
+
 		return false
 	}
 }
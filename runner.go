@@ -2,6 +2,7 @@ package hydra
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -45,6 +46,14 @@ type RunOptions struct {
 	ServeAddress          string
 	ServeRoot             string
 	ContainmentStrategy   RunContainment
+	Reload                <-chan bool
+	OnExit                func(err error) bool // called when the application exits by itself; return true to start it again
+	Supervise             bool                 // restart the application whenever it exits (see SupervisorState)
+	RestartDelay          time.Duration        // delay before restarting after a crash, doubling with each one
+	MaxRestartDelay       time.Duration        // the longest the restart delay grows to
+	CrashWindow           time.Duration        // the period over which crashes are counted
+	MaxCrashes            int                  // crashes within the window after which a build is reverted
+	HealthyAfter          time.Duration        // how long a build must run to be considered known-good
 }
 
 func (self *RunOptions) Valid() error {
@@ -57,6 +66,15 @@ func (self *RunOptions) Valid() error {
 	return nil
 }
 
+// asks an application run with the given channel as its RunOptions.Reload to reload (if it is
+// running at all); requests are coalesced if one is already pending.
+func requestReload(reload chan<- bool) {
+	select {
+	case reload <- true:
+	default:
+	}
+}
+
 func RunWithOptions(fromDir string, options RunOptions) error {
 	if err := options.Valid(); err == nil {
 		absBuildDir, _ := filepath.Abs(fromDir)
@@ -85,19 +103,33 @@ func RunWithOptions(fromDir string, options RunOptions) error {
 		qmlargs = append(qmlargs, filepath.Base(entrypoint))
 
 		var errchan = make(chan error)
+		var stopping = make(chan struct{})
 		var dcid = fmt.Sprintf("hydra-%s", stringutil.UUID().Base58())
 
+		var supervisor *supervisor
+
+		if options.Supervise {
+			supervisor = newSupervisor(fromDir, options)
+		}
+
 		if srvaddr := options.ServeAddress; srvaddr != `` {
 			log.Debugf("starting HTTP server at %s", srvaddr)
 
 			go func() {
 				ServeRoot = options.ServeRoot
-				errchan <- Serve(srvaddr, fromDir)
+
+				if supervisor != nil {
+					errchan <- serve(srvaddr, fromDir, map[string]http.Handler{
+						StatusPath: supervisor,
+					})
+				} else {
+					errchan <- Serve(srvaddr, fromDir)
+				}
 			}()
 		}
 
 		go func() {
-			var runner *executil.Cmd
+			var newRunner func() *executil.Cmd
 
 			switch options.ContainmentStrategy {
 			case DockerXcbContainment:
@@ -148,43 +180,151 @@ func RunWithOptions(fromDir string, options RunOptions) error {
 
 					// driargs := getDriDockerArgs()
 
-					runner = cmd(``,
-						`docker`,
-						`run`,
-						`--name`, dcid,
-						`--rm`,
-						`--interactive`,
-						`--network`, `host`,
-						`--volume`, absBuildDir+`:/app`,
-						`--volume`, `/tmp/.X11-unix:/tmp/.X11-unix`,
-						`--volume`, hydraXauth+`:/Xauthority`,
-						`--volume`, `/dev:/dev`,
-						`--env`, `TZ=`+executil.Env(`TZ`, `UTC`),
-						`--env`, `XAUTHORITY=/Xauthority`,
-						`--env`, `DISPLAY=`+xdisplay,
-						`--env`, `QT_QPA_PLATFORM=xcb`,
-						`--env`, `HYDRA_HOST=`+Domain,
-						`--env`, `HYDRA_ENV=`+Environment,
-						`--env`, `HYDRA_ID=`+ID,
-						DockerContainerQt,
-						`qmlscene`,
-						qmlargs)
+					newRunner = func() *executil.Cmd {
+						return cmd(``,
+							`docker`,
+							`run`,
+							`--name`, dcid,
+							`--rm`,
+							`--interactive`,
+							`--network`, `host`,
+							`--volume`, absBuildDir+`:/app`,
+							`--volume`, `/tmp/.X11-unix:/tmp/.X11-unix`,
+							`--volume`, hydraXauth+`:/Xauthority`,
+							`--volume`, `/dev:/dev`,
+							`--env`, `TZ=`+executil.Env(`TZ`, `UTC`),
+							`--env`, `XAUTHORITY=/Xauthority`,
+							`--env`, `DISPLAY=`+xdisplay,
+							`--env`, `QT_QPA_PLATFORM=xcb`,
+							`--env`, `HYDRA_HOST=`+Domain,
+							`--env`, `HYDRA_ENV=`+Environment,
+							`--env`, `HYDRA_ID=`+ID,
+							DockerContainerQt,
+							`qmlscene`,
+							qmlargs)
+					}
 				} else {
 					errchan <- fmt.Errorf("cannot contain using docker-xcb: no DISPLAY available")
+					return
 				}
 			case DockerLinuxfbContainment:
 				errchan <- fmt.Errorf("cannot contain using docker-linuxfb: not yet implemented")
 				return
 			default:
-				runner = cmd(fromDir, options.QmlsceneBin, qmlargs)
+				newRunner = func() *executil.Cmd {
+					return cmd(fromDir, options.QmlsceneBin, qmlargs)
+				}
 			}
 
-			log.Debugf("run[%s]: %s", runner.Dir, strings.Join(runner.Args, ` `))
-			errchan <- runner.Run()
+			// annotate QML warnings and errors with the YAML they came from
+			sources := newSourceMapTranslator(absBuildDir, `/app`)
+
+		run:
+			for {
+				runner := newRunner()
+				stderr := runner.OnStderr
+
+				runner.OnStderr = func(line string, serr bool) {
+					stderr(sources.Translate(line), serr)
+				}
+
+				log.Debugf("run[%s]: %s", runner.Dir, strings.Join(runner.Args, ` `))
+
+				if options.Reload == nil && options.OnExit == nil && supervisor == nil {
+					errchan <- runner.Run()
+					return
+				}
+
+				// when reloads are requested or the process is supervised, restart it as needed
+				var healthy <-chan time.Time
+
+				if supervisor != nil {
+					supervisor.starting()
+					healthy = time.After(supervisor.options.HealthyAfter)
+				}
+
+				if err := runner.Start(); err != nil {
+					errchan <- err
+					return
+				}
+
+				exited := make(chan error, 1)
+
+				go func() {
+					exited <- runner.WaitStatus().Error
+				}()
+
+				for {
+					select {
+					case err := <-exited:
+						// nothing is restarted once we've been asked to stop
+						select {
+						case <-stopping:
+							errchan <- err
+							return
+						default:
+						}
+
+						if options.OnExit != nil && options.OnExit(err) {
+							select {
+							case <-stopping:
+								errchan <- err
+								return
+							default:
+							}
+
+							log.Infof("Restarting %s", entrypoint)
+							continue run
+						}
+
+						if supervisor != nil {
+							delay := supervisor.exited(err)
+							log.Warningf("%s exited (%v), restarting in %v", entrypoint, err, delay)
+
+							select {
+							case <-time.After(delay):
+							case <-options.Reload:
+							case <-stopping:
+								errchan <- err
+								return
+							}
+
+							continue run
+						}
+
+						errchan <- err
+						return
+					case <-healthy:
+						supervisor.healthy()
+						healthy = nil
+					case <-options.Reload:
+						log.Infof("Reloading %s", entrypoint)
+
+						switch options.ContainmentStrategy {
+						case DockerXcbContainment:
+							executil.ShellCommand("docker kill " + dcid).Run()
+						default:
+							runner.Kill()
+						}
+
+						err := <-exited
+
+						select {
+						case <-stopping:
+							errchan <- err
+							return
+						default:
+						}
+
+						continue run
+					}
+				}
+			}
 		}()
 
 		executil.TrapSignals(func(sig os.Signal) bool {
 			log.Noticef("Got signal %v, killing %s...", sig, dcid)
+			close(stopping)
 
 			switch options.ContainmentStrategy {
 			case DockerXcbContainment:
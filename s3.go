@@ -0,0 +1,201 @@
+package hydra
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/executil"
+	"github.com/ghetzel/go-stockutil/sliceutil"
+)
+
+// The SHA-256 of an empty request body, as S3 expects it for GET requests.
+const s3EmptyPayloadHash = `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`
+
+// Retrieves objects from Amazon S3 or any store that speaks its API (MinIO, Ceph, R2, ...),
+// addressed as s3://<bucket>/<key>.  Requests are signed with AWS Signature Version 4 when
+// credentials are given, and made anonymously (for public buckets) otherwise.
+type S3Fetcher struct {
+	Endpoint        string // defaults to https://s3.<region>.amazonaws.com
+	Region          string // defaults to us-east-1
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	VirtualHosted   bool // address buckets as <bucket>.<endpoint host> rather than <endpoint>/<bucket>
+}
+
+// Returns an S3Fetcher configured from the environment: HYDRA_S3_ENDPOINT, AWS_REGION and the
+// usual AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func NewS3FetcherFromEnv() *S3Fetcher {
+	return &S3Fetcher{
+		Endpoint:        executil.Env(`HYDRA_S3_ENDPOINT`, executil.Env(`AWS_ENDPOINT_URL`)),
+		Region:          executil.Env(`AWS_REGION`, executil.Env(`AWS_DEFAULT_REGION`)),
+		AccessKeyID:     executil.Env(`AWS_ACCESS_KEY_ID`),
+		SecretAccessKey: executil.Env(`AWS_SECRET_ACCESS_KEY`),
+		SessionToken:    executil.Env(`AWS_SESSION_TOKEN`),
+	}
+}
+
+func (self *S3Fetcher) Fetch(request *FetchRequest) (*FetchResponse, error) {
+	if u, err := self.objectURL(request.URL); err == nil {
+		if req, err := http.NewRequest(http.MethodGet, u.String(), nil); err == nil {
+			if request.Offset > 0 {
+				req.Header.Set(`Range`, fmt.Sprintf("bytes=%d-", request.Offset))
+			}
+
+			if request.ETag != `` {
+				req.Header.Set(`If-None-Match`, request.ETag)
+			}
+
+			// requests are either signed or anonymous, never sent with other credentials
+			req = withOwnCredentials(req)
+
+			if self.AccessKeyID != `` {
+				self.sign(req, time.Now())
+			}
+
+			if res, err := doFetch(Client, req, request); err == nil {
+				res.Filename = path.Base(request.URL.Path)
+				return res, nil
+			} else if err == ErrNotModified {
+				return nil, err
+			} else {
+				return nil, fmt.Errorf("s3: %v", err)
+			}
+		} else {
+			return nil, fmt.Errorf("s3: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("s3: %v", err)
+	}
+}
+
+func (self *S3Fetcher) region() string {
+	return sliceutil.OrString(self.Region, `us-east-1`)
+}
+
+// returns the HTTP(S) URL of the object named by the given s3:// URL.
+func (self *S3Fetcher) objectURL(s3url *url.URL) (*url.URL, error) {
+	var bucket = s3url.Host
+	var key = strings.TrimPrefix(s3url.Path, `/`)
+
+	if bucket == `` || key == `` {
+		return nil, fmt.Errorf("expected s3://<bucket>/<key>, got %q", s3url.String())
+	}
+
+	endpoint, err := url.Parse(
+		sliceutil.OrString(self.Endpoint, `https://s3.`+self.region()+`.amazonaws.com`),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("bad endpoint: %v", err)
+	}
+
+	u := *endpoint
+
+	if self.VirtualHosted {
+		u.Host = bucket + `.` + endpoint.Host
+		u.Path = `/` + key
+	} else {
+		u.Path = strings.TrimSuffix(endpoint.Path, `/`) + `/` + bucket + `/` + key
+	}
+
+	u.RawPath = s3Escape(u.Path)
+	return &u, nil
+}
+
+// signs the request with AWS Signature Version 4 as it would be at the given time.
+func (self *S3Fetcher) sign(req *http.Request, at time.Time) {
+	var amzdate = at.UTC().Format(`20060102T150405Z`)
+	var scope = strings.Join([]string{amzdate[0:8], self.region(), `s3`, `aws4_request`}, `/`)
+
+	req.Header.Set(`X-Amz-Date`, amzdate)
+	req.Header.Set(`X-Amz-Content-Sha256`, s3EmptyPayloadHash)
+
+	if self.SessionToken != `` {
+		req.Header.Set(`X-Amz-Security-Token`, self.SessionToken)
+	}
+
+	// the host, the range (if any) and every x-amz-* header are signed
+	var headers = map[string]string{
+		`host`: req.URL.Host,
+	}
+
+	for name, values := range req.Header {
+		if name = strings.ToLower(name); name == `range` || strings.HasPrefix(name, `x-amz-`) {
+			headers[name] = strings.TrimSpace(strings.Join(values, `,`))
+		}
+	}
+
+	var names []string
+	var canonical strings.Builder
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(s3Escape(req.URL.Path) + "\n")
+	canonical.WriteString(strings.Replace(req.URL.Query().Encode(), `+`, `%20`, -1) + "\n")
+
+	for _, name := range names {
+		canonical.WriteString(name + `:` + headers[name] + "\n")
+	}
+
+	canonical.WriteString("\n" + strings.Join(names, `;`) + "\n" + s3EmptyPayloadHash)
+
+	digest := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := []byte(`AWS4` + self.SecretAccessKey)
+
+	for _, part := range strings.Split(scope, `/`) {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set(`Authorization`, fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		self.AccessKeyID,
+		scope,
+		strings.Join(names, `;`),
+		hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapes an object path the way S3 expects it in requests (and signatures): everything but
+// unreserved characters and slashes is percent-encoded.
+func s3Escape(p string) string {
+	var out strings.Builder
+
+	for _, b := range []byte(p) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9':
+			out.WriteByte(b)
+		case b == '-', b == '_', b == '.', b == '~', b == '/':
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+
+	return out.String()
+}
+
+func init() {
+	RegisterFetcher(`s3`, NewS3FetcherFromEnv())
+}
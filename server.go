@@ -3,6 +3,7 @@ package hydra
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"path/filepath"
 
 	"github.com/ghetzel/diecast"
@@ -14,6 +15,11 @@ var ServeRoot = `www`
 var DiecastConfig = `diecast.yml`
 
 func Serve(address string, rootDir string) error {
+	return serve(address, rootDir, nil)
+}
+
+// serves rootDir like Serve, along with the given handlers for any paths not found there.
+func serve(address string, rootDir string, handlers map[string]http.Handler) error {
 	if _, port, err := net.SplitHostPort(address); err == nil {
 		serveDir := rootDir
 		dcCfg := filepath.Join(rootDir, DiecastConfig)
@@ -29,6 +35,10 @@ func Serve(address string, rootDir string) error {
 		server.BindingPrefix = fmt.Sprintf("http://127.0.0.1:%s", port)
 		server.VerifyFile = ``
 
+		for route, handler := range handlers {
+			server.Get(route, handler.ServeHTTP)
+		}
+
 		log.Debugf("looking for Diecast config at: %s", dcCfg)
 
 		if fileutil.IsNonemptyFile(dcCfg) {
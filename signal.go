@@ -18,6 +18,7 @@ func (self Argument) String() string {
 type Signal struct {
 	Name      string     `yaml:"name" json:"name"`
 	Arguments []Argument `yaml:"args" json:"args"`
+	origin    *SourcePosition
 }
 
 func (self *Signal) QML() ([]byte, error) {
@@ -0,0 +1,255 @@
+package hydra
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+)
+
+const SignatureAlgorithm = `ed25519`
+
+// If any keys are present, manifests must carry a valid signature from one of them before
+// anything they list will be loaded or fetched.
+var TrustedKeys KeySet
+
+// A detached signature over the canonical serialization of a manifest.
+type ManifestSignature struct {
+	Algorithm string `yaml:"algorithm" json:"algorithm"`
+	KeyID     string `yaml:"key_id"    json:"key_id"`
+	Value     string `yaml:"value"     json:"value"`
+}
+
+type KeySet []ed25519.PublicKey
+
+// Returns the public key in this set with the given ID, if any.
+func (self KeySet) Get(keyID string) (ed25519.PublicKey, bool) {
+	for _, key := range self {
+		if KeyID(key) == keyID {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns a short identifier for the given public key, used to pick the key a signature was
+// made with out of a set of trusted keys.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Generates a new ed25519 key pair, returning each as a PEM-encoded block.
+func GenerateKeyPair() (pubPEM []byte, privPEM []byte, err error) {
+	if pub, priv, err := ed25519.GenerateKey(rand.Reader); err == nil {
+		if der, err := x509.MarshalPKIXPublicKey(pub); err == nil {
+			pubPEM = pem.EncodeToMemory(&pem.Block{
+				Type:  `PUBLIC KEY`,
+				Bytes: der,
+			})
+		} else {
+			return nil, nil, err
+		}
+
+		if der, err := x509.MarshalPKCS8PrivateKey(priv); err == nil {
+			privPEM = pem.EncodeToMemory(&pem.Block{
+				Type:  `PRIVATE KEY`,
+				Bytes: der,
+			})
+		} else {
+			return nil, nil, err
+		}
+
+		return pubPEM, privPEM, nil
+	} else {
+		return nil, nil, err
+	}
+}
+
+// Parses a public key from either a filename or an inline value.  Keys may be PEM-encoded
+// (PKIX), or the raw key bytes encoded as base64 or hex.
+func ParsePublicKey(keyOrFile string) (ed25519.PublicKey, error) {
+	if data, err := readKeyData(keyOrFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+				if pub, ok := key.(ed25519.PublicKey); ok {
+					return pub, nil
+				} else {
+					return nil, fmt.Errorf("public key: expected %s key, got %T", SignatureAlgorithm, key)
+				}
+			} else {
+				return nil, fmt.Errorf("public key: %v", err)
+			}
+		} else if raw, err := decodeRawKey(string(data), ed25519.PublicKeySize); err == nil {
+			return ed25519.PublicKey(raw), nil
+		} else {
+			return nil, fmt.Errorf("public key: %v", err)
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Parses each of the given public keys (see ParsePublicKey) into a key set.
+func ParsePublicKeys(keysOrFiles ...string) (KeySet, error) {
+	var keys KeySet
+
+	for _, keyOrFile := range keysOrFiles {
+		if keyOrFile = strings.TrimSpace(keyOrFile); keyOrFile == `` {
+			continue
+		}
+
+		if key, err := ParsePublicKey(keyOrFile); err == nil {
+			keys = append(keys, key)
+		} else {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// Parses a private key from either a filename or an inline value.  Keys may be PEM-encoded
+// (PKCS #8), or the raw seed or private key bytes encoded as base64 or hex.
+func ParsePrivateKey(keyOrFile string) (ed25519.PrivateKey, error) {
+	if data, err := readKeyData(keyOrFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+				if priv, ok := key.(ed25519.PrivateKey); ok {
+					return priv, nil
+				} else {
+					return nil, fmt.Errorf("private key: expected %s key, got %T", SignatureAlgorithm, key)
+				}
+			} else {
+				return nil, fmt.Errorf("private key: %v", err)
+			}
+		} else if raw, err := decodeRawKey(string(data), ed25519.SeedSize, ed25519.PrivateKeySize); err == nil {
+			if len(raw) == ed25519.SeedSize {
+				return ed25519.NewKeyFromSeed(raw), nil
+			}
+
+			return ed25519.PrivateKey(raw), nil
+		} else {
+			return nil, fmt.Errorf("private key: %v", err)
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func readKeyData(keyOrFile string) ([]byte, error) {
+	if fileutil.IsNonemptyFile(keyOrFile) {
+		if data, err := ioutil.ReadFile(keyOrFile); err == nil {
+			return data, nil
+		} else {
+			return nil, fmt.Errorf("key: %v", err)
+		}
+	}
+
+	return []byte(keyOrFile), nil
+}
+
+func decodeRawKey(in string, sizes ...int) ([]byte, error) {
+	in = strings.TrimSpace(in)
+
+	for _, decode := range []func(string) ([]byte, error){
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+	} {
+		if raw, err := decode(in); err == nil {
+			for _, size := range sizes {
+				if len(raw) == size {
+					return raw, nil
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("not a file, PEM block, or encoded %s key", SignatureAlgorithm)
+}
+
+// Returns the bytes that a manifest signature is calculated over: the JSON encoding of the
+// manifest without its signature, with timestamps normalized to UTC.  Anything that changes
+// this encoding (including the order of the files) invalidates the signature.
+func (self *Manifest) canonical() ([]byte, error) {
+	manifest := *self
+	manifest.Signature = nil
+	manifest.GeneratedAt = manifest.GeneratedAt.UTC()
+
+	return json.Marshal(&manifest)
+}
+
+// Signs this manifest with the given private key, replacing any existing signature.
+func (self *Manifest) Sign(key ed25519.PrivateKey) error {
+	if data, err := self.canonical(); err == nil {
+		self.Signature = &ManifestSignature{
+			Algorithm: SignatureAlgorithm,
+			KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+			Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+		}
+
+		return nil
+	} else {
+		return fmt.Errorf("sign: %v", err)
+	}
+}
+
+// Checks that this manifest was signed by one of the given keys and has not been modified
+// since.  Since the signature only covers files by their checksums, every file must have one.
+func (self *Manifest) Verify(keys KeySet) error {
+	if self.Signature == nil || self.Signature.Value == `` {
+		return fmt.Errorf("verify: manifest is not signed")
+	} else if self.Signature.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("verify: unsupported signature algorithm %q", self.Signature.Algorithm)
+	}
+
+	key, ok := keys.Get(self.Signature.KeyID)
+
+	if !ok {
+		return fmt.Errorf("verify: manifest signed by untrusted key %q", self.Signature.KeyID)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(self.Signature.Value)
+
+	if err != nil {
+		return fmt.Errorf("verify: malformed signature: %v", err)
+	}
+
+	if data, err := self.canonical(); err == nil {
+		if !ed25519.Verify(key, data, sig) {
+			return fmt.Errorf("verify: signature mismatch, manifest has been modified")
+		}
+	} else {
+		return fmt.Errorf("verify: %v", err)
+	}
+
+	for _, file := range self.Files() {
+		if file.SHA256 == `` {
+			return fmt.Errorf("verify: %s: signed manifest entries must have a checksum", file.Name)
+		}
+	}
+
+	self.verified = true
+	return nil
+}
+
+// verifies this manifest against TrustedKeys, if any have been configured.  Manifests that have
+// already been verified are not checked again, as fetching archives adds their contents to it.
+func (self *Manifest) verifyTrusted() error {
+	if len(TrustedKeys) == 0 || self.verified {
+		return nil
+	}
+
+	return self.Verify(TrustedKeys)
+}
@@ -0,0 +1,173 @@
+package hydra
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestManifestSignVerify(t *testing.T) {
+	assert := require.New(t)
+
+	pubPEM, privPEM, err := GenerateKeyPair()
+	assert.NoError(err)
+
+	pub, err := ParsePublicKey(string(pubPEM))
+	assert.NoError(err)
+
+	priv, err := ParsePrivateKey(string(privPEM))
+	assert.NoError(err)
+
+	otherPEM, _, err := GenerateKeyPair()
+	assert.NoError(err)
+
+	other, err := ParsePublicKey(string(otherPEM))
+	assert.NoError(err)
+
+	manifest := (&testFileServer{
+		files: map[string][]byte{
+			`app.yaml`:       []byte(`root: {type: Window}`),
+			`assets/a.png`:   []byte(`not really a png`),
+			`lib/Thing.yaml`: []byte(`definition: {type: Item}`),
+		},
+	}).manifest()
+
+	manifest.GeneratedAt = time.Date(2020, 1, 2, 3, 4, 5, 6, time.FixedZone(`EST`, -5*3600))
+
+	assert.Error(manifest.Verify(KeySet{pub}))
+	assert.NoError(manifest.Sign(priv))
+	assert.Equal(KeyID(pub), manifest.Signature.KeyID)
+	assert.NoError(manifest.Verify(KeySet{other, pub}))
+	assert.Error(manifest.Verify(KeySet{other}))
+
+	// the signature survives being written out and read back in
+	data, err := yaml.Marshal(&Application{
+		Manifest: manifest,
+	})
+	assert.NoError(err)
+
+	var app Application
+	assert.NoError(yaml.Unmarshal(data, &app))
+	assert.NoError(app.Manifest.Verify(KeySet{pub}))
+
+	// ...but not tampering
+	app.Manifest.Assets[0].SHA256 = app.Manifest.Assets[1].SHA256
+	assert.Error(app.Manifest.Verify(KeySet{pub}))
+}
+
+func TestFetchTrustedKeys(t *testing.T) {
+	assert := require.New(t)
+
+	pubPEM, privPEM, err := GenerateKeyPair()
+	assert.NoError(err)
+
+	priv, err := ParsePrivateKey(string(privPEM))
+	assert.NoError(err)
+
+	TrustedKeys, err = ParsePublicKeys(string(pubPEM))
+	assert.NoError(err)
+	defer func() {
+		TrustedKeys = nil
+	}()
+
+	files := &testFileServer{
+		files: map[string][]byte{
+			`file.txt`: bytes.Repeat([]byte(`x`), 64),
+		},
+	}
+
+	server := httptest.NewServer(files)
+	defer server.Close()
+
+	destdir, err := ioutil.TempDir(``, `hydra-signing-`)
+	assert.NoError(err)
+	defer os.RemoveAll(destdir)
+
+	// unsigned manifests are rejected before anything is retrieved
+	assert.Error(files.manifest().Fetch(server.URL, destdir))
+	assert.False(fileutil.FileExists(filepath.Join(destdir, `file.txt`)))
+
+	manifest := files.manifest()
+	assert.NoError(manifest.Sign(priv))
+	assert.NoError(manifest.Fetch(server.URL, destdir))
+	assert.True(fileutil.FileExists(filepath.Join(destdir, `file.txt`)))
+
+	// an application without a manifest can't be trusted
+	assert.Error(new(Application).verifyManifest())
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	assert := require.New(t)
+
+	pubPEM, privPEM, err := GenerateKeyPair()
+	assert.NoError(err)
+
+	priv, err := ParsePrivateKey(string(privPEM))
+	assert.NoError(err)
+
+	TrustedKeys, err = ParsePublicKeys(string(pubPEM))
+	assert.NoError(err)
+	defer func() {
+		TrustedKeys = nil
+	}()
+
+	tmp, err := ioutil.TempDir(``, `hydra-signing-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcdir := filepath.Join(tmp, `src`)
+	outdir := filepath.Join(tmp, `out`)
+	manifestFile := filepath.Join(tmp, ManifestFilename)
+
+	_, err = fileutil.WriteFile([]byte("definition:\n  type: Item\n  id: signed\n"), filepath.Join(srcdir, EntrypointFilename))
+	assert.NoError(err)
+
+	manifest, err := CreateManifest(srcdir)
+	assert.NoError(err)
+	assert.NoError(manifest.Sign(priv))
+	assert.NoError(manifest.WriteFile(manifestFile))
+
+	// the application comes from the signed entrypoint
+	app, err := Load(manifestFile)
+	assert.NoError(err)
+	app.SourceLocation = srcdir
+	assert.NoError(app.Generate(GenerateOptions{
+		DestDir: outdir,
+	}))
+
+	qml, err := ioutil.ReadFile(filepath.Join(outdir, `app.qml`))
+	assert.NoError(err)
+	assert.Contains(string(qml), `id: signed`)
+
+	// ...and nothing alongside the signed manifest is trusted
+	signed, err := ioutil.ReadFile(manifestFile)
+	assert.NoError(err)
+
+	assert.NoError(ioutil.WriteFile(manifestFile, append(signed, []byte("definition:\n  type: Rectangle\n")...), 0644))
+
+	_, err = Load(manifestFile)
+	assert.Error(err)
+	assert.Contains(err.Error(), `"definition" is not covered by the manifest signature`)
+
+	// a signed manifest must list the entrypoint
+	assert.NoError(os.Remove(filepath.Join(srcdir, EntrypointFilename)))
+	_, err = fileutil.WriteFile([]byte(`hello`), filepath.Join(srcdir, `file.txt`))
+	assert.NoError(err)
+
+	manifest, err = CreateManifest(srcdir)
+	assert.NoError(err)
+	assert.NoError(manifest.Sign(priv))
+	assert.NoError(manifest.WriteFile(manifestFile))
+
+	_, err = Load(manifestFile)
+	assert.Error(err)
+	assert.Contains(err.Error(), `signed manifest does not contain app.yaml`)
+}
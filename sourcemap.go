@@ -0,0 +1,257 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/typeutil"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const SourceMapSuffix = `.map`
+
+// Source positions are embedded in generated QML as markers while it is being assembled, which
+// survive the re-indenting of nested components.  Like Literal, these use Unicode brackets (⦅⦆)
+// that are not likely to appear in valid QML.  Once a file's final contents are known, the
+// markers are removed and their line numbers recorded in a SourceMap.
+var sourceMarkerPattern = regexp.MustCompile("\u2985([^\u2986]*)\u2986")
+var sourcePositionPattern = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?$`)
+var qmlLocationPattern = regexp.MustCompile(`((?:file://|qrc:)?/*[^\s:'"]+\.qml):(\d+)(?::(\d+))?`)
+
+// Identifies a location in a YAML source file.
+type SourcePosition struct {
+	Filename string `json:"source"`
+	Line     int    `json:"source_line"`
+	Column   int    `json:"source_column,omitempty"`
+}
+
+func positionOf(filename string, node *yamlv3.Node) *SourcePosition {
+	if node != nil && node.Line > 0 {
+		return &SourcePosition{
+			Filename: filename,
+			Line:     node.Line,
+			Column:   node.Column,
+		}
+	}
+
+	return nil
+}
+
+func (self SourcePosition) String() string {
+	if self.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", self.Filename, self.Line, self.Column)
+	} else {
+		return fmt.Sprintf("%s:%d", self.Filename, self.Line)
+	}
+}
+
+func (self *SourcePosition) marker() string {
+	if self == nil {
+		return ``
+	}
+
+	return "\u2985" + self.String() + "\u2986"
+}
+
+// inserts a source marker at the end of the first line of the given data.
+func withSourceMarker(data []byte, pos *SourcePosition) []byte {
+	if pos == nil {
+		return data
+	}
+
+	text := string(data)
+
+	if i := strings.Index(text, "\n"); i >= 0 {
+		return []byte(text[:i] + pos.marker() + text[i:])
+	} else {
+		return []byte(text + pos.marker())
+	}
+}
+
+// Maps a single line in a generated QML file to the YAML it was generated from.
+type SourceMapping struct {
+	SourcePosition
+	Line int `json:"line"`
+}
+
+// Maps the lines of a generated QML file back to the YAML files they were generated from.
+// Lines without an explicit mapping belong to the nearest mapped line above them.
+type SourceMap struct {
+	File     string          `json:"file"`
+	Mappings []SourceMapping `json:"mappings"`
+}
+
+// Removes all source markers from the given QML, returning the cleaned data and a source map
+// describing where the markers were.
+func stripSourceMarkers(data []byte) ([]byte, *SourceMap) {
+	smap := new(SourceMap)
+
+	if !sourceMarkerPattern.Match(data) {
+		return data, smap
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	for i, line := range lines {
+		if match := sourceMarkerPattern.FindStringSubmatch(line); match != nil {
+			if pos, ok := parseSourcePosition(match[1]); ok {
+				smap.Mappings = append(smap.Mappings, SourceMapping{
+					SourcePosition: pos,
+					Line:           i + 1,
+				})
+			}
+
+			lines[i] = sourceMarkerPattern.ReplaceAllString(line, ``)
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), smap
+}
+
+func parseSourcePosition(in string) (SourcePosition, bool) {
+	if match := sourcePositionPattern.FindStringSubmatch(in); match != nil {
+		return SourcePosition{
+			Filename: match[1],
+			Line:     int(typeutil.Int(match[2])),
+			Column:   int(typeutil.Int(match[3])),
+		}, true
+	}
+
+	return SourcePosition{}, false
+}
+
+// Loads the source map that was written alongside the given QML file.
+func LoadSourceMap(qmlfile string) (*SourceMap, error) {
+	if file, err := os.Open(qmlfile + SourceMapSuffix); err == nil {
+		defer file.Close()
+
+		smap := new(SourceMap)
+
+		if err := json.NewDecoder(file).Decode(smap); err == nil {
+			return smap, nil
+		} else {
+			return nil, fmt.Errorf("sourcemap %s: %v", qmlfile, err)
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Returns the YAML position the given (1-based) line of generated QML came from.
+func (self *SourceMap) Lookup(line int) (SourcePosition, bool) {
+	i := sort.Search(len(self.Mappings), func(i int) bool {
+		return self.Mappings[i].Line > line
+	})
+
+	if i > 0 {
+		return self.Mappings[i-1].SourcePosition, true
+	}
+
+	return SourcePosition{}, false
+}
+
+// Writes the source map alongside the given QML file, or removes any existing one if the map
+// is empty.
+func (self *SourceMap) write(qmlfile string) error {
+	mapfile := qmlfile + SourceMapSuffix
+
+	if len(self.Mappings) == 0 {
+		os.Remove(mapfile)
+		return nil
+	}
+
+	if data, err := json.MarshalIndent(self, ``, Indent); err == nil {
+		return writeFileIfChanged(data, mapfile)
+	} else {
+		return err
+	}
+}
+
+// Writes generated QML (containing source markers) to the given file, along with its source map.
+func writeMappedQml(qmlfile string, data []byte) error {
+	out, smap := stripSourceMarkers(data)
+	smap.File = filepath.Base(qmlfile)
+
+	if err := writeFileIfChanged(out, qmlfile); err != nil {
+		return err
+	}
+
+	return smap.write(qmlfile)
+}
+
+// Translates QML file locations appearing in compiler and runtime output into the YAML
+// locations they were generated from.
+type sourceMapTranslator struct {
+	roots []string
+	maps  map[string]*SourceMap
+}
+
+// Creates a translator for QML generated into the first root directory.  Additional roots are
+// other paths the same directory may be known by (e.g.: when mounted into a container).
+func newSourceMapTranslator(roots ...string) *sourceMapTranslator {
+	return &sourceMapTranslator{
+		roots: roots,
+		maps:  make(map[string]*SourceMap),
+	}
+}
+
+// Returns the YAML position for the given line in a QML file, which may be a path relative to
+// the root, an absolute path, a file:// URL, or a qrc: URL.
+func (self *sourceMapTranslator) Lookup(qmlfile string, line int) (SourcePosition, bool) {
+	if len(self.roots) == 0 {
+		return SourcePosition{}, false
+	}
+
+	rel := qmlfile
+
+	if strings.HasPrefix(rel, `qrc:`) {
+		rel = strings.TrimLeft(strings.TrimPrefix(rel, `qrc:`), `/`)
+	} else {
+		rel = strings.TrimPrefix(rel, `file://`)
+
+		if filepath.IsAbs(rel) {
+			for _, root := range self.roots {
+				if r, err := filepath.Rel(root, rel); err == nil && !strings.HasPrefix(r, `..`) {
+					rel = r
+					break
+				}
+			}
+		}
+	}
+
+	if filepath.IsAbs(rel) {
+		return SourcePosition{}, false
+	}
+
+	smap, ok := self.maps[rel]
+
+	if !ok {
+		smap, _ = LoadSourceMap(filepath.Join(self.roots[0], rel))
+		self.maps[rel] = smap
+	}
+
+	if smap != nil {
+		return smap.Lookup(line)
+	}
+
+	return SourcePosition{}, false
+}
+
+// Annotates the first QML location in the given line with the YAML location it came from.
+func (self *sourceMapTranslator) Translate(line string) string {
+	if match := qmlLocationPattern.FindStringSubmatchIndex(line); match != nil {
+		qmlfile := line[match[2]:match[3]]
+		lineno := int(typeutil.Int(line[match[4]:match[5]]))
+
+		if pos, ok := self.Lookup(qmlfile, lineno); ok {
+			return line[:match[1]] + ` [` + pos.String() + `]` + line[match[1]:]
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,71 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestSourceMap(t *testing.T) {
+	assert := require.New(t)
+	outdir, err := ioutil.TempDir(``, `hydra-sourcemap-`)
+	assert.NoError(err)
+	defer os.RemoveAll(outdir)
+
+	app := new(Application)
+
+	assert.NoError(FromFile(app, filepath.Join(`testdata`, `generate`, `signals`, `src`, EntrypointFilename)))
+	assert.NoError(app.Generate(GenerateOptions{
+		DestDir: outdir,
+	}))
+
+	qml, err := ioutil.ReadFile(filepath.Join(outdir, `app.qml`))
+	assert.NoError(err)
+	assert.False(sourceMarkerPattern.Match(qml))
+
+	smap, err := LoadSourceMap(filepath.Join(outdir, `app.qml`))
+	assert.NoError(err)
+	assert.Equal(`app.qml`, smap.File)
+	assert.NotEmpty(smap.Mappings)
+
+	lines := strings.Split(string(qml), "\n")
+
+	for i, line := range lines {
+		if strings.Contains(line, `onToggled:`) {
+			pos, ok := smap.Lookup(i + 1)
+			assert.True(ok)
+			assert.Equal(SourcePosition{`app.yaml`, 15, 9}, pos)
+		}
+	}
+
+	_, ok := smap.Lookup(0)
+	assert.False(ok)
+
+	translator := newSourceMapTranslator(outdir)
+
+	assert.Equal(
+		`qrc:/app.qml:6:1 [app.yaml:8:3]: Window is not a type`,
+		translator.Translate(`qrc:/app.qml:6:1: Window is not a type`),
+	)
+
+	assert.Equal(`nothing to see here`, translator.Translate(`nothing to see here`))
+}
+
+func TestParseSourcePosition(t *testing.T) {
+	assert := require.New(t)
+
+	pos, ok := parseSourcePosition(`lib/Toggle.yaml:4:3`)
+	assert.True(ok)
+	assert.Equal(SourcePosition{`lib/Toggle.yaml`, 4, 3}, pos)
+
+	pos, ok = parseSourcePosition(`app.yaml:12`)
+	assert.True(ok)
+	assert.Equal(SourcePosition{`app.yaml`, 12, 0}, pos)
+
+	_, ok = parseSourcePosition(`lib/Toggle.yaml`)
+	assert.False(ok)
+}
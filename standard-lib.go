@@ -28,6 +28,14 @@ func (self *Application) getBuiltinModules() []*Module {
 						Type:  `string`,
 						Name:  `version`,
 						Value: Version,
+					}, {
+						Type:  `bool`,
+						Name:  `offline`,
+						Value: self.Offline(),
+					}, {
+						Type:  `string`,
+						Name:  `offlineSince`,
+						Value: self.offlineSince(),
 					},
 				},
 				Components: []*Component{
@@ -0,0 +1,291 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// The name of the file supervisor state is persisted to.
+const SupervisorStateFilename = `supervisor.json`
+
+// The path the built-in server reports supervisor state at.
+var StatusPath = `/_hydra/status`
+
+var DefaultRestartDelay = time.Second
+var DefaultMaxRestartDelay = time.Minute
+var DefaultCrashWindow = 5 * time.Minute
+var DefaultMaxCrashes = 5
+var DefaultHealthyAfter = time.Minute
+
+// The state of a supervised application, as persisted to disk and reported by the built-in server.
+// Slots are the build directories that a "current" symlink (see Updater) can point at; when the
+// application is not run from such a symlink, only the manifest hash is tracked.
+type SupervisorState struct {
+	ActiveSlot    string      `json:"active_slot,omitempty"`
+	GoodSlot      string      `json:"good_slot,omitempty"`     // the last build that ran for HealthyAfter
+	GoodManifest  string      `json:"good_manifest,omitempty"` // the ContentHash of that build's manifest
+	StartedAt     time.Time   `json:"started_at,omitempty"`
+	Restarts      int         `json:"restarts"`
+	Crashes       int         `json:"crashes"`
+	RecentCrashes []time.Time `json:"recent_crashes,omitempty"` // crashes of the active slot within the crash window
+	Rollbacks     int         `json:"rollbacks"`
+	LastExit      string      `json:"last_exit,omitempty"`
+	LastExitAt    time.Time   `json:"last_exit_at,omitempty"`
+}
+
+// Loads previously persisted supervisor state.  A missing file yields empty state.
+func LoadSupervisorState(filename string) (*SupervisorState, error) {
+	var state = new(SupervisorState)
+
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (self *SupervisorState) save(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	if data, err := json.MarshalIndent(self, ``, `  `); err == nil {
+		tmp := filename + `.tmp`
+
+		if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+
+		return os.Rename(tmp, filename)
+	} else {
+		return err
+	}
+}
+
+// returns where the state of an application run from the given directory is kept: beside the
+// "current" symlink when there is one, otherwise in the StateDirectory (so that it never becomes
+// part of the build).  Without a StateDirectory, the state of the latter isn't kept at all.
+func supervisorStateFile(fromDir string) string {
+	if info, err := os.Lstat(fromDir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return filepath.Join(filepath.Dir(fromDir), SupervisorStateFilename)
+	} else if StateDirectory == `` {
+		return ``
+	}
+
+	if dir, err := fileutil.ExpandUser(StateDirectory); err == nil {
+		if abs, err := filepath.Abs(fromDir); err == nil {
+			var id = sha256.Sum256([]byte(abs))
+			return filepath.Join(dir, `supervisor`, hex.EncodeToString(id[:8])+`.json`)
+		}
+	}
+
+	return ``
+}
+
+// restarts an application as it exits, reverting to the last known-good build if it crash-loops.
+type supervisor struct {
+	fromDir   string
+	statefile string
+	options   RunOptions
+	state     *SupervisorState
+	delay     time.Duration
+	started   bool
+	lock      sync.Mutex
+}
+
+func newSupervisor(fromDir string, options RunOptions) *supervisor {
+	if options.RestartDelay <= 0 {
+		options.RestartDelay = DefaultRestartDelay
+	}
+
+	if options.MaxRestartDelay <= 0 {
+		options.MaxRestartDelay = DefaultMaxRestartDelay
+	}
+
+	if options.CrashWindow <= 0 {
+		options.CrashWindow = DefaultCrashWindow
+	}
+
+	if options.MaxCrashes <= 0 {
+		options.MaxCrashes = DefaultMaxCrashes
+	}
+
+	if options.HealthyAfter <= 0 {
+		options.HealthyAfter = DefaultHealthyAfter
+	}
+
+	sup := &supervisor{
+		fromDir:   fromDir,
+		statefile: supervisorStateFile(fromDir),
+		options:   options,
+		delay:     options.RestartDelay,
+	}
+
+	if sup.statefile == `` {
+		sup.state = new(SupervisorState)
+	} else if state, err := LoadSupervisorState(sup.statefile); err == nil {
+		sup.state = state
+	} else {
+		log.Warningf("supervise: ignoring previous state: %v", err)
+		sup.state = new(SupervisorState)
+	}
+
+	return sup
+}
+
+// returns the build directory the application is run from, if it is run through a symlink.
+func (self *supervisor) slot() string {
+	if target, err := os.Readlink(self.fromDir); err == nil {
+		return filepath.Base(target)
+	}
+
+	return ``
+}
+
+// records that the application is being (re)started.  Crashes are counted per slot, so a newly
+// deployed build starts with a clean slate.
+func (self *supervisor) starting() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if slot := self.slot(); slot != self.state.ActiveSlot {
+		self.state.ActiveSlot = slot
+		self.state.RecentCrashes = nil
+		self.delay = self.options.RestartDelay
+	}
+
+	if self.started {
+		self.state.Restarts += 1
+	}
+
+	self.started = true
+	self.state.StartedAt = time.Now()
+	self.persist()
+}
+
+// records that the application has been running long enough to be considered known-good.
+func (self *supervisor) healthy() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.delay = self.options.RestartDelay
+	self.state.GoodSlot = self.state.ActiveSlot
+
+	if manifest := loadGeneratedManifest(self.fromDir); manifest != nil {
+		self.state.GoodManifest = manifest.ContentHash()
+	}
+
+	log.Debugf("supervise: %s has been running for %v, marking it known-good", self.fromDir, self.options.HealthyAfter)
+	self.persist()
+}
+
+// records that the application exited, returning how long to wait before restarting it.  If the
+// active build has crashed MaxCrashes times within the crash window and a different build is
+// known to be good, the current symlink is pointed back at that one.
+func (self *supervisor) exited(err error) time.Duration {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var now = time.Now()
+	var recent []time.Time
+
+	self.state.Crashes += 1
+	self.state.LastExitAt = now
+
+	if err != nil {
+		self.state.LastExit = err.Error()
+	} else {
+		self.state.LastExit = `exited`
+	}
+
+	for _, crash := range append(self.state.RecentCrashes, now) {
+		if now.Sub(crash) < self.options.CrashWindow {
+			recent = append(recent, crash)
+		}
+	}
+
+	self.state.RecentCrashes = recent
+
+	delay := self.delay
+
+	if self.delay *= 2; self.delay > self.options.MaxRestartDelay {
+		self.delay = self.options.MaxRestartDelay
+	}
+
+	if len(recent) >= self.options.MaxCrashes {
+		good := self.state.GoodSlot
+
+		if good == `` || good == self.state.ActiveSlot || !fileutil.DirExists(filepath.Join(filepath.Dir(self.fromDir), good)) {
+			log.Errorf("supervise: crashed %d times in %v, but there is no other known-good build to revert to", len(recent), self.options.CrashWindow)
+		} else if err := swapSymlink(self.fromDir, good); err == nil {
+			log.Errorf("supervise: %s crashed %d times in %v, reverted to %s", self.state.ActiveSlot, len(recent), self.options.CrashWindow, good)
+
+			self.state.Rollbacks += 1
+			self.state.ActiveSlot = good
+			self.state.RecentCrashes = nil
+			self.delay = self.options.RestartDelay
+			delay = 0
+		} else {
+			log.Errorf("supervise: cannot revert to %s: %v", good, err)
+		}
+	}
+
+	self.persist()
+	return delay
+}
+
+func (self *supervisor) persist() {
+	if self.statefile == `` {
+		return
+	} else if err := self.state.save(self.statefile); err != nil {
+		log.Warningf("supervise: cannot save state: %v", err)
+	}
+}
+
+// Returns a copy of the current supervisor state.
+func (self *supervisor) Status() SupervisorState {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	status := *self.state
+	status.RecentCrashes = append([]time.Time(nil), status.RecentCrashes...)
+	return status
+}
+
+// Reports the supervisor state as JSON.
+func (self *supervisor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	json.NewEncoder(w).Encode(self.Status())
+}
+
+// atomically repoints the symlink at link to the given target.
+func swapSymlink(link string, target string) error {
+	tmp := link + `.tmp`
+
+	os.Remove(tmp)
+
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
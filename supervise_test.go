@@ -0,0 +1,197 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-supervise-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	// two builds, each with a generated manifest of its own
+	for _, slot := range []string{`build-good`, `build-bad`} {
+		manifest := NewManifest(filepath.Join(tmp, slot))
+		manifest.Assets = ManifestFiles{{Name: `app.yaml`, SHA256: slot}}
+		assert.NoError(os.MkdirAll(filepath.Join(tmp, slot), 0755))
+		assert.NoError(manifest.WriteFile(filepath.Join(tmp, slot, ManifestFilename)))
+	}
+
+	current := filepath.Join(tmp, CurrentBuildLink)
+	assert.NoError(os.Symlink(`build-good`, current))
+
+	options := RunOptions{
+		RestartDelay:    10 * time.Millisecond,
+		MaxRestartDelay: 30 * time.Millisecond,
+		CrashWindow:     time.Minute,
+		MaxCrashes:      3,
+	}
+
+	sup := newSupervisor(current, options)
+	assert.Equal(filepath.Join(tmp, SupervisorStateFilename), sup.statefile)
+
+	sup.starting()
+	sup.healthy()
+
+	status := sup.Status()
+	assert.Equal(`build-good`, status.ActiveSlot)
+	assert.Equal(`build-good`, status.GoodSlot)
+	assert.NotEmpty(status.GoodManifest)
+
+	// a new build is deployed, and crashes repeatedly with growing delays between restarts
+	assert.NoError(swapSymlink(current, `build-bad`))
+	sup.starting()
+	assert.Empty(sup.Status().RecentCrashes)
+
+	assert.Equal(10*time.Millisecond, sup.exited(errors.New(`exit status 1`)))
+	sup.starting()
+	assert.Equal(20*time.Millisecond, sup.exited(errors.New(`exit status 1`)))
+	sup.starting()
+
+	// until it is reverted to the last known-good build
+	assert.Equal(time.Duration(0), sup.exited(errors.New(`exit status 1`)))
+
+	target, err := os.Readlink(current)
+	assert.NoError(err)
+	assert.Equal(`build-good`, target)
+
+	status = sup.Status()
+	assert.Equal(`build-good`, status.ActiveSlot)
+	assert.Equal(1, status.Rollbacks)
+	assert.Equal(3, status.Crashes)
+	assert.Equal(3, status.Restarts)
+	assert.Equal(`exit status 1`, status.LastExit)
+	assert.Empty(status.RecentCrashes)
+
+	// the state survives a restart of the supervisor itself
+	persisted, err := LoadSupervisorState(sup.statefile)
+	assert.NoError(err)
+	assert.Equal(status.GoodManifest, persisted.GoodManifest)
+	assert.Equal(1, persisted.Rollbacks)
+
+	assert.Equal(3, newSupervisor(current, options).Status().Crashes)
+
+	// crashing the known-good build has nowhere else to go
+	for i := 0; i < 3; i++ {
+		sup.starting()
+		sup.exited(nil)
+	}
+
+	target, err = os.Readlink(current)
+	assert.NoError(err)
+	assert.Equal(`build-good`, target)
+	assert.Equal(30*time.Millisecond, sup.exited(nil))
+
+	// and the state is reported as JSON
+	rec := httptest.NewRecorder()
+	sup.ServeHTTP(rec, httptest.NewRequest(`GET`, StatusPath, nil))
+
+	var reported SupervisorState
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&reported))
+	assert.Equal(`build-good`, reported.GoodSlot)
+	assert.Equal(7, reported.Crashes)
+}
+
+func TestSupervisorStateOutsideBuild(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-supervise-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	defer func(dir string) {
+		StateDirectory = dir
+	}(StateDirectory)
+
+	StateDirectory = filepath.Join(tmp, `state`)
+	builddir := filepath.Join(tmp, `build`)
+	assert.NoError(os.MkdirAll(builddir, 0755))
+
+	// applications run straight from a build directory keep their state elsewhere
+	sup := newSupervisor(builddir, RunOptions{})
+	assert.True(strings.HasPrefix(sup.statefile, StateDirectory+string(filepath.Separator)))
+
+	sup.starting()
+	sup.exited(errors.New(`exit status 1`))
+
+	assert.False(fileutil.Exists(filepath.Join(builddir, SupervisorStateFilename)))
+	assert.Equal(1, newSupervisor(builddir, RunOptions{}).Status().Crashes)
+
+	// ...or none at all
+	StateDirectory = ``
+	sup = newSupervisor(builddir, RunOptions{})
+	assert.Empty(sup.statefile)
+
+	sup.starting()
+	sup.exited(errors.New(`exit status 1`))
+
+	entries, err := ioutil.ReadDir(builddir)
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestSupervisorStopsDuringBackoff(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-supervise-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	defer func(dir string) {
+		StateDirectory = dir
+	}(StateDirectory)
+
+	StateDirectory = ``
+	builddir := filepath.Join(tmp, `build`)
+	runs := filepath.Join(tmp, `runs`)
+	qmlscene := filepath.Join(tmp, `qmlscene`)
+
+	assert.NoError(os.MkdirAll(builddir, 0755))
+	assert.NoError(ioutil.WriteFile(qmlscene, []byte("#!/bin/sh\necho run >> '"+runs+"'\nexit 1\n"), 0755))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- RunWithOptions(builddir, RunOptions{
+			QmlsceneBin:     qmlscene,
+			Supervise:       true,
+			RestartDelay:    time.Hour,
+			MaxRestartDelay: time.Hour,
+		})
+	}()
+
+	for i := 0; i < 100 && !fileutil.FileExists(runs); i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	assert.True(fileutil.FileExists(runs))
+	time.Sleep(100 * time.Millisecond)
+
+	// a signal while waiting to restart stops the application rather than starting it again
+	assert.NoError(syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-done:
+		assert.Error(err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(`still waiting to restart after being stopped`)
+	}
+
+	started, err := ioutil.ReadFile(runs)
+	assert.NoError(err)
+	assert.Equal("run\n", string(started))
+}
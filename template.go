@@ -0,0 +1,162 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ghetzel/diecast"
+	"github.com/ghetzel/go-stockutil/stringutil"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var rxTemplateBlock = regexp.MustCompile(`^(vars|data):`)
+
+// Renders the given application or module YAML as a template (using diecast's text engine and
+// standard functions) before it is parsed.  Templates can use:
+//
+//	.env          environment variables
+//	.hostname     the hostname of this device
+//	.id           HYDRA_ID
+//	.environment  HYDRA_ENV
+//	.vars         the document's own vars: block
+//	.data         the contents of the files (or URLs) named in its data: block, relative to
+//	              dir, in YAML or any format with a Decoder
+//
+// The vars: and data: blocks are read before the document is rendered, so they must be
+// top-level and can't themselves contain template actions.  Documents without any template
+// actions are returned as they are.
+func RenderTemplate(name string, data []byte, dir string) ([]byte, error) {
+	if !bytes.Contains(data, []byte(`{{`)) {
+		return data, nil
+	}
+
+	var blocks struct {
+		Vars map[string]interface{} `yaml:"vars"`
+		Data map[string]string      `yaml:"data"`
+	}
+
+	if err := yaml.Unmarshal(templateBlocks(data), &blocks); err != nil {
+		return nil, fmt.Errorf("%s: vars: %v", name, err)
+	}
+
+	var env = make(map[string]string)
+	var datafiles = make(map[string]interface{})
+
+	for _, pair := range os.Environ() {
+		k, v := stringutil.SplitPair(pair, `=`)
+		env[k] = v
+	}
+
+	for key, location := range blocks.Data {
+		if value, err := loadDataFile(resolveLocation(dir, location)); err == nil {
+			datafiles[key] = value
+		} else {
+			return nil, fmt.Errorf("%s: data %s: %v", name, key, err)
+		}
+	}
+
+	tmpl := diecast.NewTemplate(name, diecast.TextEngine)
+	tmpl.Funcs(diecast.GetStandardFunctions(nil))
+
+	if err := tmpl.ParseString(string(data)); err == nil {
+		out := bytes.NewBuffer(nil)
+
+		if err := tmpl.Render(out, map[string]interface{}{
+			`env`:         env,
+			`hostname`:    Hostname,
+			`id`:          ID,
+			`environment`: Environment,
+			`vars`:        blocks.Vars,
+			`data`:        datafiles,
+		}, ``); err == nil {
+			return out.Bytes(), nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// returns just the top-level vars: and data: blocks of the given document.
+func templateBlocks(data []byte) []byte {
+	var out bytes.Buffer
+	var inBlock bool
+	var scanner = bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if rxTemplateBlock.MatchString(line) {
+			inBlock = true
+		} else if line != `` && !strings.HasPrefix(line, ` `) && !strings.HasPrefix(line, `#`) {
+			inBlock = false
+		}
+
+		if inBlock {
+			out.WriteString(line + "\n")
+		}
+	}
+
+	return out.Bytes()
+}
+
+// resolves the given file or URL relative to the given directory or URL.
+func resolveLocation(dir string, location string) string {
+	if dir == `` || isRemote(location) || filepath.IsAbs(location) || strings.HasPrefix(location, `~`) {
+		return location
+	} else if isRemote(dir) {
+		if u, err := url.Parse(dir); err == nil {
+			return resolveURL(u, location).String()
+		}
+	}
+
+	return filepath.Join(dir, location)
+}
+
+// returns the directory or URL that files named in the document at the given location are
+// relative to.
+func locationDir(location string) string {
+	if isRemote(location) {
+		if u, err := url.Parse(location); err == nil {
+			return resolveURL(u, `..`).String()
+		}
+	}
+
+	return filepath.Dir(location)
+}
+
+// reads the given JSON or YAML file (or URL) into native maps and slices.
+func loadDataFile(location string) (interface{}, error) {
+	if _, rc, err := fetch(location); err == nil {
+		defer rc.Close()
+
+		if data, err := ioutil.ReadAll(rc); err == nil {
+			var value interface{}
+
+			if decoder := DecoderFor(location); decoder != nil {
+				if data, err = decoder.Decode(location, data); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := yamlv3.Unmarshal(data, &value); err == nil {
+				return value, nil
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
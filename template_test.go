@@ -0,0 +1,87 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-template-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	defer func(env string, id string) {
+		Environment, ID = env, id
+	}(Environment, ID)
+
+	Environment, ID = `prod`, `kiosk-1`
+	os.Setenv(`HYDRA_TEST_TITLE`, `Lobby`)
+	defer os.Unsetenv(`HYDRA_TEST_TITLE`)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(tmp, `tiles.json`), []byte(`[
+		{"name": "weather", "color": "blue"},
+		{"name": "news", "color": "red"}
+	]`), 0644))
+
+	appfile := filepath.Join(tmp, `app.yaml`)
+
+	assert.NoError(ioutil.WriteFile(appfile, []byte(`
+vars:
+  columns: 2
+data:
+  tiles: tiles.json
+imports:
+- QtQuick 2.0
+definition:
+  type: Grid
+  properties:
+    columns: {{ .vars.columns }}
+    objectName: '{{ .env.HYDRA_TEST_TITLE }} ({{ .id }})'
+{{- if eq .environment "prod" }}
+    visible: true
+{{- end }}
+  components:
+{{- range .data.tiles }}
+  - id: {{ .name }}
+    type: Rectangle
+    properties:
+      color: {{ .color }}
+{{- end }}
+`), 0644))
+
+	app := new(Application)
+	assert.NoError(FromFile(app, appfile))
+	assert.Equal(2, app.Vars[`columns`])
+	assert.Equal(2, app.Definition.Properties[`columns`])
+	assert.Equal(`Lobby (kiosk-1)`, app.Definition.Properties[`objectName`])
+	assert.Equal(true, app.Definition.Properties[`visible`])
+	assert.Len(app.Definition.Components, 2)
+	assert.Equal(`weather`, app.Definition.Components[0].ID)
+	assert.Equal(`red`, app.Definition.Components[1].Properties[`color`])
+	assert.Contains(string(app.Resolved()), `id: news`)
+	assert.NoError(ValidateFile(appfile))
+
+	// documents without templates are left alone
+	plain := []byte("imports:\n- QtQuick 2.0 # {not a template}\n")
+	out, err := RenderTemplate(`plain.yaml`, plain, tmp)
+	assert.NoError(err)
+	assert.Equal(plain, out)
+
+	// missing data files and broken templates are errors, not reasons to try elsewhere
+	_, err = RenderTemplate(`app.yaml`, []byte("data:\n  tiles: missing.json\nimports: {{ .vars }}\n"), tmp)
+	assert.Error(err)
+
+	_, err = RenderTemplate(`app.yaml`, []byte("imports: {{ .vars \n"), tmp)
+	assert.Error(err)
+
+	assert.NoError(ioutil.WriteFile(appfile, []byte("imports: {{ range }}\n"), 0644))
+	_, err = Load(appfile)
+	assert.Error(err)
+	assert.False(IsLoadErr(err))
+}
@@ -0,0 +1,18 @@
+import QtQuick 2.11
+import QtQuick.Window 2.11
+import "."
+
+Window {
+  id: root
+  visible: true
+  title: "Basic"
+  color: "#000000"
+  Component.onCompleted: function(){
+    Hydra.root = root; Hydra.init()
+  }
+  Text {
+    id: label
+    text: "Hello"
+    color: "white"
+  }
+}
\ No newline at end of file
@@ -0,0 +1,34 @@
+import QtQuick 2.11
+import QtQuick.Window 2.11
+import "."
+
+Window {
+  id: root
+  visible: true
+  Component.onCompleted: function(){
+    Hydra.root = root; Hydra.init()
+  }
+  ListView {
+    model: [
+      "one",
+      "two",
+      "three"
+    ]
+    delegate: Text {
+      width: 200
+      text: modelData
+      color: "red"
+    }
+    anchors.fill: parent
+  }
+  Item {
+    config: {
+      "label": "retry",
+      "retries": 3
+    }
+    style: {
+      "_inline": false,
+      "color": "blue"
+    }
+  }
+}
\ No newline at end of file
@@ -0,0 +1,42 @@
+import QtQuick 2.11
+import QtQuick.Layouts 1.11
+import QtQuick.Window 2.11
+import "."
+
+Window {
+  id: root
+  visible: true
+  Component.onCompleted: function(){
+    Hydra.root = root; Hydra.init()
+  }
+  RowLayout {
+    id: row
+    anchors.fill: parent
+    Rectangle {
+      color: "red"
+      Layout.fillHeight: true
+      Layout.fillWidth: true
+      Layout.preferredWidth: 1
+    }
+    Rectangle {
+      color: "green"
+      Layout.fillHeight: true
+      Layout.fillWidth: true
+      Layout.preferredWidth: 2
+    }
+  }
+  ColumnLayout {
+    anchors.fill: row
+    Rectangle {
+      Layout.fillHeight: true
+      Layout.fillWidth: true
+      Layout.preferredHeight: 3
+    }
+  }
+  Text {
+    anchors.centerIn: parent
+  }
+  Text {
+    anchors.horizontalCenter: row.horizontalCenter
+  }
+}
\ No newline at end of file
@@ -0,0 +1,16 @@
+import QtQuick 2.11
+import QtQuick.Window 2.11
+import "lib"
+import "."
+
+Window {
+  id: root
+  visible: true
+  Component.onCompleted: function(){
+    Hydra.root = root; Hydra.init()
+  }
+  Toggle {
+    id: power
+    onToggled: console.log(checked)
+  }
+}
\ No newline at end of file
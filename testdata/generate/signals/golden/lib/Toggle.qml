@@ -0,0 +1,19 @@
+import QtQuick 2.11
+import "qrc:/"
+import "."
+Rectangle {
+  id: toggle
+  signal toggled(bool checked)
+  property bool checked: false
+  readonly property string label: "Toggle"
+  opacity: checked ? 1.0 : 0.5
+  function flip() {
+    checked = !checked
+    toggled(checked)
+  }
+  Behavior on opacity {
+    NumberAnimation {
+      duration: 250
+    }
+  }
+}
\ No newline at end of file
@@ -0,0 +1,12 @@
+import QtQuick 2.11
+import QtQuick.Window 2.11
+import "."
+
+Window {
+  id: root
+  visible: true
+  color: Theme.background
+  Component.onCompleted: function(){
+    Hydra.root = root; Hydra.init()
+  }
+}
\ No newline at end of file
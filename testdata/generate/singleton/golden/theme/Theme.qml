@@ -0,0 +1,9 @@
+pragma Singleton
+import QtQuick 2.11
+import "qrc:/theme"
+import "qrc:/"
+import "."
+QtObject {
+  property color background: "#202020"
+  property color foreground: "#F0F0F0"
+}
\ No newline at end of file
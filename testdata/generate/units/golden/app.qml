@@ -0,0 +1,21 @@
+import QtQuick 2.11
+import QtQuick.Window 2.11
+import "."
+
+Window {
+  id: root
+  visible: true
+  Component.onCompleted: function(){
+    Hydra.root = root; Hydra.init()
+  }
+  Rectangle {
+    width: (Hydra.root.width * 0.500000)
+    height: (Hydra.root.height * 0.250000)
+    radius: ((Hydra.root.height < Hydra.root.width) ? (Hydra.root.height * 0.100000) : (Hydra.root.width * 0.100000))
+    border.width: ((Hydra.root.height > Hydra.root.width) ? (Hydra.root.height * 0.010000) : (Hydra.root.width * 0.010000))
+    Rectangle {
+      width: (parent.width * 0.500000)
+      height: (parent.height * 0.500000)
+    }
+  }
+}
\ No newline at end of file
@@ -0,0 +1,280 @@
+package hydra
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"gopkg.in/yaml.v2"
+)
+
+var DefaultHTTPTimeout = 10 * time.Second
+
+// Describes how requests are made to HTTP(S) servers when retrieving applications, manifests,
+// modules and their files (and when checking in).  Hosts holds overrides for specific hosts,
+// keyed by hostname, host:port, or a wildcard like "*.example.com"; each is layered over the
+// options around it, with headers and CA bundles adding to those already given.
+//
+// The top-level BearerToken and Username are only sent to the host applications are loaded
+// from (HYDRA_HOST); credentials for any other host must be given under Hosts.
+type HTTPOptions struct {
+	Timeout            time.Duration          `yaml:"timeout,omitempty"      json:"timeout,omitempty"`
+	BearerToken        string                 `yaml:"bearer_token,omitempty" json:"bearer_token,omitempty"`
+	Username           string                 `yaml:"username,omitempty"     json:"username,omitempty"`
+	Password           string                 `yaml:"password,omitempty"     json:"password,omitempty"`
+	Headers            map[string]string      `yaml:"headers,omitempty"      json:"headers,omitempty"`
+	CAFiles            []string               `yaml:"ca,omitempty"           json:"ca,omitempty"` // PEM bundles trusted in addition to the system roots
+	ClientCert         string                 `yaml:"cert,omitempty"         json:"cert,omitempty"`
+	ClientKey          string                 `yaml:"key,omitempty"          json:"key,omitempty"`
+	InsecureSkipVerify bool                   `yaml:"insecure,omitempty"     json:"insecure,omitempty"`
+	Hosts              map[string]HTTPOptions `yaml:"hosts,omitempty"        json:"hosts,omitempty"`
+}
+
+// Loads HTTP options from the given YAML file.
+func LoadHTTPOptions(filename string) (*HTTPOptions, error) {
+	var options HTTPOptions
+
+	if data, err := ioutil.ReadFile(fileutil.MustExpandUser(filename)); err == nil {
+		if err := yaml.UnmarshalStrict(data, &options); err == nil {
+			return &options, nil
+		} else {
+			return nil, fmt.Errorf("http options: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("http options: %v", err)
+	}
+}
+
+// Returns these options with any set in override taking their place.
+func (self HTTPOptions) Merge(override HTTPOptions) HTTPOptions {
+	var merged = self
+
+	if override.Timeout > 0 {
+		merged.Timeout = override.Timeout
+	}
+
+	if override.BearerToken != `` {
+		merged.BearerToken = override.BearerToken
+	}
+
+	if override.Username != `` {
+		merged.Username = override.Username
+		merged.Password = override.Password
+	}
+
+	if override.ClientCert != `` {
+		merged.ClientCert = override.ClientCert
+		merged.ClientKey = override.ClientKey
+	}
+
+	if override.InsecureSkipVerify {
+		merged.InsecureSkipVerify = true
+	}
+
+	if len(override.Headers) > 0 {
+		merged.Headers = make(map[string]string)
+
+		for _, headers := range []map[string]string{self.Headers, override.Headers} {
+			for name, value := range headers {
+				merged.Headers[name] = value
+			}
+		}
+	}
+
+	merged.CAFiles = append(append([]string(nil), self.CAFiles...), override.CAFiles...)
+
+	if len(override.Hosts) > 0 {
+		merged.Hosts = make(map[string]HTTPOptions)
+
+		for _, hosts := range []map[string]HTTPOptions{self.Hosts, override.Hosts} {
+			for host, options := range hosts {
+				merged.Hosts[host] = merged.Hosts[host].Merge(options)
+			}
+		}
+	}
+
+	return merged
+}
+
+// Makes Client use the given options for every request it makes.  Certificates and CA bundles
+// are loaded now, so any problem with them is reported here rather than on first use.
+func ConfigureHTTP(options HTTPOptions) error {
+	if transport, err := newHTTPTransport(options); err == nil {
+		Client.Timeout = DefaultHTTPTimeout
+
+		if options.Timeout > 0 {
+			Client.Timeout = options.Timeout
+		}
+
+		Client.Transport = transport
+		return nil
+	} else {
+		return err
+	}
+}
+
+// applies HTTPOptions to requests, picking the options for each by the host it is sent to.
+type httpTransport struct {
+	defaults *hostTransport
+	hosts    map[string]*hostTransport
+}
+
+type hostTransport struct {
+	options   HTTPOptions
+	transport *http.Transport
+}
+
+func newHTTPTransport(options HTTPOptions) (*httpTransport, error) {
+	var transport = &httpTransport{
+		hosts: make(map[string]*hostTransport),
+	}
+
+	if defaults, err := newHostTransport(options); err == nil {
+		transport.defaults = defaults
+	} else {
+		return nil, err
+	}
+
+	for host, override := range options.Hosts {
+		if ht, err := newHostTransport(options.Merge(override)); err == nil {
+			transport.hosts[strings.ToLower(host)] = ht
+		} else {
+			return nil, fmt.Errorf("%s: %v", host, err)
+		}
+	}
+
+	return transport, nil
+}
+
+func newHostTransport(options HTTPOptions) (*hostTransport, error) {
+	var transport = http.DefaultTransport.(*http.Transport).Clone()
+
+	if len(options.CAFiles) > 0 || options.ClientCert != `` || options.InsecureSkipVerify {
+		var config = &tls.Config{
+			InsecureSkipVerify: options.InsecureSkipVerify,
+		}
+
+		if len(options.CAFiles) > 0 {
+			if pool, err := x509.SystemCertPool(); err == nil {
+				config.RootCAs = pool
+			} else {
+				config.RootCAs = x509.NewCertPool()
+			}
+
+			for _, filename := range options.CAFiles {
+				if pem, err := ioutil.ReadFile(fileutil.MustExpandUser(filename)); err == nil {
+					if !config.RootCAs.AppendCertsFromPEM(pem) {
+						return nil, fmt.Errorf("ca %s: no certificates found", filename)
+					}
+				} else {
+					return nil, fmt.Errorf("ca: %v", err)
+				}
+			}
+		}
+
+		if options.ClientCert != `` {
+			if cert, err := tls.LoadX509KeyPair(
+				fileutil.MustExpandUser(options.ClientCert),
+				fileutil.MustExpandUser(options.ClientKey),
+			); err == nil {
+				config.Certificates = []tls.Certificate{cert}
+			} else {
+				return nil, fmt.Errorf("client certificate: %v", err)
+			}
+		}
+
+		transport.TLSClientConfig = config
+	}
+
+	return &hostTransport{
+		options:   options,
+		transport: transport,
+	}, nil
+}
+
+// returns the options for the given host:port, preferring an exact match, then the hostname
+// alone, then the longest matching wildcard.
+func (self *httpTransport) lookup(host string, hostname string) *hostTransport {
+	host, hostname = strings.ToLower(host), strings.ToLower(hostname)
+
+	for _, name := range []string{host, hostname} {
+		if ht, ok := self.hosts[name]; ok {
+			return ht
+		}
+	}
+
+	var best string
+
+	for name := range self.hosts {
+		if strings.HasPrefix(name, `*.`) && strings.HasSuffix(hostname, name[1:]) && len(name) > len(best) {
+			best = name
+		}
+	}
+
+	if best != `` {
+		return self.hosts[best]
+	}
+
+	return self.defaults
+}
+
+func (self *httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var ht = self.lookup(req.URL.Host, req.URL.Hostname())
+
+	// the default headers and credentials only follow redirects that stay on the same host;
+	// anywhere else has to be given options of its own
+	if ht == self.defaults && req.Response != nil && !strings.EqualFold(originalHost(req), req.URL.Host) {
+		return ht.transport.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+
+	for name, value := range ht.options.Headers {
+		if req.Header.Get(name) == `` {
+			req.Header.Set(name, value)
+		}
+	}
+
+	switch {
+	case req.Header.Get(`Authorization`) != ``, req.Context().Value(ownCredentialsKey{}) != nil:
+		// requests that carry their own credentials (e.g. signed ones) keep them, and those made
+		// without any on purpose stay that way
+	case ht == self.defaults && !isLoadHost(req.URL):
+		// the default credentials are only for the host applications are loaded from
+	case ht.options.BearerToken != ``:
+		req.Header.Set(`Authorization`, `Bearer `+ht.options.BearerToken)
+	case ht.options.Username != ``:
+		req.SetBasicAuth(ht.options.Username, ht.options.Password)
+	}
+
+	return ht.transport.RoundTrip(req)
+}
+
+type ownCredentialsKey struct{}
+
+// marks the given request as one that brings its own credentials (or deliberately has none), so
+// that none from HTTPOptions are added to it.
+func withOwnCredentials(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), ownCredentialsKey{}, true))
+}
+
+// returns whether the given URL is on the host applications are loaded from.
+func isLoadHost(u *url.URL) bool {
+	return strings.EqualFold(u.Host, Domain) || strings.EqualFold(u.Hostname(), Domain)
+}
+
+// returns the host the request was first made to, before any redirects.
+func originalHost(req *http.Request) string {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+
+	return req.URL.Host
+}
@@ -0,0 +1,235 @@
+package hydra
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/testify/require"
+)
+
+// writes a self-signed client certificate and its key to the given directory.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	assert := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: `kiosk-1`},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+
+	certfile := filepath.Join(dir, `client.pem`)
+	keyfile := filepath.Join(dir, `client.key`)
+
+	assert.NoError(ioutil.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: der}), 0644))
+	assert.NoError(ioutil.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: `EC PRIVATE KEY`, Bytes: keyDER}), 0600))
+
+	return cert, certfile, keyfile
+}
+
+func TestHTTPOptionsMerge(t *testing.T) {
+	assert := require.New(t)
+
+	merged := HTTPOptions{
+		Timeout:     time.Second,
+		BearerToken: `default`,
+		Headers:     map[string]string{`X-Fleet`: `lobby`, `X-Env`: `prod`},
+		CAFiles:     []string{`system.pem`},
+		Hosts: map[string]HTTPOptions{
+			`config.example.com`: {BearerToken: `file`},
+		},
+	}.Merge(HTTPOptions{
+		BearerToken: `flag`,
+		Headers:     map[string]string{`X-Env`: `dev`},
+		CAFiles:     []string{`private.pem`},
+		Hosts: map[string]HTTPOptions{
+			`config.example.com`: {Username: `kiosk`},
+		},
+	})
+
+	assert.Equal(time.Second, merged.Timeout)
+	assert.Equal(`flag`, merged.BearerToken)
+	assert.Equal(map[string]string{`X-Fleet`: `lobby`, `X-Env`: `dev`}, merged.Headers)
+	assert.Equal([]string{`system.pem`, `private.pem`}, merged.CAFiles)
+	assert.Equal(`file`, merged.Hosts[`config.example.com`].BearerToken)
+	assert.Equal(`kiosk`, merged.Hosts[`config.example.com`].Username)
+
+	transport, err := newHTTPTransport(HTTPOptions{
+		Hosts: map[string]HTTPOptions{
+			`example.com`:        {BearerToken: `exact`},
+			`example.com:8443`:   {BearerToken: `port`},
+			`*.example.com`:      {BearerToken: `wildcard`},
+			`*.cdn.example.com`:  {BearerToken: `narrower`},
+			`*.other.example.io`: {BearerToken: `unrelated`},
+		},
+	})
+
+	assert.NoError(err)
+	assert.Equal(`exact`, transport.lookup(`example.com`, `example.com`).options.BearerToken)
+	assert.Equal(`port`, transport.lookup(`example.com:8443`, `example.com`).options.BearerToken)
+	assert.Equal(`wildcard`, transport.lookup(`config.example.com`, `config.example.com`).options.BearerToken)
+	assert.Equal(`narrower`, transport.lookup(`a.cdn.example.com`, `a.cdn.example.com`).options.BearerToken)
+	assert.Empty(transport.lookup(`example.org`, `example.org`).options.BearerToken)
+}
+
+func TestConfigureHTTP(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(client http.Client) {
+		*Client = client
+	}(*Client)
+
+	tmp, err := ioutil.TempDir(``, `hydra-http-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	clientCert, certfile, keyfile := writeClientCert(t, tmp)
+
+	// a config server with a private CA that wants a client certificate, a token and a header
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(`Authorization`) != `Bearer s3cr3t` || req.Header.Get(`X-Fleet`) != `lobby` {
+			http.Error(w, `unauthorized`, http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("imports:\n- QtQuick 2.0\n"))
+	}))
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+
+	server.StartTLS()
+	defer server.Close()
+
+	cafile := filepath.Join(tmp, `ca.pem`)
+	assert.NoError(ioutil.WriteFile(cafile, pem.EncodeToMemory(&pem.Block{
+		Type:  `CERTIFICATE`,
+		Bytes: server.Certificate().Raw,
+	}), 0644))
+
+	// without the CA, the server isn't trusted
+	assert.NoError(ConfigureHTTP(HTTPOptions{}))
+	assert.Error(FromURL(new(Application), server.URL+`/app.yaml`))
+
+	// credentials for the config server don't go anywhere else
+	assert.NoError(ConfigureHTTP(HTTPOptions{
+		Timeout: 5 * time.Second,
+		Headers: map[string]string{`X-Fleet`: `lobby`},
+		Hosts: map[string]HTTPOptions{
+			`127.0.0.1`: {
+				BearerToken: `s3cr3t`,
+				CAFiles:     []string{cafile},
+				ClientCert:  certfile,
+				ClientKey:   keyfile,
+			},
+		},
+	}))
+
+	assert.Equal(5*time.Second, Client.Timeout)
+
+	app := new(Application)
+	assert.NoError(FromURL(app, server.URL+`/app.yaml`))
+	assert.Equal([]string{`QtQuick 2.0`}, app.Imports)
+
+	_, data := fetchAll(t, &FetchRequest{URL: mustParseURL(t, server.URL+`/app.yaml`)})
+	assert.Equal("imports:\n- QtQuick 2.0\n", data)
+
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get(`Authorization`) + `|` + req.Header.Get(`X-Fleet`)))
+	}))
+
+	defer echo.Close()
+
+	_, data = fetchAll(t, &FetchRequest{URL: mustParseURL(t, strings.Replace(echo.URL, `127.0.0.1`, `localhost`, 1))})
+	assert.Equal(`|lobby`, data)
+
+	// the default credentials only go to the host applications are loaded from...
+	assert.NoError(ConfigureHTTP(HTTPOptions{
+		BearerToken: `s3cr3t`,
+		Headers:     map[string]string{`X-Fleet`: `lobby`},
+	}))
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case `/away`:
+			http.Redirect(w, req, strings.Replace(echo.URL, `127.0.0.1`, `localhost`, 1), http.StatusFound)
+		case `/here`:
+			http.Redirect(w, req, `/echo`, http.StatusFound)
+		default:
+			w.Write([]byte(req.Header.Get(`Authorization`) + `|` + req.Header.Get(`X-Fleet`)))
+		}
+	}))
+
+	defer origin.Close()
+
+	defer func(domain string) {
+		Domain = domain
+	}(Domain)
+
+	Domain = mustParseURL(t, origin.URL).Host
+
+	_, data = fetchAll(t, &FetchRequest{URL: mustParseURL(t, origin.URL+`/echo`)})
+	assert.Equal(`Bearer s3cr3t|lobby`, data)
+
+	_, data = fetchAll(t, &FetchRequest{URL: mustParseURL(t, strings.Replace(echo.URL, `127.0.0.1`, `localhost`, 1))})
+	assert.Equal(`|lobby`, data)
+
+	// ...never to requests that are anonymous on purpose...
+	req, err := http.NewRequest(http.MethodGet, origin.URL+`/echo`, nil)
+	assert.NoError(err)
+
+	res, err := Client.Do(withOwnCredentials(req))
+	assert.NoError(err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(err)
+	assert.Equal(`|lobby`, string(body))
+
+	// ...and they don't follow a redirect to another host
+	_, data = fetchAll(t, &FetchRequest{URL: mustParseURL(t, origin.URL+`/away`)})
+	assert.Equal(`|`, data)
+
+	_, data = fetchAll(t, &FetchRequest{URL: mustParseURL(t, origin.URL+`/here`)})
+	assert.Equal(`Bearer s3cr3t|lobby`, data)
+
+	// bad certificate files are reported up front
+	assert.Error(ConfigureHTTP(HTTPOptions{CAFiles: []string{keyfile}}))
+	assert.Error(ConfigureHTTP(HTTPOptions{ClientCert: certfile}))
+}
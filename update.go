@@ -0,0 +1,313 @@
+package hydra
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+// The name of the symlink (inside the output directory) pointing at the build being run.
+const CurrentBuildLink = `current`
+
+var DefaultUpdateHealthWindow = 30 * time.Second
+
+const buildDirPrefix = `build-`
+
+type UpdateOptions struct {
+	GenerateOptions               // DestDir holds each build, plus the symlink to the current one
+	SourceLocation  string        // if set, overrides where the application's files are retrieved from
+	Interval        time.Duration // how often to check the application for changes
+	HealthWindow    time.Duration // a new build that exits sooner than this after deploying is rolled back
+	CheckinURL      string        // if set, the device checks in here before each check for changes (see Checkin)
+	Run             bool
+	RunOptions      RunOptions
+}
+
+// Keeps a generated application up to date with the location it was loaded from.  Each new
+// version is generated into a directory of its own alongside the current one, then deployed by
+// repointing the "current" symlink at it and restarting the application (if running).  Should
+// the new version exit within the health window, the previous build is put back in its place.
+type Updater struct {
+	location  string
+	options   UpdateOptions
+	etag      string
+	previous  string
+	swappedAt time.Time
+	reload    chan bool
+	lock      sync.Mutex
+}
+
+// Generates the application found at location (see Load), then periodically checks it for
+// changes, deploying each new version as it appears.  This function blocks until the
+// application exits (if running) or an error occurs.
+func Update(location string, options UpdateOptions) error {
+	if options.Interval <= 0 {
+		return fmt.Errorf("update: an update interval is required")
+	}
+
+	if options.HealthWindow <= 0 {
+		options.HealthWindow = DefaultUpdateHealthWindow
+	}
+
+	updater := &Updater{
+		location: location,
+		options:  options,
+		reload:   make(chan bool, 1),
+	}
+
+	// the check-in server may decide which application is run in the first place
+	if options.CheckinURL != `` {
+		if err := updater.checkin(); err != nil {
+			log.Warningf("update: %v", err)
+		}
+	}
+
+	if app, err := Load(updater.location); err == nil {
+		updater.location = app.Location()
+
+		if err := updater.deploy(app); err != nil {
+			return err
+		}
+
+		return updater.loop()
+	} else {
+		return err
+	}
+}
+
+func (self *Updater) loop() error {
+	var runerr = make(chan error, 1)
+	var ticker = time.NewTicker(self.options.Interval)
+
+	defer ticker.Stop()
+
+	if self.options.Run {
+		runopts := self.options.RunOptions
+		runopts.Reload = self.reload
+		runopts.OnExit = self.exited
+
+		go func() {
+			runerr <- RunWithOptions(self.currentDir(), runopts)
+		}()
+	}
+
+	log.Infof("checking %s for updates every %v", self.location, self.options.Interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			if self.options.CheckinURL != `` {
+				if err := self.checkin(); err != nil {
+					log.Warningf("update: %v", err)
+				}
+			}
+
+			if err := self.check(); err != nil {
+				log.Warningf("update: %v", err)
+			}
+
+		case err := <-runerr:
+			return err
+		}
+	}
+}
+
+// reloads the application, deploying it if it has changed since the last check.
+func (self *Updater) check() error {
+	if app, err := LoadIfChanged(self.location, self.etag); err == nil {
+		if err := self.deploy(app); err != nil {
+			return err
+		}
+
+		requestReload(self.reload)
+		return nil
+	} else if err == ErrNotModified {
+		log.Debugf("update: %s has not changed", self.location)
+		return nil
+	} else {
+		return err
+	}
+}
+
+// reports the state of this device to the check-in server, then follows its instructions: a
+// new location is checked for (and deployed) on the next check, as is the current one after a
+// reload command or a change to its configuration.
+func (self *Updater) checkin() error {
+	request := NewCheckinRequest()
+	request.Location = self.location
+
+	if manifest := loadGeneratedManifest(self.currentDir()); manifest != nil {
+		request.Manifest = manifest.ContentHash()
+	}
+
+	if state, err := LoadSupervisorState(filepath.Join(self.options.DestDir, SupervisorStateFilename)); err == nil && !state.StartedAt.IsZero() {
+		request.Health = state
+	}
+
+	response, err := Checkin(self.options.CheckinURL, request)
+
+	if err != nil {
+		return err
+	}
+
+	var configChanged bool
+
+	for key, value := range response.Config {
+		if !strings.HasPrefix(key, CheckinConfigPrefix) {
+			log.Warningf("checkin: ignoring config %s, only %s* variables can be set", key, CheckinConfigPrefix)
+		} else if current, ok := os.LookupEnv(key); !ok || current != value {
+			os.Setenv(key, value)
+			configChanged = true
+		}
+	}
+
+	// the application may be generated from its configuration, and only sees it once restarted,
+	// so a change is treated like a reload command
+	if configChanged {
+		log.Infof("checkin: configuration changed, redeploying")
+		self.etag = ``
+	}
+
+	if response.Location != `` && response.Location != self.location {
+		log.Noticef("checkin: switching from %s to %s", self.location, response.Location)
+		self.location = response.Location
+		self.etag = ``
+	}
+
+	for _, command := range response.Commands {
+		log.Infof("checkin: received %s command %s", command.Name, command.ID)
+
+		switch command.Name {
+		case CommandReload:
+			self.etag = ``
+		case CommandRestart:
+			requestReload(self.reload)
+		case CommandScreenshot:
+			go func(command CheckinCommand) {
+				if err := UploadScreenshot(self.options.CheckinURL, command); err != nil {
+					log.Warningf("checkin: %v", err)
+				}
+			}(command)
+		default:
+			log.Warningf("checkin: unknown command %q", command.Name)
+		}
+	}
+
+	return nil
+}
+
+// generates the given application into a new build directory and makes it the current one.
+// Files that haven't changed since the current build may be taken from it rather than fetched.
+func (self *Updater) deploy(app *Application) error {
+	if self.options.SourceLocation != `` {
+		app.SourceLocation = self.options.SourceLocation
+	}
+
+	if err := os.MkdirAll(self.options.DestDir, 0755); err != nil {
+		return err
+	}
+
+	staged, err := ioutil.TempDir(self.options.DestDir, buildDirPrefix+time.Now().UTC().Format(`20060102-150405-`))
+
+	if err != nil {
+		return err
+	}
+
+	options := self.options.GenerateOptions
+	options.DestDir = staged
+	options.Incremental = false
+
+	if current := self.current(); current != `` {
+		options.Fetch.DeltaBase = filepath.Join(self.options.DestDir, current)
+	}
+
+	log.Infof("update: generating %s into %s", self.location, staged)
+
+	if err := app.Generate(options); err != nil {
+		os.RemoveAll(staged)
+		return fmt.Errorf("update: %v", err)
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	previous := self.current()
+
+	if err := swapSymlink(self.currentDir(), filepath.Base(staged)); err != nil {
+		os.RemoveAll(staged)
+		return fmt.Errorf("update: %v", err)
+	}
+
+	self.etag = app.ETag()
+	self.previous = previous
+	self.swappedAt = time.Now()
+	self.prune()
+
+	log.Noticef("update: deployed %s", filepath.Base(staged))
+	return nil
+}
+
+// called when the running application exits; a build that fails soon after being deployed is
+// replaced by the one before it, and the application restarted.  The failed version is not
+// deployed again until the application changes once more.
+func (self *Updater) exited(err error) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.previous == `` || time.Since(self.swappedAt) >= self.options.HealthWindow {
+		return false
+	}
+
+	failed := self.current()
+	log.Errorf("update: %s exited within %v of being deployed (%v), rolling back to %s", failed, self.options.HealthWindow, err, self.previous)
+
+	if err := swapSymlink(self.currentDir(), self.previous); err == nil {
+		self.previous = ``
+		os.RemoveAll(filepath.Join(self.options.DestDir, failed))
+		return true
+	} else {
+		log.Errorf("update: rollback failed: %v", err)
+		return false
+	}
+}
+
+// returns the name of the build directory the current symlink points at, if any.
+func (self *Updater) current() string {
+	if target, err := os.Readlink(self.currentDir()); err == nil {
+		return filepath.Base(target)
+	}
+
+	return ``
+}
+
+func (self *Updater) currentDir() string {
+	return filepath.Join(self.options.DestDir, CurrentBuildLink)
+}
+
+// removes every build other than the current and previous ones, and the one the supervisor (if
+// any) last knew to be good.
+func (self *Updater) prune() {
+	keep := map[string]bool{
+		self.current(): true,
+		self.previous:  true,
+	}
+
+	if state, err := LoadSupervisorState(filepath.Join(self.options.DestDir, SupervisorStateFilename)); err == nil && state.GoodSlot != `` {
+		keep[state.GoodSlot] = true
+	}
+
+	if entries, err := ioutil.ReadDir(self.options.DestDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() && strings.HasPrefix(entry.Name(), buildDirPrefix) && !keep[entry.Name()] {
+				log.Debugf("update: removing old build %s", entry.Name())
+				os.RemoveAll(filepath.Join(self.options.DestDir, entry.Name()))
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+func TestLoadIfChanged(t *testing.T) {
+	assert := require.New(t)
+
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests += 1
+
+		if req.Header.Get(`If-None-Match`) == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set(`ETag`, `"v1"`)
+		w.Write([]byte("imports:\n  - QtQuick 2.11\n"))
+	}))
+
+	defer server.Close()
+
+	app, err := LoadIfChanged(server.URL+`/app.yaml`, ``)
+	assert.NoError(err)
+	assert.Equal(`"v1"`, app.ETag())
+	assert.Equal(server.URL+`/app.yaml`, app.Location())
+
+	_, err = LoadIfChanged(server.URL+`/app.yaml`, app.ETag())
+	assert.Equal(ErrNotModified, err)
+	assert.Equal(2, requests)
+
+	// local files are compared by size and modification time
+	tmp, err := ioutil.TempDir(``, `hydra-update-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	appfile := filepath.Join(tmp, EntrypointFilename)
+	assert.NoError(ioutil.WriteFile(appfile, []byte("imports:\n  - QtQuick 2.11\n"), 0644))
+
+	app, err = LoadIfChanged(appfile, ``)
+	assert.NoError(err)
+
+	_, err = LoadIfChanged(appfile, app.ETag())
+	assert.Equal(ErrNotModified, err)
+
+	assert.NoError(ioutil.WriteFile(appfile, []byte("imports:\n  - QtQuick.Window 2.11\n"), 0644))
+	changed, err := LoadIfChanged(appfile, app.ETag())
+	assert.NoError(err)
+	assert.NotEqual(app.ETag(), changed.ETag())
+}
+
+func TestUpdaterDeployAndRollback(t *testing.T) {
+	assert := require.New(t)
+
+	tmp, err := ioutil.TempDir(``, `hydra-update-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcDir := filepath.Join(tmp, `src`)
+	outDir := filepath.Join(tmp, `out`)
+	appfile := filepath.Join(srcDir, EntrypointFilename)
+
+	copyTestdata(t, filepath.Join(`testdata`, `generate`, `signals`, `src`), srcDir)
+
+	app, err := Load(appfile)
+	assert.NoError(err)
+
+	updater := &Updater{
+		location: app.Location(),
+		options: UpdateOptions{
+			GenerateOptions: GenerateOptions{
+				DestDir: outDir,
+			},
+			HealthWindow: time.Minute,
+		},
+	}
+
+	assert.NoError(updater.deploy(app))
+	first := updater.current()
+	assert.NotEmpty(first)
+	assert.FileExists(filepath.Join(outDir, CurrentBuildLink, `app.qml`))
+
+	// nothing is deployed while the application is unchanged...
+	assert.NoError(updater.check())
+	assert.Equal(first, updater.current())
+
+	// ...and a new build once it changes
+	data, err := ioutil.ReadFile(appfile)
+	assert.NoError(err)
+	assert.NoError(ioutil.WriteFile(appfile, append(data, []byte("\n# changed\n")...), 0644))
+
+	assert.NoError(updater.check())
+	second := updater.current()
+	assert.NotEqual(first, second)
+	assert.FileExists(filepath.Join(outDir, first, `app.qml`))
+
+	// a new build that exits within the health window is rolled back
+	assert.True(updater.exited(nil))
+	assert.Equal(first, updater.current())
+	assert.False(fileutil.DirExists(filepath.Join(outDir, second)))
+
+	// but the build rolled back to is not
+	assert.False(updater.exited(nil))
+	assert.Equal(first, updater.current())
+
+	// nor is the failed version deployed again
+	assert.NoError(updater.check())
+	assert.Equal(first, updater.current())
+}
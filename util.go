@@ -1,14 +1,11 @@
 package hydra
 
 import (
-	"archive/tar"
-	"bufio"
-	"compress/gzip"
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -82,49 +79,6 @@ func lines(data []byte) (out []string) {
 	return
 }
 
-func fetch(uri string) (string, io.ReadCloser, error) {
-	var rc io.ReadCloser
-	var baseFilename string
-
-	if u, err := url.Parse(uri); err == nil {
-		switch u.Scheme {
-		case `http`, `https`:
-			if res, err := http.Get(u.String()); err == nil {
-				if res.StatusCode < 400 {
-					baseFilename = filepath.Base(u.Path)
-					rc = res.Body
-				} else {
-					return ``, nil, fmt.Errorf("http: HTTP %v", res.Status)
-				}
-			} else {
-				return ``, nil, fmt.Errorf("http: %v", err)
-			}
-		case `file`, ``:
-			filename := fileutil.MustExpandUser(
-				filepath.Join(u.Host, u.Path),
-			)
-
-			baseFilename = filepath.Base(filename)
-
-			if f, err := os.Open(filename); err == nil {
-				rc = f
-			} else {
-				return ``, nil, fmt.Errorf("file: %v", err)
-			}
-		default:
-			return ``, nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
-		}
-	} else {
-		return ``, nil, fmt.Errorf("uri: %v", err)
-	}
-
-	if rc != nil {
-		return baseFilename, rc, nil
-	} else {
-		return ``, nil, fmt.Errorf("no data")
-	}
-}
-
 func env(in interface{}) string {
 	return stringutil.ExpandEnv(typeutil.String(in))
 }
@@ -228,74 +182,83 @@ func writeQmldir(outdir string, modname string) error {
 
 	if qmlfiles, err := filepath.Glob(filepath.Join(outdir, `*.qml`)); err == nil {
 		if len(qmlfiles) == 0 {
+			// a directory whose QML files have all been removed shouldn't keep declaring them
+			if fileutil.FileExists(path) {
+				return os.Remove(path)
+			}
+
 			return nil
 		}
 
-		if qmldir, err := os.Create(path); err == nil {
-			// log.Debugf("qmldir: %s", path)
-			defer qmldir.Close()
-
-			w := bufio.NewWriter(qmldir)
+		// log.Debugf("qmldir: %s", path)
+		var w bytes.Buffer
 
-			if _, err := w.WriteString("module " + modname + "\n"); err != nil {
-				return err
-			}
+		w.WriteString("module " + modname + "\n")
 
-			sort.Strings(qmlfiles)
+		sort.Strings(qmlfiles)
 
-			var singletons []string
-			var modules []string
+		var singletons []string
+		var modules []string
 
-			for _, qmlfile := range qmlfiles {
-				if lines, err := fileutil.ReadAllLines(qmlfile); err == nil {
-					var singleton bool
-					var version string = `1.0`
-					var path string = strings.TrimPrefix(qmlfile, outdir+`/`)
-					var base string = strings.TrimSuffix(filepath.Base(qmlfile), filepath.Ext(qmlfile))
+		for _, qmlfile := range qmlfiles {
+			if lines, err := fileutil.ReadAllLines(qmlfile); err == nil {
+				var singleton bool
+				var version string = `1.0`
+				var path string = strings.TrimPrefix(qmlfile, outdir+`/`)
+				var base string = strings.TrimSuffix(filepath.Base(qmlfile), filepath.Ext(qmlfile))
 
-					if base == `` {
-						continue
-					}
+				if base == `` {
+					continue
+				}
 
-				LineLoop:
-					for _, line := range lines {
-						if rxutil.Match(`^\s*pragma\s+Singleton\s*$`, line) != nil {
-							singleton = true
-							break LineLoop
-						}
+			LineLoop:
+				for _, line := range lines {
+					if rxutil.Match(`^\s*pragma\s+Singleton\s*$`, line) != nil {
+						singleton = true
+						break LineLoop
 					}
+				}
 
-					if singleton {
-						singletons = append(singletons, `singleton `+base+` `+version+` `+path)
-					} else {
-						modules = append(modules, base+` `+version+` `+path)
-					}
+				if singleton {
+					singletons = append(singletons, `singleton `+base+` `+version+` `+path)
 				} else {
-					return fmt.Errorf("read %s: %v", qmlfile, err)
+					modules = append(modules, base+` `+version+` `+path)
 				}
+			} else {
+				return fmt.Errorf("read %s: %v", qmlfile, err)
 			}
+		}
 
-			if len(singletons) > 0 {
-				if _, err := w.WriteString(strings.Join(singletons, "\n") + "\n\n"); err != nil {
-					return fmt.Errorf("bad write: %v", err)
-				}
-			}
+		if len(singletons) > 0 {
+			w.WriteString(strings.Join(singletons, "\n") + "\n\n")
+		}
 
-			if len(modules) > 0 {
-				if _, err := w.WriteString(strings.Join(modules, "\n") + "\n"); err != nil {
-					return fmt.Errorf("bad write: %v", err)
-				}
-			}
+		if len(modules) > 0 {
+			w.WriteString(strings.Join(modules, "\n") + "\n")
+		}
 
-			return w.Flush()
-		} else {
+		if err := writeFileIfChanged(w.Bytes(), path); err != nil {
 			return fmt.Errorf("qmldir: %v", err)
 		}
+
+		return nil
 	} else {
 		return fmt.Errorf("glob: %v", err)
 	}
 }
 
+// Writes data to the given file, creating parent directories as needed.  If the file already
+// holds exactly this data it is left alone, preserving its modification time so that build
+// tools don't consider it changed.
+func writeFileIfChanged(data []byte, filename string) error {
+	if existing, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	_, err := fileutil.WriteFile(data, filename)
+	return err
+}
+
 func relativePathFromSource(source string) string {
 	if strings.Contains(source, `://`) {
 		if u, err := url.Parse(source); err == nil {
@@ -312,109 +275,3 @@ func relativePathFromSource(source string) string {
 		return source
 	}
 }
-
-type archiveType int
-
-const (
-	NoArchive archiveType = iota
-	TarGz
-)
-
-func getArchiveType(archive string) archiveType {
-	archive = strings.ToLower(archive)
-
-	if strings.HasSuffix(archive, `.tar.gz`) {
-		return TarGz
-	} else {
-		return NoArchive
-	}
-}
-
-func extract(manifest *Manifest, archive string, destdir string) error {
-	atype := getArchiveType(archive)
-
-	if atype != NoArchive {
-		if f, err := os.Open(archive); err == nil {
-			defer f.Close()
-
-			switch atype {
-			case TarGz:
-				if err := untar(destdir, f, func(path string, info os.FileInfo, err error) error {
-					if err == nil {
-						return manifest.Append(path, info)
-					} else {
-						return err
-					}
-				}); err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf("unsupported archive type")
-			}
-
-			f.Close()
-
-			log.Debugf("removing extracted archive: %s", archive)
-			return os.Remove(archive)
-		} else {
-			return err
-		}
-	} else {
-		return nil
-	}
-}
-
-func untar(dst string, r io.Reader, fn filepath.WalkFunc) error {
-	if gzr, err := gzip.NewReader(r); err == nil {
-		defer gzr.Close()
-
-		tr := tar.NewReader(gzr)
-
-		for {
-			header, err := tr.Next()
-
-			switch {
-			case err == io.EOF: // if no more files are found return
-				return nil
-			case err != nil: // return any other error
-				return err
-			case header == nil: // if the header is nil, just skip it (not sure how this happens)
-				continue
-			}
-
-			// the target location where the dir/file should be created
-			target := filepath.Join(dst, header.Name)
-
-			// check the file type
-			switch header.Typeflag {
-			case tar.TypeDir: // if its a dir and it doesn't exist create it
-				if err := os.MkdirAll(target, 0755); err != nil {
-					return err
-				}
-
-			case tar.TypeReg: // if it's a file create it
-				if f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode)); err == nil {
-					defer f.Close()
-
-					if _, err := io.Copy(f, tr); err != nil {
-						return err
-					}
-
-					f.Close()
-				} else {
-					return err
-				}
-			}
-
-			if fn != nil {
-				info, serr := os.Stat(target)
-
-				if err := fn(target, info, serr); err != nil {
-					return err
-				}
-			}
-		}
-	} else {
-		return err
-	}
-}
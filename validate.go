@@ -0,0 +1,501 @@
+package hydra
+
+import (
+	"encoding"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/maputil"
+	"github.com/ghetzel/go-stockutil/stringutil"
+	"github.com/ghetzel/go-stockutil/typeutil"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// A Diagnostic describes a single problem found while validating an application or module,
+// along with the position in the source file where it was found (if known).
+type Diagnostic struct {
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (self Diagnostic) String() string {
+	var pos []string
+
+	if self.Filename != `` {
+		pos = append(pos, self.Filename)
+	}
+
+	if self.Line > 0 {
+		pos = append(pos, fmt.Sprintf("%d:%d", self.Line, self.Column))
+	}
+
+	if len(pos) > 0 {
+		return strings.Join(pos, `:`) + `: ` + self.Message
+	} else {
+		return self.Message
+	}
+}
+
+type Diagnostics []Diagnostic
+
+func (self Diagnostics) Error() string {
+	var msgs []string
+
+	for _, d := range self {
+		msgs = append(msgs, d.String())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (self Diagnostics) err() error {
+	if len(self) > 0 {
+		return self
+	} else {
+		return nil
+	}
+}
+
+// tracks the source file and YAML document being validated, and accumulates any problems found.
+type validator struct {
+	filename    string
+	diagnostics Diagnostics
+}
+
+func (self *validator) add(node *yamlv3.Node, format string, args ...interface{}) {
+	diag := Diagnostic{
+		Filename: self.filename,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	if node != nil {
+		diag.Line = node.Line
+		diag.Column = node.Column
+	}
+
+	self.diagnostics = append(self.diagnostics, diag)
+}
+
+// Validates the given application or module file, reporting every problem found (unknown
+// keys, malformed values, and semantic errors in the component tree) along with its
+// position in the file.  Files named app.yaml or *.app.yaml (or app.json, etc.) are validated
+// as applications, all others as modules.  Templates (see RenderTemplate) are validated as they
+// render here, and other formats as they decode, so positions in them are those of the YAML
+// that results.
+func ValidateFile(filename string) error {
+	if fn, err := fileutil.ExpandUser(filename); err == nil {
+		filename = fn
+	} else {
+		return err
+	}
+
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		var root yamlv3.Node
+		var v = &validator{
+			filename: filename,
+		}
+
+		if decoded, err := decodeDocument(filename, DecoderFor(filename), data, filepath.Dir(filename)); err == nil {
+			data = decoded
+		} else {
+			v.add(nil, "%v", err)
+			return v.diagnostics.err()
+		}
+
+		if err := yamlv3.Unmarshal(data, &root); err != nil {
+			v.add(nil, "syntax: %v", err)
+			return v.diagnostics.err()
+		}
+
+		doc := documentNode(&root)
+
+		if isEntrypointFile(filename) {
+			var app Application
+
+			v.checkSchema(doc, reflect.TypeOf(app))
+
+			if err := yaml.Unmarshal(data, &app); err == nil {
+				app.sourceFile = filename
+				app.sourceNode = doc
+				v.expandModule(&app.Module, doc, nil)
+				v.diagnostics = append(v.diagnostics, app.diagnostics()...)
+			} else {
+				v.add(doc, "parse: %v", err)
+			}
+		} else {
+			var mod Module
+
+			v.checkSchema(doc, reflect.TypeOf(mod))
+
+			if err := yaml.Unmarshal(data, &mod); err == nil {
+				mod.sourceFile = filename
+				mod.sourceNode = doc
+				v.expandModule(&mod, doc, nil)
+				v.diagnostics = append(v.diagnostics, mod.diagnostics()...)
+			} else {
+				v.add(doc, "parse: %v", err)
+			}
+		}
+
+		return v.diagnostics.err()
+	} else {
+		return err
+	}
+}
+
+// Walks the application's module, component, property, signal, function, and behavior
+// definitions and reports every problem found.  If the application was loaded from a file,
+// each problem will include the line and column it was found at.
+func (self *Application) Validate() error {
+	return self.diagnostics().err()
+}
+
+func (self *Application) diagnostics() Diagnostics {
+	return self.Module.diagnostics()
+}
+
+// Validates the module definition and all of its inline submodules.
+func (self *Module) Validate() error {
+	return self.diagnostics().err()
+}
+
+func (self *Module) diagnostics() Diagnostics {
+	v := &validator{
+		filename: self.sourceFile,
+	}
+
+	v.validateModule(self, self.sourceNode)
+
+	return v.diagnostics
+}
+
+func (self *validator) validateModule(mod *Module, node *yamlv3.Node) {
+	for i, imp := range mod.Imports {
+		if _, err := toImportStatement(imp); err != nil {
+			self.add(seqItem(mapValue(node, `imports`), i, node), "invalid import %q: %v", imp, err)
+		}
+	}
+
+	for i, submod := range mod.Modules {
+		self.validateModule(submod, seqItem(mapValue(node, `modules`), i, node))
+	}
+
+	if mod.Definition != nil {
+		ids := make(map[string]*yamlv3.Node)
+		self.validateComponent(mod.Definition, nil, orNode(mapValue(node, `definition`), node), ids)
+	}
+}
+
+func (self *validator) validateComponent(component *Component, parent *Component, node *yamlv3.Node, ids map[string]*yamlv3.Node) {
+	if component.Type == `` && component.Use == `` {
+		self.add(node, "Component must specify a type.")
+	}
+
+	if id := component.ID; id != `` {
+		idNode := orNode(mapValue(node, `id`), node)
+
+		if first, ok := ids[id]; ok {
+			if first != nil && first.Line > 0 {
+				self.add(idNode, "duplicate id %q (first declared at %d:%d)", id, first.Line, first.Column)
+			} else {
+				self.add(idNode, "duplicate id %q", id)
+			}
+		} else {
+			ids[id] = idNode
+		}
+	}
+
+	self.validateLayout(component, parent, node)
+
+	for i, sig := range component.Signals {
+		sigNode := seqItem(mapValue(node, `signals`), i, node)
+
+		if sig == nil {
+			continue
+		} else if sig.Name == `` {
+			self.add(sigNode, "signal must specify a name")
+		}
+
+		for j, arg := range sig.Arguments {
+			argNode := seqItem(mapValue(sigNode, `args`), j, sigNode)
+
+			if arg.Name == `` {
+				self.add(argNode, "signal %q: argument %d: name missing", sig.Name, j)
+			}
+
+			if arg.Type == `` {
+				self.add(argNode, "signal %q: argument %q: type missing", sig.Name, arg.Name)
+			}
+		}
+	}
+
+	for i, prop := range component.Public {
+		propNode := seqItem(mapValue(node, `public`), i, node)
+
+		if prop == nil {
+			continue
+		} else if prop.Name == `` {
+			self.add(propNode, "public property must specify a name")
+		}
+	}
+
+	for i, fn := range component.Functions {
+		if err := fn.Validate(); err != nil {
+			self.add(seqItem(mapValue(node, `functions`), i, node), "%v", err)
+		}
+	}
+
+	for i, behavior := range component.Behaviors {
+		bNode := seqItem(mapValue(node, `behaviors`), i, node)
+
+		if behavior.For == `` {
+			self.add(bNode, "behavior must specify the property it applies to")
+		}
+
+		if behavior.Animation == nil {
+			self.add(bNode, "behavior on %q must define an animation", behavior.For)
+		} else {
+			self.validateComponent(behavior.Animation, component, orNode(mapValue(bNode, `animation`), bNode), ids)
+		}
+	}
+
+	for _, name := range component.PropertyNames() {
+		value := component.Properties[name]
+		prop := Property{
+			Name:  name,
+			Value: value,
+		}
+
+		if prop.shouldInline() {
+			inline := new(Component)
+			valueNode := orNode(mapValue(mapValue(node, `properties`), name), node)
+
+			if err := maputil.TaggedStructFromMap(value, inline, `json`); err == nil {
+				self.validateComponent(inline, nil, valueNode, make(map[string]*yamlv3.Node))
+			} else {
+				self.add(valueNode, "property %q: bad inline component: %v", name, err)
+			}
+		}
+	}
+
+	for i, child := range component.Components {
+		if child != nil {
+			self.validateComponent(child, component, component.childNode(node, i), ids)
+		}
+	}
+}
+
+func (self *validator) validateLayout(component *Component, parent *Component, node *yamlv3.Node) {
+	var fill interface{}
+	var flex int
+	var flexNode *yamlv3.Node
+
+	if layout := component.Layout; layout != nil {
+		layoutNode := orNode(mapValue(node, `layout`), node)
+
+		fill = layout.Fill
+		flex = layout.Flex
+		flexNode = orNode(mapValue(layoutNode, `flex`), layoutNode)
+
+		if layout.Fill != nil {
+			self.checkLayoutMode(`fill`, layout.Fill, orNode(mapValue(layoutNode, `fill`), layoutNode))
+		}
+
+		if layout.HorizontalCenter != `` {
+			self.checkLayoutMode(`center`, layout.HorizontalCenter, orNode(mapValue(layoutNode, `center`), layoutNode))
+		}
+
+		if layout.VerticalCenter != `` {
+			self.checkLayoutMode(`vcenter`, layout.VerticalCenter, orNode(mapValue(layoutNode, `vcenter`), layoutNode))
+		}
+	} else {
+		fill = component.Fill
+		flex = component.Flex
+		flexNode = orNode(mapValue(node, `flex`), node)
+
+		if fill != nil {
+			self.checkLayoutMode(`fill`, fill, orNode(mapValue(node, `fill`), node))
+		}
+	}
+
+	if flex < 0 {
+		self.add(flexNode, "flex must be a positive number, got %d", flex)
+	} else if flex > 0 && parent != nil {
+		switch parent.Type {
+		case `RowLayout`, `ColumnLayout`:
+			break
+		default:
+			self.add(flexNode, "flex has no effect inside a %s (must be a RowLayout or ColumnLayout)", parent.Type)
+		}
+	}
+}
+
+// layout values must either be a boolean or a reference to another component's ID (@id)
+func (self *validator) checkLayoutMode(name string, value interface{}, node *yamlv3.Node) {
+	switch v := value.(type) {
+	case bool:
+		return
+	case string:
+		if strings.HasPrefix(v, `@`) {
+			if len(v) > 1 {
+				return
+			}
+		} else {
+			switch strings.ToLower(v) {
+			case `true`, `false`, `yes`, `no`, `on`, `off`:
+				return
+			}
+		}
+	}
+
+	self.add(node, "unknown %s layout mode %q (must be true, false, or @id)", name, typeutil.String(value))
+}
+
+// Compares the keys in the given YAML node against the fields of the type it will be decoded
+// into, reporting any that are not recognized.
+func (self *validator) checkSchema(node *yamlv3.Node, t reflect.Type) {
+	if node == nil {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yamlv3.AliasNode:
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if node.Kind == yamlv3.SequenceNode {
+			for _, item := range node.Content {
+				self.checkSchema(item, t.Elem())
+			}
+		} else if node.Tag != `!!null` {
+			self.add(node, "expected a list, got %s", nodeKind(node))
+		}
+
+	case reflect.Struct:
+		if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+			return
+		}
+
+		if node.Kind == yamlv3.MappingNode {
+			fields := yamlFields(t)
+
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i]
+
+				if ftype, ok := fields[key.Value]; ok {
+					self.checkSchema(node.Content[i+1], ftype)
+				} else {
+					self.add(key, "unknown field %q in %s", key.Value, strings.ToLower(t.Name()))
+				}
+			}
+		} else if node.Tag != `!!null` {
+			self.add(node, "expected a mapping, got %s", nodeKind(node))
+		}
+	}
+}
+
+// returns the YAML keys a struct type accepts, mapped to the type of the field they decode into.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts := stringutil.SplitPair(field.Tag.Get(`yaml`), `,`)
+
+		if name == `-` {
+			continue
+		} else if strings.Contains(opts, `inline`) {
+			for k, v := range yamlFields(field.Type) {
+				fields[k] = v
+			}
+
+			continue
+		} else if field.PkgPath != `` {
+			continue
+		}
+
+		if name == `` {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+func isEntrypointFile(filename string) bool {
+	base := filepath.Base(filename)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	entrypoint := strings.TrimSuffix(EntrypointFilename, filepath.Ext(EntrypointFilename))
+
+	return IsDocumentFile(base) && (name == entrypoint || strings.HasSuffix(name, `.`+entrypoint))
+}
+
+func documentNode(node *yamlv3.Node) *yamlv3.Node {
+	if node != nil && node.Kind == yamlv3.DocumentNode {
+		if len(node.Content) > 0 {
+			return node.Content[0]
+		} else {
+			return nil
+		}
+	}
+
+	return node
+}
+
+func nodeKind(node *yamlv3.Node) string {
+	switch node.Kind {
+	case yamlv3.SequenceNode:
+		return `a list`
+	case yamlv3.MappingNode:
+		return `a mapping`
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
+
+// returns the value node for the given key of a mapping node, or nil.
+func mapValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node != nil && node.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns the i-th item of a sequence node, falling back to the given node if not present.
+func seqItem(node *yamlv3.Node, i int, fallback *yamlv3.Node) *yamlv3.Node {
+	if node != nil && node.Kind == yamlv3.SequenceNode && i < len(node.Content) {
+		return node.Content[i]
+	}
+
+	return orNode(node, fallback)
+}
+
+func orNode(node *yamlv3.Node, fallback *yamlv3.Node) *yamlv3.Node {
+	if node != nil {
+		return node
+	}
+
+	return fallback
+}
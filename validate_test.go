@@ -0,0 +1,37 @@
+package hydra
+
+import (
+	"testing"
+
+	"github.com/ghetzel/testify/require"
+)
+
+func TestValidateFile(t *testing.T) {
+	assert := require.New(t)
+
+	assert.NoError(ValidateFile(`testdata/generate/signals/src/app.yaml`))
+	assert.NoError(ValidateFile(`testdata/generate/signals/src/lib/Toggle.yaml`))
+
+	err := ValidateFile(`testdata/validate/invalid.app.yaml`)
+	assert.Error(err)
+
+	diags, ok := err.(Diagnostics)
+	assert.True(ok)
+
+	var messages []string
+
+	for _, diag := range diags {
+		assert.Equal(`testdata/validate/invalid.app.yaml`, diag.Filename)
+		messages = append(messages, diag.String())
+	}
+
+	assert.Equal([]string{
+		`testdata/validate/invalid.app.yaml:5:3: unknown field "colour" in component`,
+		`testdata/validate/invalid.app.yaml:8:7: Component must specify a type.`,
+		`testdata/validate/invalid.app.yaml:8:11: duplicate id "a" (first declared at 6:7)`,
+		`testdata/validate/invalid.app.yaml:10:15: unknown fill layout mode "sideways" (must be true, false, or @id)`,
+		`testdata/validate/invalid.app.yaml:12:13: flex has no effect inside a Window (must be a RowLayout or ColumnLayout)`,
+		`testdata/validate/invalid.app.yaml:16:15: signal "foo": argument "x": type missing`,
+		`testdata/validate/invalid.app.yaml:18:11: behavior on "x" must define an animation`,
+	}, messages)
+}
@@ -0,0 +1,310 @@
+package hydra
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/go-stockutil/log"
+)
+
+var DefaultWatchDebounce = 250 * time.Millisecond
+
+type WatchOptions struct {
+	GenerateOptions
+	SourceLocation string
+	Debounce       time.Duration
+	Run            bool
+	RunOptions     RunOptions
+}
+
+// Watches the source tree of an application, regenerating it as files change.  Changes to
+// existing modules only regenerate the affected QML, qmldir, and app.qrc files; any other change
+// regenerates the whole application.  If the application is running, it is reloaded after each
+// regeneration.
+type Watcher struct {
+	appfile string
+	srcDir  string
+	options WatchOptions
+	app     *Application
+	reload  chan bool
+	fsw     *fsnotify.Watcher
+}
+
+// Generates the given application and regenerates it whenever its source files change.  This
+// function blocks until the application exits (if running) or an error occurs.
+func Watch(appfile string, options WatchOptions) error {
+	if options.Debounce <= 0 {
+		options.Debounce = DefaultWatchDebounce
+	}
+
+	watcher := &Watcher{
+		appfile: appfile,
+		options: options,
+		reload:  make(chan bool, 1),
+	}
+
+	if err := watcher.regenerate(); err != nil {
+		return err
+	}
+
+	if fsw, err := fsnotify.NewWatcher(); err == nil {
+		watcher.fsw = fsw
+		defer fsw.Close()
+	} else {
+		return fmt.Errorf("watch: %v", err)
+	}
+
+	if err := watcher.watchTree(watcher.srcDir); err != nil {
+		return err
+	}
+
+	return watcher.loop()
+}
+
+func (self *Watcher) loop() error {
+	var runerr = make(chan error, 1)
+	var pending = make(map[string]fsnotify.Op)
+	var debounce = time.NewTimer(self.options.Debounce)
+
+	debounce.Stop()
+
+	if self.options.Run {
+		runopts := self.options.RunOptions
+		runopts.Reload = self.reload
+
+		go func() {
+			runerr <- RunWithOptions(self.options.DestDir, runopts)
+		}()
+	}
+
+	log.Infof("watching %s for changes", self.srcDir)
+
+	for {
+		select {
+		case event, ok := <-self.fsw.Events:
+			if !ok {
+				return nil
+			}
+
+			if self.ignored(event.Name) {
+				continue
+			}
+
+			log.Debugf("watch: %v", event)
+			pending[event.Name] |= event.Op
+			debounce.Reset(self.options.Debounce)
+
+		case err, ok := <-self.fsw.Errors:
+			if !ok {
+				return nil
+			}
+
+			log.Warningf("watch: %v", err)
+
+		case <-debounce.C:
+			if err := self.apply(pending); err == nil {
+				requestReload(self.reload)
+			} else {
+				log.Errorf("watch: %v", err)
+			}
+
+			pending = make(map[string]fsnotify.Op)
+
+		case err := <-runerr:
+			return err
+		}
+	}
+}
+
+// regenerates the application in response to the given set of changed files.
+func (self *Watcher) apply(changes map[string]fsnotify.Op) error {
+	var modules []*ManifestFile
+	var full bool
+	var paths []string
+
+	for path := range changes {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		op := changes[path]
+
+		if op&fsnotify.Create != 0 && fileutil.DirExists(path) {
+			if err := self.watchTree(path); err != nil {
+				return err
+			}
+		}
+
+		// editors that save by replacing the file show up as renames and creates, so only the
+		// file still existing matters here
+		if module := self.moduleFor(path); module != nil && fileutil.FileExists(path) {
+			modules = append(modules, module)
+		} else {
+			full = true
+		}
+	}
+
+	if full {
+		return self.regenerate()
+	}
+
+	for _, module := range modules {
+		if err := self.regenerateModule(module); err != nil {
+			return err
+		}
+	}
+
+	if err := self.app.writeQrc(self.options.DestDir); err != nil {
+		return err
+	}
+
+	if self.options.Autobuild {
+		return self.app.build(self.options.DestDir)
+	}
+
+	return nil
+}
+
+// reloads the application from its source file and generates all of it.  After the first run,
+// generation is always incremental so that unchanged files (and build objects) are kept.
+func (self *Watcher) regenerate() error {
+	options := self.options.GenerateOptions
+
+	if self.app != nil {
+		options.Incremental = true
+	}
+
+	if app, err := Load(self.appfile); err == nil {
+		if self.options.SourceLocation != `` {
+			app.SourceLocation = self.options.SourceLocation
+		}
+
+		if fileutil.DirExists(app.SourceLocation) {
+			self.srcDir, _ = filepath.Abs(app.SourceLocation)
+		} else {
+			return fmt.Errorf("watch: source location %q is not a local directory", app.SourceLocation)
+		}
+
+		if err := app.Generate(options); err == nil {
+			self.app = app
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// copies a changed module into the output directory and regenerates only its QML and qmldir.
+func (self *Watcher) regenerateModule(file *ManifestFile) error {
+	intoDir := self.options.DestDir
+	dest := filepath.Join(intoDir, file.Name)
+
+	log.Infof("regenerating module %s", file.Name)
+
+	if src, err := os.Open(filepath.Join(self.srcDir, file.Name)); err == nil {
+		defer src.Close()
+
+		if _, err := fileutil.WriteFile(src, dest); err != nil {
+			return fmt.Errorf("%s: write: %v", file.Name, err)
+		}
+	} else {
+		return fmt.Errorf("%s: read: %v", file.Name, err)
+	}
+
+	module := new(Module)
+
+	if err := LoadModule(dest, module); err == nil {
+		module.Source = file.Name
+	} else {
+		return fmt.Errorf("module %s: %v", file.Name, err)
+	}
+
+	if modules, err := self.app.Manifest.LoadModules(intoDir); err == nil {
+		modules = append(self.app.getBuiltinModules(), modules...)
+
+		if err := checkModuleTypes(self.options.GenerateOptions, modules, module); err != nil {
+			return fmt.Errorf("typecheck:\n%v", err)
+		}
+	} else {
+		return err
+	}
+
+	if err := module.writeModuleQml(intoDir, self.app.Manifest.GlobalImports); err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(module.AbsolutePath(intoDir)); dir == self.absDestDir() {
+		return writeQmldir(dir, `Application`)
+	} else {
+		return writeQmldir(dir, ``)
+	}
+}
+
+// returns the manifest entry for the module at the given source path, if it is one.
+func (self *Watcher) moduleFor(path string) *ManifestFile {
+	if self.app == nil || self.app.Manifest == nil {
+		return nil
+	}
+
+	if rel, err := filepath.Rel(self.srcDir, path); err == nil {
+		if rel == filepath.Base(self.appfile) || rel == EntrypointFilename {
+			return nil
+		}
+
+		for _, file := range self.app.Manifest.Modules {
+			if file.Name == rel {
+				return file
+			}
+		}
+	}
+
+	return nil
+}
+
+// adds the given directory and all directories beneath it to the watch list.
+func (self *Watcher) watchTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			if info.IsDir() {
+				if path != root && self.ignored(path) {
+					return filepath.SkipDir
+				}
+
+				log.Debugf("watch: add %s", path)
+				return self.fsw.Add(path)
+			}
+		}
+
+		return err
+	})
+}
+
+// changes to hidden files and anything inside the output directory are not relevant.
+func (self *Watcher) ignored(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), `.`) {
+		return true
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		if destDir := self.absDestDir(); abs == destDir || strings.HasPrefix(abs, destDir+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *Watcher) absDestDir() string {
+	abs, _ := filepath.Abs(self.options.DestDir)
+	return abs
+}
@@ -0,0 +1,70 @@
+package hydra
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ghetzel/go-stockutil/fileutil"
+	"github.com/ghetzel/testify/require"
+)
+
+func TestWatchRegenerateModule(t *testing.T) {
+	assert := require.New(t)
+	tmp, err := ioutil.TempDir(``, `hydra-watch-`)
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	srcDir := filepath.Join(tmp, `src`)
+	outDir := filepath.Join(tmp, `out`)
+
+	copyTestdata(t, filepath.Join(`testdata`, `generate`, `signals`, `src`), srcDir)
+
+	watcher := &Watcher{
+		appfile: filepath.Join(srcDir, EntrypointFilename),
+		options: WatchOptions{
+			GenerateOptions: GenerateOptions{
+				DestDir: outDir,
+			},
+		},
+	}
+
+	assert.NoError(watcher.regenerate())
+	assert.FileExists(filepath.Join(outDir, `lib`, `Toggle.qml`))
+
+	// modules are regenerated on their own
+	toggle := filepath.Join(srcDir, `lib`, `Toggle.yaml`)
+	data, err := ioutil.ReadFile(toggle)
+	assert.NoError(err)
+
+	_, err = fileutil.WriteFile(strings.Replace(string(data), `duration: 250`, `duration: 500`, 1), toggle)
+	assert.NoError(err)
+
+	entrypoint, err := os.Stat(filepath.Join(outDir, `app.qml`))
+	assert.NoError(err)
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NotNil(watcher.moduleFor(toggle))
+	assert.NoError(watcher.apply(map[string]fsnotify.Op{
+		toggle: fsnotify.Write,
+	}))
+
+	qml, err := ioutil.ReadFile(filepath.Join(outDir, `lib`, `Toggle.qml`))
+	assert.NoError(err)
+	assert.Contains(string(qml), `duration: 500`)
+	assert.FileExists(filepath.Join(outDir, `lib`, `qmldir`))
+
+	after, err := os.Stat(filepath.Join(outDir, `app.qml`))
+	assert.NoError(err)
+	assert.Equal(entrypoint.ModTime(), after.ModTime())
+
+	// anything else regenerates everything
+	assert.Nil(watcher.moduleFor(watcher.appfile))
+	assert.True(watcher.ignored(filepath.Join(outDir, `app.qml`)))
+	assert.True(watcher.ignored(filepath.Join(srcDir, `.app.yaml.swp`)))
+	assert.False(watcher.ignored(toggle))
+}